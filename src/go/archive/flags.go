@@ -0,0 +1,52 @@
+package archive
+
+import (
+	"github.com/spf13/pflag"
+)
+
+// SelectionFlags are the command line flags that describe a Selection.
+type SelectionFlags struct {
+	accounts []string
+	folders  []string
+	since    string
+	before   string
+	filter   string
+}
+
+// Register adds the flags to the flag set.
+func (f *SelectionFlags) Register(flags *pflag.FlagSet) {
+	flags.StringArrayVar(&f.accounts, "account", nil, "only select emails of this account id (repeatable)")
+	flags.StringArrayVar(&f.folders, "folder", nil, "only select emails of this folder (repeatable)")
+	flags.StringVar(&f.since, "since", "", "only select emails received on or after this date (YYYY-MM-DD)")
+	flags.StringVar(&f.before, "before", "", "only select emails received before this date (YYYY-MM-DD)")
+	flags.StringVar(&f.filter, "filter", "", "additional PocketBase filter on the emails")
+}
+
+// Selection returns the selection described by the parsed flags.
+func (f *SelectionFlags) Selection() (Selection, error) {
+	return NewSelection(f.accounts, f.folders, f.since, f.before, f.filter)
+}
+
+// NewSelection creates a selection from its textual representation,
+// as used by the command line and the API.
+func NewSelection(accounts []string, folders []string, since string, before string, filter string) (Selection, error) {
+	selection := Selection{
+		Accounts: accounts,
+		Folders:  folders,
+		Filter:   filter,
+	}
+
+	var err error
+	if since != "" {
+		if selection.Since, err = ParseDate(since); err != nil {
+			return selection, err
+		}
+	}
+	if before != "" {
+		if selection.Before, err = ParseDate(before); err != nil {
+			return selection, err
+		}
+	}
+
+	return selection, nil
+}
@@ -0,0 +1,145 @@
+package archive
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+)
+
+// gmailSystemLabels maps the Gmail system labels that are shown as a folder
+// to the 'special_use' of that folder. \Inbox is the INBOX, \Important and
+// \Starred are left out, Starred is the \Flagged flag of the email.
+var gmailSystemLabels = map[string]string{
+	`\Sent`:  "sent",
+	`\Draft`: "drafts",
+}
+
+// GmailFolders maps archived emails to the folders they are shown in on the
+// server. Gmail emails are only archived in All Mail, every other folder of
+// a Gmail account is one of their labels. Emails of other servers, and Gmail
+// emails outside of All Mail like Spam and Trash, are in their own folder.
+type GmailFolders struct {
+	app      core.App
+	accounts map[string]*gmailAccount
+}
+
+// gmailAccount is what is needed to map the labels of a single account.
+type gmailAccount struct {
+	allMail string
+	// folders are the folder names by label
+	folders map[string]string
+}
+
+// NewGmailFolders creates a mapping that loads the folders of every account
+// once, when the first Gmail email of the account is mapped.
+func NewGmailFolders(app core.App) *GmailFolders {
+	return &GmailFolders{
+		app:      app,
+		accounts: map[string]*gmailAccount{},
+	}
+}
+
+// Of returns the folders the email is shown in. An email of All Mail without
+// a label that is shown as a folder stays in All Mail.
+func (g *GmailFolders) Of(email *core.Record) ([]string, error) {
+	folder := email.GetString("folder")
+	if email.GetString("gmail_msgid") == "" {
+		return []string{folder}, nil
+	}
+
+	account, err := g.account(email.GetString("smtp_account"))
+	if err != nil {
+		return nil, err
+	}
+	if folder != account.allMail {
+		return []string{folder}, nil
+	}
+
+	labelRecords, err := g.app.FindRecordsByFilter(
+		"ib_email_labels",
+		"email = {:email}",
+		"index",
+		0,
+		0,
+		dbx.Params{"email": email.Id},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find email labels: %w", err)
+	}
+
+	folders := make([]string, 0, len(labelRecords))
+	for _, labelRecord := range labelRecords {
+		name, ok := account.folders[labelRecord.GetString("label")]
+		if ok && !slices.Contains(folders, name) {
+			folders = append(folders, name)
+		}
+	}
+	if len(folders) == 0 {
+		folders = append(folders, folder)
+	}
+
+	return folders, nil
+}
+
+// allMail returns the All Mail folder of the account, or an empty string if
+// it has none.
+func (g *GmailFolders) allMail(id string) (string, error) {
+	account, err := g.account(id)
+	if err != nil {
+		return "", err
+	}
+	return account.allMail, nil
+}
+
+// account loads the All Mail folder of the account and the labels of its
+// other folders.
+func (g *GmailFolders) account(id string) (*gmailAccount, error) {
+	if account, ok := g.accounts[id]; ok {
+		return account, nil
+	}
+
+	folderRecords, err := g.app.FindAllRecords("ib_folders", dbx.HashExp{"smtp_account": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find folders of account %s: %w", id, err)
+	}
+
+	account := &gmailAccount{folders: map[string]string{}}
+	for _, folderRecord := range folderRecords {
+		name := folderRecord.GetString("name")
+		uses := folderRecord.GetStringSlice("special_use")
+
+		if slices.Contains(uses, "all") {
+			account.allMail = name
+			continue
+		}
+		if name == "INBOX" {
+			account.folders[`\Inbox`] = name
+			continue
+		}
+
+		// system folders are no labels, apart from the ones shown as folder
+		for label, use := range gmailSystemLabels {
+			if slices.Contains(uses, use) {
+				account.folders[label] = name
+			}
+		}
+		if len(uses) > 0 {
+			continue
+		}
+
+		label, err := imapclient.DecodeMailboxName(name)
+		if err != nil {
+			log.Printf("failed to decode name of folder %s: %v\n", name, err)
+			continue
+		}
+		account.folders[label] = name
+	}
+
+	g.accounts[id] = account
+	return account, nil
+}
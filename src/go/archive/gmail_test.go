@@ -0,0 +1,120 @@
+package archive
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestGmailFolders(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	account := testutil.CreateAccount(t, app, nil)
+
+	save := func(collection string, fields map[string]any) *core.Record {
+		record := core.NewRecord(testutil.Collection(t, app, collection))
+		for field, value := range fields {
+			record.Set(field, value)
+		}
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	for name, use := range map[string]string{
+		"INBOX":             "",
+		"[Gmail]/All Mail":  "all",
+		"[Gmail]/Sent Mail": "sent",
+		"[Gmail]/Spam":      "junk",
+		"Work":              "",
+		"Caf&AOk-":          "",
+	} {
+		save("ib_folders", map[string]any{"smtp_account": account.Id, "name": name, "special_use": use})
+	}
+
+	scenarios := []struct {
+		name     string
+		folder   string
+		msgid    string
+		labels   []string
+		expected []string
+	}{
+		{"inbox and label", "[Gmail]/All Mail", "1", []string{`\Important`, `\Inbox`, "Work"}, []string{"INBOX", "Work"}},
+		{"sent", "[Gmail]/All Mail", "2", []string{`\Sent`}, []string{"[Gmail]/Sent Mail"}},
+		{"encoded label", "[Gmail]/All Mail", "3", []string{"Café"}, []string{"Caf&AOk-"}},
+		{"archived", "[Gmail]/All Mail", "4", []string{`\Starred`, "Deleted label"}, []string{"[Gmail]/All Mail"}},
+		{"spam", "[Gmail]/Spam", "5", nil, []string{"[Gmail]/Spam"}},
+		{"archived before Gmail ids", "INBOX", "", nil, []string{"INBOX"}},
+	}
+
+	emails := map[string]*core.Record{}
+	for _, s := range scenarios {
+		email := save("ib_emails", map[string]any{"smtp_account": account.Id, "folder": s.folder, "gmail_msgid": s.msgid})
+		for i, label := range s.labels {
+			save("ib_email_labels", map[string]any{"email": email.Id, "index": i, "label": label})
+		}
+		emails[s.name] = email
+	}
+
+	gmail := NewGmailFolders(app)
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			folders, err := gmail.Of(emails[s.name])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(folders, s.expected) {
+				t.Fatalf("expected %v, got %v", s.expected, folders)
+			}
+		})
+	}
+
+	t.Run("mailboxes", func(t *testing.T) {
+		mailboxes, err := Selection{}.Mailboxes(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := map[string][]string{}
+		for _, mailbox := range mailboxes {
+			err := Selection{}.In(mailbox).Each(app, func(email *core.Record) error {
+				for name, record := range emails {
+					if record.Id == email.Id {
+						found[mailbox.Folder] = append(found[mailbox.Folder], name)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected := map[string][]string{
+			"INBOX":             {"archived before Gmail ids", "inbox and label"},
+			"Work":              {"inbox and label"},
+			"Caf&AOk-":          {"encoded label"},
+			"[Gmail]/All Mail":  {"archived"},
+			"[Gmail]/Sent Mail": {"sent"},
+			"[Gmail]/Spam":      {"spam"},
+		}
+		if len(found) != len(expected) {
+			t.Fatalf("expected the folders %v, got %v", expected, found)
+		}
+		for folder, names := range expected {
+			slices.Sort(found[folder])
+			if !slices.Equal(found[folder], names) {
+				t.Fatalf("expected %v in %s, got %v", names, folder, found[folder])
+			}
+		}
+	})
+}
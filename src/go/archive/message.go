@@ -0,0 +1,203 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// Reader reads archived emails back as RFC 822 messages.
+type Reader struct {
+	app  core.App
+	fsys *filesystem.System
+}
+
+// NewReader opens the file storage of the app. The returned reader has to be closed.
+func NewReader(app core.App) (*Reader, error) {
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file storage: %w", err)
+	}
+
+	return &Reader{
+		app:  app,
+		fsys: fsys,
+	}, nil
+}
+
+// Close closes the underlying file storage.
+func (r *Reader) Close() error {
+	return r.fsys.Close()
+}
+
+// HasRaw reports whether the original message was stored for the email.
+func HasRaw(email *core.Record) bool {
+	return email.GetString("raw") != ""
+}
+
+// Open returns the RFC 822 message of the email. The stored raw message is
+// streamed when one exists, otherwise the message is rebuilt from the parsed
+// fields, which loses every header that was not archived.
+func (r *Reader) Open(email *core.Record) (io.ReadCloser, error) {
+	if HasRaw(email) {
+		file, err := r.fsys.GetFile(email.BaseFilesPath() + "/" + email.GetString("raw"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open raw message: %w", err)
+		}
+		return file, nil
+	}
+
+	message, err := r.compose(email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rebuild message: %w", err)
+	}
+
+	return io.NopCloser(bytes.NewReader(message)), nil
+}
+
+// ReadAll returns the complete RFC 822 message of the email.
+func (r *Reader) ReadAll(email *core.Record) ([]byte, error) {
+	message, err := r.Open(email)
+	if err != nil {
+		return nil, err
+	}
+	defer message.Close()
+
+	return io.ReadAll(message)
+}
+
+// Flags returns the stored flags of the email in their original order.
+func (r *Reader) Flags(email *core.Record) ([]string, error) {
+	flagRecords, err := r.app.FindRecordsByFilter(
+		"ib_email_flags",
+		"email = {:email}",
+		"index",
+		0,
+		0,
+		dbx.Params{"email": email.Id},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find email flags: %w", err)
+	}
+
+	flags := make([]string, len(flagRecords))
+	for i, flagRecord := range flagRecords {
+		flags[i] = flagRecord.GetString("flag")
+	}
+
+	return flags, nil
+}
+
+func (r *Reader) addresses(collection string, email *core.Record) ([]*core.Record, error) {
+	records, err := r.app.FindAllRecords(collection, dbx.HashExp{"email": email.Id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find '%s' of email: %w", collection, err)
+	}
+	return records, nil
+}
+
+func (r *Reader) compose(email *core.Record) ([]byte, error) {
+	date := email.GetDateTime("sent").Time()
+	if date.IsZero() {
+		date = email.GetDateTime("received").Time()
+	}
+
+	builder := enmime.Builder().
+		Subject(email.GetString("subject")).
+		Date(date)
+
+	if messageID := email.GetString("message_id"); messageID != "" {
+		builder = builder.Header("Message-ID", messageID)
+	}
+
+	from, err := r.addresses("ib_email_from_addresses", email)
+	if err != nil {
+		return nil, err
+	}
+	if len(from) > 0 {
+		builder = builder.From(from[0].GetString("display_name"), from[0].GetString("email_address"))
+	} else {
+		// enmime refuses to build a message without sender
+		builder = builder.From("", "unknown@unknown.invalid")
+	}
+
+	recipients := 0
+	for _, a := range []struct {
+		collection string
+		add        func(b enmime.MailBuilder, name, addr string) enmime.MailBuilder
+	}{
+		{"ib_email_to_addresses", enmime.MailBuilder.To},
+		{"ib_email_cc_addresses", enmime.MailBuilder.CC},
+		{"ib_email_bcc_addresses", enmime.MailBuilder.BCC},
+		{"ib_email_reply_to_addresses", enmime.MailBuilder.ReplyTo},
+	} {
+		records, err := r.addresses(a.collection, email)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			builder = a.add(builder, record.GetString("display_name"), record.GetString("email_address"))
+			if a.collection != "ib_email_reply_to_addresses" {
+				recipients++
+			}
+		}
+	}
+	if recipients == 0 {
+		// enmime refuses to build a message without recipients
+		builder = builder.To("undisclosed-recipients", "unknown@unknown.invalid")
+	}
+
+	if text := email.GetString("text"); text != "" {
+		builder = builder.Text([]byte(text))
+	}
+	if html := email.GetString("html"); html != "" {
+		builder = builder.HTML([]byte(html))
+	}
+
+	attachments, err := r.app.FindRecordsByFilter(
+		"ib_email_attachments",
+		"email = {:email}",
+		"index",
+		0,
+		0,
+		dbx.Params{"email": email.Id},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find email attachments: %w", err)
+	}
+
+	for _, attachment := range attachments {
+		content := []byte{}
+		if name := attachment.GetString("content"); name != "" {
+			file, err := r.fsys.GetFile(attachment.BaseFilesPath() + "/" + name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open attachment: %w", err)
+			}
+			content, err = io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read attachment: %w", err)
+			}
+		}
+
+		builder = builder.AddAttachment(content, attachment.GetString("mime_type"), attachment.GetString("name"))
+	}
+
+	root, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	message := &bytes.Buffer{}
+	if err := root.Encode(message); err != nil {
+		return nil, err
+	}
+
+	return message.Bytes(), nil
+}
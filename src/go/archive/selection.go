@@ -0,0 +1,343 @@
+package archive
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/search"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	pageSize = 50
+)
+
+// Selection describes a subset of the archived emails.
+// Every empty field matches all emails.
+type Selection struct {
+	// Owner limits the selection to accounts created by this user.
+	Owner string
+
+	Accounts []string
+	Folders  []string
+	Since    time.Time
+	Before   time.Time
+
+	// Filter is an additional PocketBase filter expression on 'ib_emails'.
+	Filter string
+
+	// RequestInfo is the request the selection was made in. Unless it belongs
+	// to a superuser, the filter can neither use hidden fields nor other
+	// collections.
+	RequestInfo *core.RequestInfo
+
+	// mailbox is the folder the selection was narrowed down to by In, when
+	// its emails are archived in other folders.
+	mailbox string
+}
+
+// ParseDate parses a date given either as "2006-01-02" or in RFC 3339 format.
+func ParseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339", value)
+	}
+
+	return t, nil
+}
+
+// filters returns the filter expressions of the selection. Every expression
+// gets built on its own, so a user supplied filter can never widen any of
+// the other conditions.
+func (s Selection) filters() ([]string, dbx.Params, error) {
+	filters := make([]string, 0)
+	params := dbx.Params{}
+
+	anyOf := func(field string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+
+		parts := make([]string, len(values))
+		for i, value := range values {
+			param := fmt.Sprintf("%s%d", field, i)
+			parts[i] = fmt.Sprintf("%s = {:%s}", field, param)
+			params[param] = value
+		}
+		filters = append(filters, strings.Join(parts, " || "))
+	}
+
+	if s.Owner != "" {
+		filters = append(filters, "smtp_account.created_by = {:owner}")
+		params["owner"] = s.Owner
+	}
+
+	anyOf("smtp_account", s.Accounts)
+	anyOf("folder", s.Folders)
+
+	for _, d := range []struct {
+		t      time.Time
+		filter string
+		param  string
+	}{
+		{s.Since, "received >= {:since}", "since"},
+		{s.Before, "received < {:before}", "before"},
+	} {
+		if d.t.IsZero() {
+			continue
+		}
+
+		dt, err := types.ParseDateTime(d.t)
+		if err != nil {
+			return nil, nil, err
+		}
+		filters = append(filters, d.filter)
+		params[d.param] = dt.String()
+	}
+
+	if strings.TrimSpace(s.Filter) != "" {
+		filters = append(filters, s.Filter)
+	}
+
+	return filters, params, nil
+}
+
+// query returns a query over the selected emails and the resolver used to
+// build it, which has to be applied to the query once it is complete.
+func (s Selection) query(app core.App) (*dbx.SelectQuery, *core.RecordFieldResolver, error) {
+	collection, err := app.FindCollectionByNameOrId("ib_emails")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filters, params, err := s.filters()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q := app.RecordQuery(collection)
+
+	trusted := s.RequestInfo == nil || s.RequestInfo.HasSuperuserAuth()
+	resolver := filterResolver{core.NewRecordFieldResolver(app, collection, s.RequestInfo, trusted)}
+
+	for _, filter := range filters {
+		expr, err := search.FilterData(filter).BuildExpr(resolver, params)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid filter expression: %w", err)
+		}
+		q.AndWhere(expr)
+	}
+
+	return q, resolver.RecordFieldResolver, nil
+}
+
+// filterResolver resolves the fields of a selection filter. The record field
+// resolver allows hidden fields behind @collection and @request fields, so
+// these are rejected whenever hidden fields are not allowed.
+type filterResolver struct {
+	*core.RecordFieldResolver
+}
+
+func (r filterResolver) Resolve(field string) (*search.ResolverResult, error) {
+	if !r.AllowHiddenFields() && strings.HasPrefix(field, "@") {
+		return nil, fmt.Errorf("%s fields are not allowed", strings.SplitN(field, ".", 2)[0])
+	}
+
+	return r.RecordFieldResolver.Resolve(field)
+}
+
+// Find returns a page of the selected emails, ordered by their received date.
+func (s Selection) Find(app core.App, limit int, offset int) ([]*core.Record, error) {
+	return s.find(app, nil, limit, offset)
+}
+
+// find returns a page of the selected emails that come after the given email
+// in the order of Find.
+func (s Selection) find(app core.App, after *core.Record, limit int, offset int) ([]*core.Record, error) {
+	q, resolver, err := s.query(app)
+	if err != nil {
+		return nil, err
+	}
+
+	if after != nil {
+		q.AndWhere(dbx.NewExp(
+			"([[emails.received]] > {:afterReceived} OR ([[emails.received]] = {:afterReceived} AND [[emails.id]] > {:afterId}))",
+			dbx.Params{"afterReceived": after.GetString("received"), "afterId": after.Id},
+		))
+	}
+
+	for _, sortField := range search.ParseSortFromString("received,id") {
+		expr, err := sortField.BuildExpr(resolver)
+		if err != nil {
+			return nil, err
+		}
+		if expr != "" {
+			q.AndOrderBy(expr)
+		}
+	}
+
+	resolver.UpdateQuery(q)
+
+	if offset > 0 {
+		q.Offset(int64(offset))
+	}
+
+	if limit > 0 {
+		q.Limit(int64(limit))
+	}
+
+	records := []*core.Record{}
+
+	if err := q.All(&records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Mailbox is a folder of an account.
+type Mailbox struct {
+	Account string `db:"smtp_account"`
+	Folder  string `db:"folder"`
+
+	// sources are the folders the emails of the mailbox are archived in
+	sources []string
+}
+
+// Mailboxes returns every account folder that contains selected emails. The
+// emails of Gmail accounts are in the folders of their labels, see
+// GmailFolders.
+func (s Selection) Mailboxes(app core.App) ([]Mailbox, error) {
+	q, resolver, err := s.query(app)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver.UpdateQuery(q)
+
+	archived := []Mailbox{}
+
+	err = q.Select("[[emails.smtp_account]]", "[[emails.folder]]").
+		Distinct(true).
+		OrderBy("[[emails.smtp_account]]", "[[emails.folder]]").
+		All(&archived)
+	if err != nil {
+		return nil, err
+	}
+
+	gmail := NewGmailFolders(app)
+	mailboxes := []Mailbox{}
+
+	add := func(account string, folder string, source string) {
+		i := slices.IndexFunc(mailboxes, func(m Mailbox) bool {
+			return m.Account == account && m.Folder == folder
+		})
+		if i == -1 {
+			mailboxes = append(mailboxes, Mailbox{Account: account, Folder: folder})
+			i = len(mailboxes) - 1
+		}
+		if !slices.Contains(mailboxes[i].sources, source) {
+			mailboxes[i].sources = append(mailboxes[i].sources, source)
+		}
+	}
+
+	for _, mailbox := range archived {
+		allMail, err := gmail.allMail(mailbox.Account)
+		if err != nil {
+			return nil, err
+		}
+		if mailbox.Folder != allMail {
+			add(mailbox.Account, mailbox.Folder, mailbox.Folder)
+			continue
+		}
+
+		err = s.In(mailbox).Each(app, func(email *core.Record) error {
+			folders, err := gmail.Of(email)
+			if err != nil {
+				return err
+			}
+			for _, folder := range folders {
+				add(mailbox.Account, folder, mailbox.Folder)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slices.SortFunc(mailboxes, func(a, b Mailbox) int {
+		return cmp.Or(cmp.Compare(a.Account, b.Account), cmp.Compare(a.Folder, b.Folder))
+	})
+
+	return mailboxes, nil
+}
+
+// In returns a copy of the selection that is narrowed down to the mailbox.
+func (s Selection) In(mailbox Mailbox) Selection {
+	s.Accounts = []string{mailbox.Account}
+	s.Folders = []string{mailbox.Folder}
+	s.mailbox = ""
+
+	if len(mailbox.sources) > 0 {
+		s.Folders = mailbox.sources
+		s.mailbox = mailbox.Folder
+	}
+
+	return s
+}
+
+// Each calls fn for every selected email, loading only one page of emails
+// into memory at a time. Every page continues after the last email of the
+// previous one, so emails that fn deletes or moves can't shift the pages.
+func (s Selection) Each(app core.App, fn func(email *core.Record) error) error {
+	if s.mailbox != "" {
+		fn = s.inMailbox(app, fn)
+	}
+
+	var last *core.Record
+
+	for {
+		records, err := s.find(app, last, pageSize, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+
+		if len(records) < pageSize {
+			return nil
+		}
+		last = records[len(records)-1]
+	}
+}
+
+// inMailbox wraps fn, so that it is only called for the emails that are shown
+// in the mailbox the selection was narrowed down to.
+func (s Selection) inMailbox(app core.App, fn func(email *core.Record) error) func(email *core.Record) error {
+	gmail := NewGmailFolders(app)
+
+	return func(email *core.Record) error {
+		folders, err := gmail.Of(email)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(folders, s.mailbox) {
+			return nil
+		}
+		return fn(email)
+	}
+}
@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	_ "github.com/yerTools/imapbackup/src/go/database/migrations"
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestSelectionFilter(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	owner := testutil.Owner(t, app)
+	account := testutil.CreateAccount(t, app, map[string]any{"password": "secret"})
+
+	email := core.NewRecord(testutil.Collection(t, app, "ib_emails"))
+	email.Set("smtp_account", account.Id)
+	email.Set("folder", "INBOX")
+	email.Set("subject", "hello")
+	if err := app.Save(email); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &core.RequestInfo{Auth: owner}
+
+	scenarios := []struct {
+		name        string
+		requestInfo *core.RequestInfo
+		filter      string
+		found       int
+		err         string
+	}{
+		{"no filter", user, "", 1, ""},
+		{"visible field", user, "subject = 'hello'", 1, ""},
+		{"hidden relation field", user, "smtp_account.password = 'secret'", 0, "invalid filter"},
+		{"other collection", user, "@collection.ib_smtp_accounts.password = 'secret'", 0, "@collection"},
+		{"request field", user, "@request.auth.id != ''", 0, "@request"},
+		{"hidden field without request", nil, "smtp_account.password = 'secret'", 1, ""},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			selection := Selection{
+				Owner:       owner.Id,
+				Filter:      s.filter,
+				RequestInfo: s.requestInfo,
+			}
+
+			records, err := selection.Find(app, 0, 0)
+			if s.err != "" {
+				if err == nil || !strings.Contains(err.Error(), s.err) {
+					t.Fatalf("expected error containing %q, got %v", s.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != s.found {
+				t.Fatalf("expected %d email(s), got %d", s.found, len(records))
+			}
+		})
+	}
+}
+
+func TestSelectionEach(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	account := testutil.CreateAccount(t, app, nil)
+
+	// more than two pages, most of them received at the same time
+	total := 2*pageSize + 10
+	for i := 0; i < total; i++ {
+		email := core.NewRecord(testutil.Collection(t, app, "ib_emails"))
+		email.Set("smtp_account", account.Id)
+		email.Set("folder", "INBOX")
+		email.Set("received", "2024-01-01 00:00:00.000Z")
+		if i%7 == 0 {
+			email.Set("received", "2023-01-01 00:00:00.000Z")
+		}
+		if err := app.Save(email); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := map[string]bool{}
+	err = Selection{}.Each(app, func(email *core.Record) error {
+		if seen[email.Id] {
+			t.Fatalf("email %s was visited twice", email.Id)
+		}
+		seen[email.Id] = true
+
+		// deleting the visited emails must not skip any of the others
+		return app.Delete(email)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != total {
+		t.Fatalf("expected %d emails, got %d", total, len(seen))
+	}
+}
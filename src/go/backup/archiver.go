@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+)
+
+// Archiver stores emails that do not come from a sync, like imported ones,
+// exactly the way a sync would store them.
+type Archiver struct {
+	app  core.App
+	cols *collections
+
+	// folders caches the 'ib_folders' records by account and folder name.
+	folders map[[2]string]*core.Record
+}
+
+// NewArchiver looks up the collections the emails are stored in.
+func NewArchiver(app core.App) (*Archiver, error) {
+	cols, err := findCollections(app)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Archiver{
+		app:     app,
+		cols:    cols,
+		folders: make(map[[2]string]*core.Record),
+	}, nil
+}
+
+// FindDuplicates returns the archived emails of the account that hold the
+// same message as the email. A message that is not synced carries a received
+// date of its own, so it is compared by its Message-ID and the hash of its raw
+// message. Emails archived without their raw message are compared like the
+// sync compares them.
+func (a *Archiver) FindDuplicates(smtpAccount *core.Record, email *imapclient.Email) ([]*core.Record, error) {
+	raw_sha256 := sha256.Sum256(email.Raw)
+
+	duplicates, err := a.app.FindAllRecords(a.cols.ib_emails, dbx.HashExp{
+		"smtp_account": smtpAccount.Id,
+		"message_id":   email.MessageID,
+		"raw_sha256":   hex.EncodeToString(raw_sha256[:]),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find existing mails: %w", err)
+	}
+	if len(duplicates) > 0 {
+		return duplicates, nil
+	}
+
+	return findDuplicates(a.app, smtpAccount, email.Email)
+}
+
+// Save stores the email together with its flags, addresses and attachments
+// in a single transaction.
+func (a *Archiver) Save(smtpAccount *core.Record, folder string, email *imapclient.Email) error {
+	folderRecord, err := a.Folder(smtpAccount, folder, "")
+	if err != nil {
+		return err
+	}
+
+	return a.app.RunInTransaction(func(txApp core.App) error {
+		_, err := saveEmail(txApp, a.cols, smtpAccount, folder, folderRecord.Id, email, nil)
+		return err
+	})
+}
+
+// Folder returns the 'ib_folders' record of the folder. A folder that has no
+// record yet, like the ones of an import, gets one and so does each missing
+// parent. The delimiter separates the levels of the name, it is empty if the
+// name has no hierarchy, and only matters for folders that are created.
+func (a *Archiver) Folder(smtpAccount *core.Record, name string, delimiter string) (*core.Record, error) {
+	key := [2]string{smtpAccount.Id, name}
+	if folderRecord, ok := a.folders[key]; ok {
+		return folderRecord, nil
+	}
+
+	folderRecord, err := a.app.FindFirstRecordByFilter(
+		a.cols.ib_folders,
+		"smtp_account = {:smtp_account_id} && name = {:name}",
+		dbx.Params{
+			"smtp_account_id": smtpAccount.Id,
+			"name":            name,
+		},
+	)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to find folder %s: %w", name, err)
+		}
+
+		folderRecord = core.NewRecord(a.cols.ib_folders)
+		folderRecord.Set("smtp_account", smtpAccount.Id)
+		folderRecord.Set("name", name)
+		folderRecord.Set("display_name", name)
+		folderRecord.Set("delimiter", delimiter)
+		folderRecord.Set("selectable", true)
+
+		if i := strings.LastIndex(name, delimiter); delimiter != "" && i > 0 {
+			parentRecord, err := a.Folder(smtpAccount, name[:i], delimiter)
+			if err != nil {
+				return nil, err
+			}
+			folderRecord.Set("display_name", name[i+len(delimiter):])
+			folderRecord.Set("parent", parentRecord.Id)
+		}
+
+		if err := a.app.Save(folderRecord); err != nil {
+			return nil, fmt.Errorf("failed to save folder %s: %w", name, err)
+		}
+	}
+
+	a.folders[key] = folderRecord
+	return folderRecord, nil
+}
@@ -0,0 +1,129 @@
+package backup
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// DeletionPolicyKeep keeps emails that were deleted on the server forever.
+	DeletionPolicyKeep = "keep"
+	// DeletionPolicyPurge deletes emails after they were gone from the server
+	// for the configured number of days.
+	DeletionPolicyPurge = "purge"
+	// DeletionPolicyMirror deletes emails as soon as they are gone from the server.
+	DeletionPolicyMirror = "mirror"
+)
+
+func (s *accountSync) markDeletedByIds(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	now := types.NowDateTime()
+
+	for i := 0; i < len(ids); i += syncBatchSize {
+		batchSliceEnd := i + syncBatchSize
+		if batchSliceEnd > len(ids) {
+			batchSliceEnd = len(ids)
+		}
+
+		emailRecords, err := s.app.FindRecordsByIds(s.cols.ib_emails, ids[i:batchSliceEnd])
+		if err != nil {
+			return fmt.Errorf("failed to find deleted emails: %w", err)
+		}
+
+		err = s.app.RunInTransaction(func(txApp core.App) error {
+			for _, emailRecord := range emailRecords {
+				emailRecord.Set("deleted_on_server", now)
+				if err := txApp.Save(emailRecord); err != nil {
+					return fmt.Errorf("failed to mark email as deleted: %w", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("marked %d email(s) as deleted on the server\n", len(ids))
+
+	return nil
+}
+
+// deletionCutoff returns the time emails have to be deleted on the server at
+// or before to be purged, false if the account keeps them.
+func deletionCutoff(smtpAccount *core.Record, now time.Time) (time.Time, bool) {
+	switch smtpAccount.GetString("deletion_policy") {
+	case DeletionPolicyMirror:
+		return now, true
+	case DeletionPolicyPurge:
+		return now.AddDate(0, 0, -smtpAccount.GetInt("purge_after_days")), true
+	}
+
+	return time.Time{}, false
+}
+
+// applyDeletionPolicy removes the emails that were deleted on the server
+// according to the deletion policy of the account.
+func (s *accountSync) applyDeletionPolicy() error {
+	cutoff, ok := deletionCutoff(s.smtpAccount, time.Now())
+	if !ok {
+		return nil
+	}
+
+	cutoffDateTime, err := types.ParseDateTime(cutoff)
+	if err != nil {
+		return err
+	}
+
+	purged := 0
+	for {
+		emailRecords, err := s.app.FindRecordsByFilter(
+			s.cols.ib_emails,
+			`smtp_account = {:smtp_account_id} &&
+			deleted_on_server != "" &&
+			deleted_on_server <= {:cutoff}`,
+			"",
+			syncBatchSize,
+			0,
+			dbx.Params{
+				"smtp_account_id": s.smtpAccount.Id,
+				"cutoff":          cutoffDateTime.String(),
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to find emails to purge: %w", err)
+		}
+
+		if len(emailRecords) == 0 {
+			break
+		}
+
+		err = s.app.RunInTransaction(func(txApp core.App) error {
+			for _, emailRecord := range emailRecords {
+				if err := txApp.Delete(emailRecord); err != nil {
+					return fmt.Errorf("failed to purge email: %w", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		purged += len(emailRecords)
+	}
+
+	if purged > 0 {
+		log.Printf("purged %d email(s) that were deleted on the server\n", purged)
+	}
+
+	return nil
+}
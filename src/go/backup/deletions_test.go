@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestDeletionCutoff(t *testing.T) {
+	now := time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)
+
+	scenarios := []struct {
+		policy   string
+		days     int
+		expected time.Time
+		ok       bool
+	}{
+		{"", 0, time.Time{}, false},
+		{DeletionPolicyKeep, 30, time.Time{}, false},
+		{DeletionPolicyMirror, 30, now, true},
+		{DeletionPolicyPurge, 30, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), true},
+		{DeletionPolicyPurge, 0, now, true},
+	}
+
+	collection := core.NewBaseCollection("ib_smtp_accounts")
+
+	for _, s := range scenarios {
+		t.Run(s.policy, func(t *testing.T) {
+			account := core.NewRecord(collection)
+			account.Set("deletion_policy", s.policy)
+			account.Set("purge_after_days", s.days)
+
+			cutoff, ok := deletionCutoff(account, now)
+			if ok != s.ok || !cutoff.Equal(s.expected) {
+				t.Fatalf("expected %v %v, got %v %v", s.expected, s.ok, cutoff, ok)
+			}
+		})
+	}
+}
+
+func TestApplyDeletionPolicy(t *testing.T) {
+	scenarios := []struct {
+		policy   string
+		days     int
+		expected []string
+	}{
+		{DeletionPolicyKeep, 0, []string{"kept", "recent", "old"}},
+		{DeletionPolicyPurge, 30, []string{"kept", "recent"}},
+		{DeletionPolicyMirror, 0, []string{"kept"}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.policy, func(t *testing.T) {
+			app, err := tests.NewTestApp()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer app.Cleanup()
+
+			cols, err := findCollections(app)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			account := testutil.CreateAccount(t, app, nil)
+			account.Set("deletion_policy", s.policy)
+			account.Set("purge_after_days", s.days)
+			if err := app.Save(account); err != nil {
+				t.Fatal(err)
+			}
+
+			// the other account keeps its deleted emails
+			other := testutil.CreateAccount(t, app, nil)
+
+			ids := map[string]string{}
+			for _, email := range []struct {
+				account *core.Record
+				name    string
+				deleted time.Time
+			}{
+				{account, "kept", time.Time{}},
+				{account, "recent", time.Now().AddDate(0, 0, -1)},
+				{account, "old", time.Now().AddDate(0, 0, -60)},
+				{other, "other", time.Now().AddDate(0, 0, -60)},
+			} {
+				record := core.NewRecord(cols.ib_emails)
+				record.Set("smtp_account", email.account.Id)
+				record.Set("folder", "INBOX")
+				record.Set("subject", email.name)
+				if !email.deleted.IsZero() {
+					record.Set("deleted_on_server", email.deleted)
+				}
+				if err := app.Save(record); err != nil {
+					t.Fatal(err)
+				}
+				ids[record.Id] = email.name
+			}
+
+			as := &accountSync{app: app, cols: cols, smtpAccount: account}
+			if err := as.applyDeletionPolicy(); err != nil {
+				t.Fatal(err)
+			}
+
+			remaining, err := app.FindAllRecords(cols.ib_emails)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := []string{}
+			for _, record := range remaining {
+				if name := ids[record.Id]; name != "other" {
+					names = append(names, name)
+				}
+			}
+			slices.Sort(names)
+
+			expected := slices.Sorted(slices.Values(s.expected))
+			if !slices.Equal(names, expected) {
+				t.Fatalf("expected %v to remain, got %v", expected, names)
+			}
+			if len(remaining) != len(names)+1 {
+				t.Fatal("expected the email of the other account to remain")
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// maxSyncAttempts is how often a message is tried before it is marked as
+	// permanently failed and no longer retried.
+	maxSyncAttempts = 5
+)
+
+// failureQueue holds the messages of a folder that failed to sync in previous
+// runs. They are retried on every run until they either succeed or reach
+// maxSyncAttempts.
+type failureQueue struct {
+	s           *accountSync
+	folder      string
+	uidValidity uint32
+
+	// records maps the UID of every queued message to its 'ib_sync_failures' record.
+	records map[int]*core.Record
+}
+
+// loadFailures returns the retry queue of the folder. Entries of a previous
+// UIDVALIDITY are dropped, because their UIDs no longer mean anything.
+func (s *accountSync) loadFailures(folder string, uidValidity uint32) (*failureQueue, error) {
+	records, err := s.app.FindAllRecords(s.cols.ib_sync_failures, dbx.HashExp{
+		"smtp_account": s.smtpAccount.Id,
+		"folder":       folder,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find failed emails: %w", err)
+	}
+
+	q := &failureQueue{
+		s:           s,
+		folder:      folder,
+		uidValidity: uidValidity,
+		records:     make(map[int]*core.Record, len(records)),
+	}
+
+	for _, record := range records {
+		if record.GetInt("uid_validity") != int(uidValidity) {
+			if err := s.app.Delete(record); err != nil {
+				return nil, fmt.Errorf("failed to delete outdated failed email: %w", err)
+			}
+			continue
+		}
+		q.records[record.GetInt("uid")] = record
+	}
+
+	return q, nil
+}
+
+// retryUIDs returns the queued UIDs that should be synced again. Messages that
+// are gone from the server are removed from the queue.
+func (q *failureQueue) retryUIDs(serverUIDs []int) ([]int, error) {
+	existing := make(map[int]bool, len(serverUIDs))
+	for _, uid := range serverUIDs {
+		existing[uid] = true
+	}
+
+	uids := make([]int, 0, len(q.records))
+	for uid, record := range q.records {
+		if !existing[uid] {
+			if err := q.s.app.Delete(record); err != nil {
+				return nil, fmt.Errorf("failed to delete failed email: %w", err)
+			}
+			delete(q.records, uid)
+			continue
+		}
+
+		if !record.GetBool("permanent") {
+			uids = append(uids, uid)
+		}
+	}
+
+	return uids, nil
+}
+
+// update stores the outcome of the attempted UIDs: failed messages are queued
+// or get their attempt counted, messages that succeeded leave the queue.
+func (q *failureQueue) update(attempted []int, failed map[int]error) error {
+	for _, uid := range attempted {
+		record, queued := q.records[uid]
+
+		syncErr, ok := failed[uid]
+		if !ok {
+			if queued {
+				if err := q.s.app.Delete(record); err != nil {
+					return fmt.Errorf("failed to delete failed email: %w", err)
+				}
+				delete(q.records, uid)
+			}
+			continue
+		}
+
+		if !queued {
+			record = core.NewRecord(q.s.cols.ib_sync_failures)
+			record.Set("smtp_account", q.s.smtpAccount.Id)
+			record.Set("folder", q.folder)
+			record.Set("uid_validity", q.uidValidity)
+			record.Set("uid", uid)
+			q.records[uid] = record
+		}
+
+		attempts := record.GetInt("attempts") + 1
+		record.Set("attempts", attempts)
+		record.Set("error", syncErr.Error())
+		if attempts >= maxSyncAttempts {
+			record.Set("permanent", true)
+			log.Printf("giving up on email with UID %d in folder %s after %d attempts: %v\n", uid, q.folder, attempts, syncErr)
+		}
+
+		if err := q.s.app.Save(record); err != nil {
+			return fmt.Errorf("failed to save failed email: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestFailureQueue(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	cols, err := findCollections(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &accountSync{app: app, cols: cols, smtpAccount: testutil.CreateAccount(t, app, nil)}
+
+	// every step is a run of the folder: the retried UIDs are checked, then
+	// the new and the retried UIDs are attempted and the failed ones queued
+	scenarios := []struct {
+		name        string
+		uidValidity uint32
+		serverUIDs  []int
+		newUIDs     []int
+		failed      []int
+
+		expectedRetry []int
+		// expectedQueue holds the attempts of the queued UIDs, negative for
+		// the permanent failures
+		expectedQueue map[int]int
+	}{
+		{"first failures", 1, []int{1, 2, 3}, []int{1, 2, 3}, []int{2, 3}, []int{}, map[int]int{2: 1, 3: 1}},
+		{"retried", 1, []int{1, 2, 3}, nil, []int{2}, []int{2, 3}, map[int]int{2: 2}},
+		{"third attempt", 1, []int{1, 2, 3, 4}, []int{4}, []int{2}, []int{2}, map[int]int{2: 3}},
+		{"fourth attempt", 1, []int{1, 2, 3, 4}, nil, []int{2}, []int{2}, map[int]int{2: 4}},
+		{"given up", 1, []int{1, 2, 3, 4}, nil, []int{2}, []int{2}, map[int]int{2: -maxSyncAttempts}},
+		{"not retried anymore", 1, []int{1, 2, 3, 4, 5}, []int{5}, []int{5}, []int{}, map[int]int{2: -maxSyncAttempts, 5: 1}},
+		{"gone from the server", 1, []int{1, 3, 4, 5}, nil, nil, []int{5}, map[int]int{}},
+		{"UIDVALIDITY changed", 2, []int{1}, []int{1}, []int{1}, []int{}, map[int]int{1: 1}},
+		{"dropped after UIDVALIDITY change", 3, []int{1}, []int{1}, nil, []int{}, map[int]int{}},
+	}
+
+	for _, step := range scenarios {
+		t.Run(step.name, func(t *testing.T) {
+			q, err := s.loadFailures("INBOX", step.uidValidity)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			retry, err := q.retryUIDs(step.serverUIDs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(retry)
+			if !slices.Equal(retry, step.expectedRetry) {
+				t.Fatalf("expected the retried UIDs %v, got %v", step.expectedRetry, retry)
+			}
+
+			failed := make(map[int]error, len(step.failed))
+			for _, uid := range step.failed {
+				failed[uid] = errors.New("broken")
+			}
+			if err := q.update(append(step.newUIDs, retry...), failed); err != nil {
+				t.Fatal(err)
+			}
+
+			records, err := app.FindAllRecords(cols.ib_sync_failures, dbx.HashExp{"smtp_account": s.smtpAccount.Id})
+			if err != nil {
+				t.Fatal(err)
+			}
+			queue := make(map[int]int, len(records))
+			for _, record := range records {
+				attempts := record.GetInt("attempts")
+				if record.GetBool("permanent") {
+					attempts = -attempts
+				}
+				queue[record.GetInt("uid")] = attempts
+			}
+			if !maps.Equal(queue, step.expectedQueue) {
+				t.Fatalf("expected the queue %v, got %v", step.expectedQueue, queue)
+			}
+		})
+	}
+}
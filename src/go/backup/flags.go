@@ -0,0 +1,191 @@
+package backup
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+)
+
+// syncFlags compares the flags of the messages up to lastUID with the ones
+// archived for them and stores every difference. The archived emails are
+// looked up through their locations in the folder, so every email stored for
+// a UID gets updated. If changedSince is greater than zero, only the messages
+// changed since that modification sequence are compared. The labels of Gmail
+// messages are synced along. It returns the number of updated emails.
+func (s *accountSync) syncFlags(folder string, uidValidity uint32, lastUID int, changedSince uint64) (int, error) {
+	messages, err := s.im.FetchFlags(fmt.Sprintf("1:%d", lastUID), changedSince)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch flags: %w", err)
+	}
+
+	updated := 0
+
+	for i := 0; i < len(messages); i += syncBatchSize {
+		batchSliceEnd := i + syncBatchSize
+		if batchSliceEnd > len(messages) {
+			batchSliceEnd = len(messages)
+		}
+		messagesBatch := messages[i:batchSliceEnd]
+
+		uids := make([]any, len(messagesBatch))
+		gmailUIDs := make([]int, len(messagesBatch))
+		for i, message := range messagesBatch {
+			uids[i] = message.UID
+			gmailUIDs[i] = message.UID
+		}
+
+		// Gmail counts label changes as modifications, so the labels of
+		// every changed message are fetched along
+		gmailMessages := make(map[int]*imapclient.GmailMessage)
+		if s.im.IsGmail() {
+			gmailMessages, err = s.im.FetchGmail(gmailUIDs...)
+			if err != nil {
+				return 0, fmt.Errorf("failed to fetch Gmail attributes: %w", err)
+			}
+		}
+
+		locations, err := s.app.FindAllRecords(s.cols.ib_email_locations, dbx.HashExp{
+			"smtp_account": s.smtpAccount.Id,
+			"folder":       folder,
+			"uid_validity": uidValidity,
+			"uid":          uids,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to find email locations: %w", err)
+		}
+
+		emailIds := make([]string, len(locations))
+		for i, location := range locations {
+			emailIds[i] = location.GetString("email")
+		}
+
+		emailRecords, err := s.app.FindRecordsByIds(s.cols.ib_emails, emailIds)
+		if err != nil {
+			return 0, fmt.Errorf("failed to find emails: %w", err)
+		}
+
+		emailRecordsById := make(map[string]*core.Record, len(emailRecords))
+		for _, emailRecord := range emailRecords {
+			emailRecordsById[emailRecord.Id] = emailRecord
+		}
+
+		// copies archived as separate emails share the same UID
+		emailRecordsByUID := make(map[int][]*core.Record, len(locations))
+		for _, location := range locations {
+			if emailRecord, ok := emailRecordsById[location.GetString("email")]; ok {
+				emailRecordsByUID[location.GetInt("uid")] = append(emailRecordsByUID[location.GetInt("uid")], emailRecord)
+			}
+		}
+
+		for _, message := range messagesBatch {
+			for _, emailRecord := range emailRecordsByUID[message.UID] {
+				changed, err := s.updateFlags(emailRecord, message.Flags)
+				if err != nil {
+					return 0, fmt.Errorf("failed to update flags: %w", err)
+				}
+				if gmailMessage, ok := gmailMessages[message.UID]; ok {
+					labelsChanged, err := s.updateGmail(emailRecord, gmailMessage)
+					if err != nil {
+						return 0, err
+					}
+					changed = changed || labelsChanged
+				}
+				if changed {
+					updated++
+				}
+			}
+		}
+	}
+
+	if updated > 0 {
+		log.Printf("updated flags of %d email(s)\n", updated)
+	}
+
+	return updated, nil
+}
+
+// updateFlags replaces the stored flags of the email with the given ones,
+// touching only the rows that actually differ. It reports whether anything
+// was changed.
+func (s *accountSync) updateFlags(emailRecord *core.Record, flags []string) (bool, error) {
+	return s.updateValues(s.cols.ib_email_flags, "flag", emailRecord, flags)
+}
+
+// updateLabels replaces the stored Gmail labels of the email with the given
+// ones, just like updateFlags.
+func (s *accountSync) updateLabels(emailRecord *core.Record, labels []string) (bool, error) {
+	return s.updateValues(s.cols.ib_email_labels, "label", emailRecord, labels)
+}
+
+// updateValues replaces the indexed values of the email that are stored in
+// the field of the collection.
+func (s *accountSync) updateValues(collection *core.Collection, field string, emailRecord *core.Record, values []string) (bool, error) {
+	valueRecords, err := s.app.FindAllRecords(collection, dbx.HashExp{"email": emailRecord.Id})
+	if err != nil {
+		return false, err
+	}
+
+	serverValues := make(map[string]bool, len(values))
+	for _, value := range values {
+		serverValues[value] = true
+	}
+
+	storedValues := make(map[string]bool, len(valueRecords))
+	removed := make([]*core.Record, 0)
+	nextIndex := 0
+	for _, valueRecord := range valueRecords {
+		value := valueRecord.GetString(field)
+		if !serverValues[value] || storedValues[value] {
+			removed = append(removed, valueRecord)
+			continue
+		}
+		storedValues[value] = true
+
+		if index := valueRecord.GetInt("index"); index >= nextIndex {
+			nextIndex = index + 1
+		}
+	}
+
+	added := make([]string, 0)
+	for _, value := range values {
+		if !storedValues[value] {
+			added = append(added, value)
+			storedValues[value] = true
+		}
+	}
+
+	if len(removed) == 0 && len(added) == 0 {
+		return false, nil
+	}
+
+	err = s.app.RunInTransaction(func(txApp core.App) error {
+		for _, valueRecord := range removed {
+			if err := txApp.Delete(valueRecord); err != nil {
+				return fmt.Errorf("failed to delete email %s: %w", field, err)
+			}
+		}
+
+		for _, value := range added {
+			email_value := core.NewRecord(collection)
+			email_value.Set("email", emailRecord.Id)
+			email_value.Set("index", nextIndex)
+			email_value.Set(field, value)
+			nextIndex++
+
+			if err := txApp.Save(email_value); err != nil {
+				return fmt.Errorf("failed to save email %s: %w", field, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,191 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/connect"
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+)
+
+// skippedSpecialUse are the RFC 6154 attributes of the folders that are
+// skipped if the account asks for it. Junk and trash are not worth a backup,
+// and the All folder of some providers only repeats every other folder.
+var skippedSpecialUse = []string{`\Junk`, `\Trash`, `\All`}
+
+// FolderRules decide which folders of an account are synced.
+type FolderRules struct {
+	// Include lists the patterns of the synced folders, every folder is
+	// synced if it is empty.
+	Include []*regexp.Regexp
+
+	// Exclude lists the patterns of folders that are never synced, even if
+	// they are included.
+	Exclude []*regexp.Regexp
+
+	// SkipSpecialUse skips the folders with one of skippedSpecialUse.
+	SkipSpecialUse bool
+}
+
+// CompilePattern compiles a folder pattern. Patterns enclosed in slashes are
+// regular expressions, everything else is a glob that has to match the whole
+// folder name, where * matches any text including the hierarchy delimiter and
+// ? matches a single character.
+func CompilePattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return regexp.Compile(pattern[1 : len(pattern)-1])
+	}
+
+	expr := strings.Builder{}
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.Compile(expr.String())
+}
+
+func compilePatterns(smtpAccount *core.Record, field string) ([]*regexp.Regexp, error) {
+	patterns := []string{}
+	if raw := smtpAccount.GetString(field); raw != "" && raw != "null" {
+		if err := smtpAccount.UnmarshalJSONField(field, &patterns); err != nil {
+			return nil, errors.New("must be a list of patterns")
+		}
+	}
+
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		regex, err := CompilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		compiled[i] = regex
+	}
+
+	return compiled, nil
+}
+
+// AccountFolderRules returns the folder rules of the 'ib_smtp_accounts' record.
+func AccountFolderRules(smtpAccount *core.Record) (*FolderRules, error) {
+	include, err := compilePatterns(smtpAccount, "folder_include")
+	if err != nil {
+		return nil, fmt.Errorf("folder_include: %w", err)
+	}
+
+	exclude, err := compilePatterns(smtpAccount, "folder_exclude")
+	if err != nil {
+		return nil, fmt.Errorf("folder_exclude: %w", err)
+	}
+
+	return &FolderRules{
+		Include:        include,
+		Exclude:        exclude,
+		SkipSpecialUse: smtpAccount.GetBool("skip_special_use"),
+	}, nil
+}
+
+// Skip returns why the folder is not synced, or an empty string if it is.
+func (r *FolderRules) Skip(mailbox *imapclient.Mailbox) string {
+	if !mailbox.Selectable() {
+		return "folder can not be selected"
+	}
+
+	if r.SkipSpecialUse {
+		for _, attribute := range skippedSpecialUse {
+			if mailbox.HasAttribute(attribute) {
+				return fmt.Sprintf("special-use folder %s", attribute)
+			}
+		}
+	}
+
+	if len(r.Include) > 0 {
+		included := false
+		for _, include := range r.Include {
+			if include.MatchString(mailbox.Name) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return "not included"
+		}
+	}
+
+	for _, exclude := range r.Exclude {
+		if exclude.MatchString(mailbox.Name) {
+			return fmt.Sprintf("excluded by %q", exclude.String())
+		}
+	}
+
+	return ""
+}
+
+// FolderChoice tells whether a folder of the server would be synced.
+type FolderChoice struct {
+	Name       string   `json:"name"`
+	Attributes []string `json:"attributes"`
+	Sync       bool     `json:"sync"`
+	Reason     string   `json:"reason,omitempty"`
+}
+
+// chooseFolders applies the rules to every folder of the server. A Gmail
+// account is synced through its All Mail folder, whatever the rules say, and
+// only the folders that All Mail leaves out are up to the rules.
+func chooseFolders(mailboxes []imapclient.Mailbox, rules *FolderRules, allMail string) []FolderChoice {
+	choices := make([]FolderChoice, len(mailboxes))
+	for i := range mailboxes {
+		reason := rules.Skip(&mailboxes[i])
+		switch {
+		case allMail == "":
+		case mailboxes[i].Name == allMail:
+			reason = ""
+		case isOutsideAllMail(&mailboxes[i]):
+			// Spam and Trash are synced like on any other server
+		case mailboxes[i].Selectable():
+			reason = fmt.Sprintf("Gmail account is synced through %s", allMail)
+		}
+
+		choices[i] = FolderChoice{
+			Name:       mailboxes[i].Name,
+			Attributes: mailboxes[i].Attributes,
+			Sync:       reason == "",
+			Reason:     reason,
+		}
+	}
+	return choices
+}
+
+// PlanFolders lists the folders of the server and tells for each one whether
+// a sync would back it up, without syncing anything.
+func PlanFolders(ctx context.Context, app core.App, smtpAccount *core.Record) ([]FolderChoice, error) {
+	rules, err := AccountFolderRules(smtpAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := connect.Account(ctx, app, smtpAccount)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	mailboxes, err := c.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+
+	return chooseFolders(mailboxes, rules, allMailFolder(c, mailboxes)), nil
+}
@@ -0,0 +1,280 @@
+package backup
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+)
+
+func TestCompilePattern(t *testing.T) {
+	scenarios := []struct {
+		pattern    string
+		matches    []string
+		notMatches []string
+		err        bool
+	}{
+		{
+			pattern:    "INBOX",
+			matches:    []string{"INBOX"},
+			notMatches: []string{"INBOX/Sub", "My INBOX", "inbox"},
+		},
+		{
+			pattern:    "Archive/*",
+			matches:    []string{"Archive/2024", "Archive/2024/Q1", "Archive/"},
+			notMatches: []string{"Archive", "Old/Archive/2024"},
+		},
+		{
+			pattern:    "*",
+			matches:    []string{"", "INBOX", "a/b/c"},
+			notMatches: []string{},
+		},
+		{
+			pattern:    "Project?",
+			matches:    []string{"ProjectA", "Project1"},
+			notMatches: []string{"Project", "ProjectAB"},
+		},
+		{
+			pattern:    "Sent (old).[1]+",
+			matches:    []string{"Sent (old).[1]+"},
+			notMatches: []string{"Sent old.1", "Sent (old)x[1]+"},
+		},
+		{
+			pattern:    "/^(?i)spam|junk$/",
+			matches:    []string{"Spam", "JUNK", "Spam/Sub"},
+			notMatches: []string{"Ham"},
+		},
+		{
+			pattern:    "/",
+			matches:    []string{"/"},
+			notMatches: []string{"a"},
+		},
+		{
+			pattern: "/(/",
+			err:     true,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.pattern, func(t *testing.T) {
+			regex, err := CompilePattern(s.pattern)
+			if s.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", regex)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, name := range s.matches {
+				if !regex.MatchString(name) {
+					t.Errorf("expected %q to match %q", s.pattern, name)
+				}
+			}
+			for _, name := range s.notMatches {
+				if regex.MatchString(name) {
+					t.Errorf("expected %q not to match %q", s.pattern, name)
+				}
+			}
+		})
+	}
+}
+
+func TestFolderRulesSkip(t *testing.T) {
+	compile := func(patterns ...string) []*regexp.Regexp {
+		compiled := make([]*regexp.Regexp, len(patterns))
+		for i, pattern := range patterns {
+			compiled[i] = regexp.MustCompile(pattern)
+		}
+		return compiled
+	}
+
+	scenarios := []struct {
+		name     string
+		rules    FolderRules
+		mailbox  imapclient.Mailbox
+		expected string
+	}{
+		{
+			name:     "no rules",
+			mailbox:  imapclient.Mailbox{Name: "INBOX"},
+			expected: "",
+		},
+		{
+			name:     "not selectable",
+			mailbox:  imapclient.Mailbox{Name: "[Gmail]", Attributes: []string{`\Noselect`}},
+			expected: "folder can not be selected",
+		},
+		{
+			name:     "special use kept",
+			mailbox:  imapclient.Mailbox{Name: "Spam", Attributes: []string{`\Junk`}},
+			expected: "",
+		},
+		{
+			name:     "special use skipped",
+			rules:    FolderRules{SkipSpecialUse: true},
+			mailbox:  imapclient.Mailbox{Name: "Bin", Attributes: []string{`\HasNoChildren`, `\trash`}},
+			expected: `special-use folder \Trash`,
+		},
+		{
+			name:     "other special use",
+			rules:    FolderRules{SkipSpecialUse: true},
+			mailbox:  imapclient.Mailbox{Name: "Sent", Attributes: []string{`\Sent`}},
+			expected: "",
+		},
+		{
+			name:     "included",
+			rules:    FolderRules{Include: compile("^INBOX$", "^Archive/")},
+			mailbox:  imapclient.Mailbox{Name: "Archive/2024"},
+			expected: "",
+		},
+		{
+			name:     "not included",
+			rules:    FolderRules{Include: compile("^INBOX$")},
+			mailbox:  imapclient.Mailbox{Name: "Archive"},
+			expected: "not included",
+		},
+		{
+			name:     "excluded",
+			rules:    FolderRules{Exclude: compile("^Archive/")},
+			mailbox:  imapclient.Mailbox{Name: "Archive/2024"},
+			expected: `excluded by "^Archive/"`,
+		},
+		{
+			name:     "excluded although included",
+			rules:    FolderRules{Include: compile("^Archive"), Exclude: compile("^Archive/Old$")},
+			mailbox:  imapclient.Mailbox{Name: "Archive/Old"},
+			expected: `excluded by "^Archive/Old$"`,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if reason := s.rules.Skip(&s.mailbox); reason != s.expected {
+				t.Fatalf("expected %q, got %q", s.expected, reason)
+			}
+		})
+	}
+}
+
+func TestAccountFolderRules(t *testing.T) {
+	scenarios := []struct {
+		name            string
+		include         any
+		exclude         any
+		expectedInclude int
+		expectedExclude int
+		err             bool
+	}{
+		{name: "not set"},
+		{name: "null", include: "null", exclude: "null"},
+		{name: "patterns", include: []string{"INBOX", "Archive/*"}, exclude: []string{"/^Trash/"}, expectedInclude: 2, expectedExclude: 1},
+		{name: "not a list", include: `"INBOX"`, err: true},
+		{name: "invalid pattern", exclude: []string{"/(/"}, err: true},
+	}
+
+	collection := core.NewBaseCollection("ib_smtp_accounts")
+	collection.Fields.Add(&core.JSONField{Name: "folder_include"}, &core.JSONField{Name: "folder_exclude"})
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			account := core.NewRecord(collection)
+			if s.include != nil {
+				account.Set("folder_include", s.include)
+			}
+			if s.exclude != nil {
+				account.Set("folder_exclude", s.exclude)
+			}
+
+			rules, err := AccountFolderRules(account)
+			if s.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", rules)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(rules.Include) != s.expectedInclude || len(rules.Exclude) != s.expectedExclude {
+				t.Fatalf("expected %d include and %d exclude pattern(s), got %d and %d",
+					s.expectedInclude, s.expectedExclude, len(rules.Include), len(rules.Exclude))
+			}
+		})
+	}
+}
+
+func TestChooseFolders(t *testing.T) {
+	mailboxes := []imapclient.Mailbox{
+		{Name: "INBOX"},
+		{Name: "[Gmail]", Attributes: []string{`\Noselect`}},
+		{Name: "[Gmail]/All Mail", Attributes: []string{`\All`}},
+		{Name: "[Gmail]/Spam", Attributes: []string{`\Junk`}},
+		{Name: "[Gmail]/Trash", Attributes: []string{`\Trash`}},
+		{Name: "Work"},
+	}
+
+	scenarios := []struct {
+		name     string
+		rules    FolderRules
+		allMail  string
+		expected []string
+	}{
+		{
+			name:     "other server",
+			expected: []string{"INBOX", "[Gmail]/All Mail", "[Gmail]/Spam", "[Gmail]/Trash", "Work"},
+		},
+		{
+			name:     "other server skipping special-use folders",
+			rules:    FolderRules{SkipSpecialUse: true},
+			expected: []string{"INBOX", "Work"},
+		},
+		{
+			name:     "Gmail",
+			allMail:  "[Gmail]/All Mail",
+			expected: []string{"[Gmail]/All Mail", "[Gmail]/Spam", "[Gmail]/Trash"},
+		},
+		{
+			name:     "Gmail skipping special-use folders",
+			rules:    FolderRules{SkipSpecialUse: true},
+			allMail:  "[Gmail]/All Mail",
+			expected: []string{"[Gmail]/All Mail"},
+		},
+		{
+			name:     "Gmail excluding Trash",
+			rules:    FolderRules{Exclude: []*regexp.Regexp{regexp.MustCompile("Trash$")}},
+			allMail:  "[Gmail]/All Mail",
+			expected: []string{"[Gmail]/All Mail", "[Gmail]/Spam"},
+		},
+		{
+			name:     "Gmail including only the INBOX",
+			rules:    FolderRules{Include: []*regexp.Regexp{regexp.MustCompile("^INBOX$")}},
+			allMail:  "[Gmail]/All Mail",
+			expected: []string{"[Gmail]/All Mail"},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			synced := []string{}
+			for _, choice := range chooseFolders(mailboxes, &s.rules, s.allMail) {
+				if choice.Sync != (choice.Reason == "") {
+					t.Fatalf("expected a reason for every skipped folder, got %+v", choice)
+				}
+				if choice.Sync {
+					synced = append(synced, choice.Name)
+				}
+			}
+
+			if !slices.Equal(synced, s.expected) {
+				t.Fatalf("expected %v to be synced, got %v", s.expected, synced)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package backup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+
+	"github.com/BrianLeishman/go-imap"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+)
+
+// allMailFolder returns the folder that holds every message of a Gmail
+// account, or an empty string for other servers. Gmail shows every label as
+// a folder, syncing them all would download a message once per label.
+func allMailFolder(im *imapclient.Client, mailboxes []imapclient.Mailbox) string {
+	if !im.IsGmail() {
+		return ""
+	}
+
+	for i := range mailboxes {
+		if mailboxes[i].HasAttribute(`\All`) && mailboxes[i].Selectable() {
+			return mailboxes[i].Name
+		}
+	}
+
+	log.Printf("Gmail account has no All Mail folder, syncing every folder\n")
+	return ""
+}
+
+// outsideAllMail are the RFC 6154 attributes of the Gmail folders whose
+// messages are left out of All Mail, so they are synced on their own.
+var outsideAllMail = []string{`\Junk`, `\Trash`}
+
+// isOutsideAllMail reports whether the messages of the Gmail folder are not
+// found in All Mail.
+func isOutsideAllMail(mailbox *imapclient.Mailbox) bool {
+	return slices.ContainsFunc(outsideAllMail, mailbox.HasAttribute)
+}
+
+// findExisting returns the archived emails that are the same message as the
+// given one. Gmail messages are found by their message id, emails that were
+// archived before the id was stored are found like on any other server.
+func (s *accountSync) findExisting(overview *imap.Email, message *imapclient.GmailMessage) ([]*core.Record, error) {
+	if message == nil {
+		return findDuplicates(s.app, s.smtpAccount, overview)
+	}
+
+	existingMails, err := s.app.FindAllRecords(s.cols.ib_emails, dbx.HashExp{
+		"smtp_account": s.smtpAccount.Id,
+		"gmail_msgid":  strconv.FormatUint(message.MsgID, 10),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find existing mails: %w", err)
+	}
+	if len(existingMails) > 0 {
+		return existingMails, nil
+	}
+
+	duplicates, err := findDuplicates(s.app, s.smtpAccount, overview)
+	if err != nil {
+		return nil, err
+	}
+
+	// an email with another id is a different message that only looks the same
+	existingMails = make([]*core.Record, 0, len(duplicates))
+	for _, duplicate := range duplicates {
+		if duplicate.GetString("gmail_msgid") == "" {
+			existingMails = append(existingMails, duplicate)
+		}
+	}
+
+	return existingMails, nil
+}
+
+// updateGmail stores the ids and the labels of the Gmail message with the
+// email. It reports whether the labels were changed.
+func (s *accountSync) updateGmail(emailRecord *core.Record, message *imapclient.GmailMessage) (bool, error) {
+	msgID := strconv.FormatUint(message.MsgID, 10)
+	thrID := strconv.FormatUint(message.ThrID, 10)
+
+	if emailRecord.GetString("gmail_msgid") != msgID || emailRecord.GetString("gmail_thrid") != thrID {
+		emailRecord.Set("gmail_msgid", msgID)
+		emailRecord.Set("gmail_thrid", thrID)
+		if err := s.app.Save(emailRecord); err != nil {
+			return false, fmt.Errorf("failed to save Gmail ids: %w", err)
+		}
+	}
+
+	changed, err := s.updateLabels(emailRecord, message.Labels)
+	if err != nil {
+		return false, fmt.Errorf("failed to update labels: %w", err)
+	}
+
+	return changed, nil
+}
+
+// missingGmail reports whether an email found in the folder has no Gmail
+// message id yet.
+func (s *accountSync) missingGmail(folder string) (bool, error) {
+	missing := false
+	err := s.app.DB().NewQuery(`
+		SELECT EXISTS (
+			SELECT 1 FROM {{email_locations}} l
+			INNER JOIN {{emails}} e ON [[e.id]] = [[l.email]]
+			WHERE [[l.smtp_account]] = {:smtp_account} AND [[l.folder]] = {:folder} AND [[e.gmail_msgid]] = ''
+		)
+	`).Bind(dbx.Params{
+		"smtp_account": s.smtpAccount.Id,
+		"folder":       folder,
+	}).Row(&missing)
+	if err != nil {
+		return false, fmt.Errorf("failed to find emails without Gmail id: %w", err)
+	}
+
+	return missing, nil
+}
+
+// forgetLabelFolders drops what earlier syncs stored about the label folders
+// of a Gmail account, now that their messages are synced through All Mail.
+// Their locations would keep emails that were deleted from All Mail from being
+// marked as deleted. Emails that are not in All Mail stay archived as they
+// are, Spam and Trash keep their own sync state. Restore and export put the
+// emails back into the folders of their labels.
+func (s *accountSync) forgetLabelFolders(allMail string) error {
+	// the locations are only replaced once All Mail was synced
+	allMailRecord, ok := s.folders[allMail]
+	if !ok || allMailRecord.GetInt("uid_validity") == 0 {
+		return nil
+	}
+
+	separate := make([]string, len(outsideAllMail))
+	for i, attribute := range outsideAllMail {
+		separate[i] = specialUse[attribute]
+	}
+
+	labelFolders := make([]*core.Record, 0)
+	folderNames := make([]any, 0)
+	for name, folderRecord := range s.folders {
+		if name == allMail || folderRecord.GetInt("uid_validity") == 0 {
+			continue
+		}
+		if slices.ContainsFunc(folderRecord.GetStringSlice("special_use"), func(use string) bool {
+			return slices.Contains(separate, use)
+		}) {
+			continue
+		}
+
+		labelFolders = append(labelFolders, folderRecord)
+		folderNames = append(folderNames, name)
+	}
+	if len(labelFolders) == 0 {
+		return nil
+	}
+
+	log.Printf("forgetting %d folder(s) of Gmail account, they are synced through %s\n", len(labelFolders), allMail)
+
+	// the records are changed one by one, so that their hooks, like the ones
+	// of the search index, see the change
+	return s.app.RunInTransaction(func(txApp core.App) error {
+		inLabelFolders := dbx.And(
+			dbx.HashExp{"smtp_account": s.smtpAccount.Id},
+			dbx.In("folder", folderNames...),
+		)
+
+		emailRecords, err := txApp.FindAllRecords(s.cols.ib_emails, inLabelFolders)
+		if err != nil {
+			return fmt.Errorf("failed to find emails of label folders: %w", err)
+		}
+
+		for _, emailRecord := range emailRecords {
+			location, err := txApp.FindFirstRecordByFilter(
+				s.cols.ib_email_locations,
+				"email = {:email} && folder = {:folder}",
+				dbx.Params{
+					"email":  emailRecord.Id,
+					"folder": allMail,
+				},
+			)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to find location in %s: %w", allMail, err)
+			}
+
+			emailRecord.Set("folder", allMail)
+			emailRecord.Set("mailbox", allMailRecord.Id)
+			emailRecord.Set("uid", location.GetInt("uid"))
+			if err := txApp.Save(emailRecord); err != nil {
+				return fmt.Errorf("failed to move email to %s: %w", allMail, err)
+			}
+		}
+
+		for _, collection := range []*core.Collection{s.cols.ib_email_locations, s.cols.ib_sync_failures} {
+			records, err := txApp.FindAllRecords(collection, inLabelFolders)
+			if err != nil {
+				return fmt.Errorf("failed to find '%s' of label folders: %w", collection.Name, err)
+			}
+
+			for _, record := range records {
+				if err := txApp.Delete(record); err != nil {
+					return fmt.Errorf("failed to delete '%s' of label folders: %w", collection.Name, err)
+				}
+			}
+		}
+
+		for _, folderRecord := range labelFolders {
+			folderRecord.Set("uid_validity", 0)
+			folderRecord.Set("last_uid", 0)
+			folderRecord.Set("highest_modseq", "")
+			if err := txApp.Save(folderRecord); err != nil {
+				return fmt.Errorf("failed to reset folder %s: %w", folderRecord.GetString("name"), err)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestForgetLabelFolders(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	cols, err := findCollections(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := testutil.CreateAccount(t, app, nil)
+
+	save := func(collection *core.Collection, fields map[string]any) *core.Record {
+		record := core.NewRecord(collection)
+		record.Set("smtp_account", account.Id)
+		for field, value := range fields {
+			record.Set(field, value)
+		}
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	folders := map[string]*core.Record{}
+	for name, use := range map[string]string{"[Gmail]/All Mail": "all", "Work": "", "[Gmail]/Trash": "trash"} {
+		folders[name] = save(cols.ib_folders, map[string]any{"name": name, "uid_validity": 1, "last_uid": 10, "special_use": use})
+	}
+
+	// the email in Work is in All Mail as well, the one only in Work is not
+	inAllMail := save(cols.ib_emails, map[string]any{"folder": "Work", "mailbox": folders["Work"].Id, "uid": 1})
+	save(cols.ib_email_locations, map[string]any{"email": inAllMail.Id, "folder": "Work", "uid_validity": 1, "uid": 1})
+	save(cols.ib_email_locations, map[string]any{"email": inAllMail.Id, "folder": "[Gmail]/All Mail", "uid_validity": 1, "uid": 7})
+	onlyInWork := save(cols.ib_emails, map[string]any{"folder": "Work", "mailbox": folders["Work"].Id, "uid": 2})
+	save(cols.ib_email_locations, map[string]any{"email": onlyInWork.Id, "folder": "Work", "uid_validity": 1, "uid": 2})
+	save(cols.ib_sync_failures, map[string]any{"folder": "Work", "uid_validity": 1, "uid": 3})
+
+	inTrash := save(cols.ib_emails, map[string]any{"folder": "[Gmail]/Trash", "mailbox": folders["[Gmail]/Trash"].Id, "uid": 4})
+	save(cols.ib_email_locations, map[string]any{"email": inTrash.Id, "folder": "[Gmail]/Trash", "uid_validity": 1, "uid": 4})
+
+	// every record is loaded again, the way a sync finds them
+	s := &accountSync{app: app, cols: cols, smtpAccount: account, folders: map[string]*core.Record{}}
+	for name, folderRecord := range folders {
+		if s.folders[name], err = app.FindRecordById(cols.ib_folders, folderRecord.Id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.forgetLabelFolders("[Gmail]/All Mail"); err != nil {
+		t.Fatal(err)
+	}
+
+	emailScenarios := []struct {
+		email             *core.Record
+		expectedUID       int
+		expectedIn        string
+		expectedLocations int
+	}{
+		{inAllMail, 7, "[Gmail]/All Mail", 1},
+		{onlyInWork, 2, "Work", 0},
+		{inTrash, 4, "[Gmail]/Trash", 1},
+	}
+
+	for _, es := range emailScenarios {
+		t.Run(es.email.GetString("folder")+"/"+es.email.GetString("uid"), func(t *testing.T) {
+			email, err := app.FindRecordById(cols.ib_emails, es.email.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if email.GetString("folder") != es.expectedIn || email.GetInt("uid") != es.expectedUID {
+				t.Fatalf("expected the email in %s with UID %d, got %s with UID %d",
+					es.expectedIn, es.expectedUID, email.GetString("folder"), email.GetInt("uid"))
+			}
+			if email.GetString("mailbox") != folders[es.expectedIn].Id {
+				t.Fatalf("expected the email to reference %s", es.expectedIn)
+			}
+
+			locations, err := app.FindAllRecords(cols.ib_email_locations, dbx.HashExp{"email": email.Id})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(locations) != es.expectedLocations {
+				t.Fatalf("expected %d location(s), got %d", es.expectedLocations, len(locations))
+			}
+		})
+	}
+
+	failures, err := app.FindAllRecords(cols.ib_sync_failures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 0 {
+		t.Fatalf("expected the failures of Work to be dropped, got %d", len(failures))
+	}
+
+	for name, expected := range map[string]int{"[Gmail]/All Mail": 1, "Work": 0, "[Gmail]/Trash": 1} {
+		folderRecord, err := app.FindRecordById(cols.ib_folders, folders[name].Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if folderRecord.GetInt("uid_validity") != expected {
+			t.Fatalf("expected UIDVALIDITY %d for %s, got %d", expected, name, folderRecord.GetInt("uid_validity"))
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package backup
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+)
+
+// renameSample is the number of messages of a new folder that are compared
+// with the archive to find out whether it is a renamed folder.
+const renameSample = 20
+
+// specialUse maps the RFC 6154 attributes to the values of the 'special_use'
+// field of 'ib_folders'.
+var specialUse = map[string]string{
+	`\All`:     "all",
+	`\Archive`: "archive",
+	`\Drafts`:  "drafts",
+	`\Flagged`: "flagged",
+	`\Junk`:    "junk",
+	`\Sent`:    "sent",
+	`\Trash`:   "trash",
+}
+
+// displayName returns the decoded name of the last level of the folder.
+func displayName(mailbox *imapclient.Mailbox) string {
+	name, err := imapclient.DecodeMailboxName(mailbox.Name)
+	if err != nil {
+		log.Printf("failed to decode name of folder %s: %v\n", mailbox.Name, err)
+	}
+
+	if mailbox.Delimiter != "" {
+		if i := strings.LastIndex(name, mailbox.Delimiter); i != -1 {
+			name = name[i+len(mailbox.Delimiter):]
+		}
+	}
+
+	return name
+}
+
+// parentName returns the raw name of the parent of the folder, or an empty
+// string for folders on the top level.
+func parentName(mailbox *imapclient.Mailbox) string {
+	if mailbox.Delimiter == "" {
+		return ""
+	}
+
+	if i := strings.LastIndex(mailbox.Name, mailbox.Delimiter); i > 0 {
+		return mailbox.Name[:i]
+	}
+	return ""
+}
+
+// syncFolderTree stores every folder of the server in 'ib_folders', including
+// the ones that are not synced. Folders that appeared while others vanished
+// are checked for being renamed, so that their emails and state move along.
+// The remaining vanished folders are marked as deleted on the server.
+func (s *accountSync) syncFolderTree(mailboxes []imapclient.Mailbox) error {
+	subscribed, err := s.im.Subscribed()
+	if err != nil {
+		if imapclient.IsConnectionError(err) {
+			return fmt.Errorf("failed to get subscribed folders: %w", err)
+		}
+		// the subscription state is kept as it is
+		log.Printf("failed to get subscribed folders: %v\n", err)
+	}
+
+	folderRecords, err := s.app.FindAllRecords(s.cols.ib_folders, dbx.HashExp{"smtp_account": s.smtpAccount.Id})
+	if err != nil {
+		return fmt.Errorf("failed to find stored folders: %w", err)
+	}
+
+	s.folders = make(map[string]*core.Record, len(folderRecords))
+	for _, folderRecord := range folderRecords {
+		s.folders[folderRecord.GetString("name")] = folderRecord
+	}
+
+	onServer := make(map[string]bool, len(mailboxes))
+	added := make([]*imapclient.Mailbox, 0)
+	for i := range mailboxes {
+		onServer[mailboxes[i].Name] = true
+		if _, ok := s.folders[mailboxes[i].Name]; !ok && mailboxes[i].Selectable() {
+			added = append(added, &mailboxes[i])
+		}
+	}
+
+	vanished := make([]*core.Record, 0)
+	for name, folderRecord := range s.folders {
+		if !onServer[name] && folderRecord.GetDateTime("deleted_on_server").IsZero() {
+			vanished = append(vanished, folderRecord)
+		}
+	}
+
+	if len(added) > 0 && len(vanished) > 0 {
+		if vanished, err = s.detectRenames(added, vanished); err != nil {
+			return err
+		}
+	}
+
+	for i := range mailboxes {
+		mailbox := &mailboxes[i]
+
+		folderRecord, ok := s.folders[mailbox.Name]
+		if !ok {
+			folderRecord = core.NewRecord(s.cols.ib_folders)
+			folderRecord.Set("smtp_account", s.smtpAccount.Id)
+			folderRecord.Set("name", mailbox.Name)
+			s.folders[mailbox.Name] = folderRecord
+		}
+
+		uses := make([]string, 0)
+		for _, attribute := range mailbox.Attributes {
+			for name, value := range specialUse {
+				if strings.EqualFold(attribute, name) {
+					uses = append(uses, value)
+				}
+			}
+		}
+
+		folderRecord.Set("display_name", displayName(mailbox))
+		folderRecord.Set("delimiter", mailbox.Delimiter)
+		folderRecord.Set("special_use", uses)
+		folderRecord.Set("selectable", mailbox.Selectable())
+		folderRecord.Set("deleted_on_server", "")
+		if subscribed != nil {
+			folderRecord.Set("subscribed", subscribed[mailbox.Name])
+		}
+
+		// the folder is retried and skipped by its own sync
+		if err := s.app.Save(folderRecord); err != nil {
+			log.Printf("failed to save folder %s: %v\n", mailbox.Name, err)
+		}
+	}
+
+	// parents are linked once every folder has a record
+	for i := range mailboxes {
+		folderRecord := s.folders[mailboxes[i].Name]
+
+		parent := ""
+		if parentRecord, ok := s.folders[parentName(&mailboxes[i])]; ok {
+			parent = parentRecord.Id
+		}
+		if folderRecord.GetString("parent") == parent {
+			continue
+		}
+
+		folderRecord.Set("parent", parent)
+		if err := s.app.Save(folderRecord); err != nil {
+			log.Printf("failed to save folder %s: %v\n", mailboxes[i].Name, err)
+		}
+	}
+
+	for _, folderRecord := range vanished {
+		if err := s.markFolderDeleted(folderRecord); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// detectRenames looks for a vanished folder for every added one. A folder was
+// renamed if it kept its UIDVALIDITY, which most servers do, or if most of
+// its newest messages are archived in one of the vanished folders. It returns
+// the vanished folders that were not renamed.
+func (s *accountSync) detectRenames(added []*imapclient.Mailbox, vanished []*core.Record) ([]*core.Record, error) {
+	for _, mailbox := range added {
+		if len(vanished) == 0 {
+			break
+		}
+
+		status, err := s.im.Status(mailbox.Name)
+		if err != nil {
+			if imapclient.IsConnectionError(err) {
+				return nil, fmt.Errorf("failed to get status of folder %s: %w", mailbox.Name, err)
+			}
+			log.Printf("failed to get status of folder %s: %v\n", mailbox.Name, err)
+			continue
+		}
+
+		// some servers use the same UIDVALIDITY for every folder, it only
+		// identifies a folder if no other one has it
+		shared := 0
+		for _, folderRecord := range s.folders {
+			if folderRecord.GetInt("uid_validity") == int(status.UIDValidity) {
+				shared++
+			}
+		}
+
+		renamed := -1
+		if status.UIDValidity != 0 && shared == 1 {
+			for i, folderRecord := range vanished {
+				if folderRecord.GetInt("uid_validity") == int(status.UIDValidity) {
+					renamed = i
+					break
+				}
+			}
+		}
+
+		if renamed == -1 && status.Exists > 0 {
+			renamed, err = s.overlappingFolder(mailbox.Name, vanished)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if renamed == -1 {
+			continue
+		}
+
+		if err := s.renameFolder(vanished[renamed], mailbox.Name); err != nil {
+			return nil, err
+		}
+		vanished = append(vanished[:renamed], vanished[renamed+1:]...)
+	}
+
+	return vanished, nil
+}
+
+// overlappingFolder returns the index of the vanished folder that most of the
+// newest messages of the folder are archived in, or -1 if there is none.
+func (s *accountSync) overlappingFolder(folder string, vanished []*core.Record) (int, error) {
+	if _, err := s.im.Examine(folder, false); err != nil {
+		return -1, fmt.Errorf("failed to select folder: %w", err)
+	}
+
+	uids, err := s.im.UIDSearch("ALL")
+	if err != nil {
+		return -1, fmt.Errorf("failed to get UIDs: %w", err)
+	}
+	if len(uids) > renameSample {
+		uids = uids[len(uids)-renameSample:]
+	}
+
+	overviews, err := s.im.GetOverviews(uids...)
+	if err != nil {
+		return -1, fmt.Errorf("failed to get email overviews: %w", err)
+	}
+
+	indexes := make(map[string]int, len(vanished))
+	for i, folderRecord := range vanished {
+		indexes[folderRecord.GetString("name")] = i
+	}
+
+	votes := make([]int, len(vanished))
+	for _, overview := range overviews {
+		duplicates, err := findDuplicates(s.app, s.smtpAccount, overview)
+		if err != nil {
+			return -1, err
+		}
+
+		// every message counts once per folder, no matter how many copies
+		seen := make(map[int]bool)
+		for _, duplicate := range duplicates {
+			locations, err := s.app.FindAllRecords(s.cols.ib_email_locations, dbx.HashExp{"email": duplicate.Id})
+			if err != nil {
+				return -1, fmt.Errorf("failed to find email locations: %w", err)
+			}
+
+			for _, location := range locations {
+				if i, ok := indexes[location.GetString("folder")]; ok && !seen[i] {
+					seen[i] = true
+					votes[i]++
+				}
+			}
+		}
+	}
+
+	best := -1
+	for i, count := range votes {
+		if count*2 > len(uids) && (best == -1 || count > votes[best]) {
+			best = i
+		}
+	}
+
+	return best, nil
+}
+
+// renameFolder gives the folder record, the locations, the emails and the
+// failed messages of the folder the new name. The records are saved one by
+// one, so that their hooks, like the ones of the search index, see the change.
+func (s *accountSync) renameFolder(folderRecord *core.Record, newName string) error {
+	oldName := folderRecord.GetString("name")
+	log.Printf("folder %s was renamed to %s\n", oldName, newName)
+
+	err := s.app.RunInTransaction(func(txApp core.App) error {
+		for _, collection := range []*core.Collection{s.cols.ib_email_locations, s.cols.ib_emails, s.cols.ib_sync_failures} {
+			records, err := txApp.FindAllRecords(collection, dbx.HashExp{
+				"smtp_account": s.smtpAccount.Id,
+				"folder":       oldName,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to find records of '%s': %w", collection.Name, err)
+			}
+
+			for _, record := range records {
+				record.Set("folder", newName)
+				if err := txApp.Save(record); err != nil {
+					return fmt.Errorf("failed to rename folder of '%s': %w", collection.Name, err)
+				}
+			}
+		}
+
+		folderRecord.Set("name", newName)
+		return txApp.Save(folderRecord)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rename folder %s: %w", oldName, err)
+	}
+
+	delete(s.folders, oldName)
+	s.folders[newName] = folderRecord
+
+	return nil
+}
+
+// markFolderDeleted marks every email as deleted that is stored for a folder
+// which no longer exists on the server and forgets the sync state of the
+// folder. The record itself is kept for the emails that were archived from it.
+func (s *accountSync) markFolderDeleted(folderRecord *core.Record) error {
+	folder := folderRecord.GetString("name")
+	log.Printf("folder %s was deleted on the server\n", folder)
+
+	if err := s.markDeleted(folder, 0, nil, &s.run.stats); err != nil {
+		return err
+	}
+
+	folderRecord.Set("uid_validity", 0)
+	folderRecord.Set("last_uid", 0)
+	folderRecord.Set("highest_modseq", "")
+	folderRecord.Set("deleted_on_server", types.NowDateTime())
+	if err := s.app.Save(folderRecord); err != nil {
+		return fmt.Errorf("failed to save deleted folder: %w", err)
+	}
+
+	return nil
+}
+
+// mailboxId returns the id of the 'ib_folders' record of the folder, or an
+// empty string if it has none.
+func (s *accountSync) mailboxId(folder string) string {
+	if folderRecord, ok := s.folders[folder]; ok {
+		return folderRecord.Id
+	}
+	return ""
+}
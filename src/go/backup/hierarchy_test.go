@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestDisplayName(t *testing.T) {
+	scenarios := []struct {
+		mailbox        imapclient.Mailbox
+		expectedName   string
+		expectedParent string
+	}{
+		{imapclient.Mailbox{Name: "INBOX", Delimiter: "/"}, "INBOX", ""},
+		{imapclient.Mailbox{Name: "Arbeit/B&APw-cher", Delimiter: "/"}, "Bücher", "Arbeit"},
+		{imapclient.Mailbox{Name: "INBOX.a.b", Delimiter: "."}, "b", "INBOX.a"},
+		{imapclient.Mailbox{Name: "a/b", Delimiter: ""}, "a/b", ""},
+		{imapclient.Mailbox{Name: "/a", Delimiter: "/"}, "a", ""},
+		{imapclient.Mailbox{Name: "Broken&", Delimiter: "/"}, "Broken&", ""},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.mailbox.Name, func(t *testing.T) {
+			if name := displayName(&s.mailbox); name != s.expectedName {
+				t.Fatalf("expected display name %q, got %q", s.expectedName, name)
+			}
+			if parent := parentName(&s.mailbox); parent != s.expectedParent {
+				t.Fatalf("expected parent %q, got %q", s.expectedParent, parent)
+			}
+		})
+	}
+}
+
+func TestRenameFolder(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	cols, err := findCollections(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := testutil.CreateAccount(t, app, nil)
+
+	save := func(collection *core.Collection, fields map[string]any) *core.Record {
+		record := core.NewRecord(collection)
+		record.Set("smtp_account", account.Id)
+		for field, value := range fields {
+			record.Set(field, value)
+		}
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	folderRecord := save(cols.ib_folders, map[string]any{"name": "Old", "uid_validity": 7})
+	email := save(cols.ib_emails, map[string]any{"folder": "Old", "mailbox": folderRecord.Id})
+	save(cols.ib_email_locations, map[string]any{"email": email.Id, "folder": "Old", "uid_validity": 7, "uid": 1})
+	save(cols.ib_sync_failures, map[string]any{"folder": "Old", "uid_validity": 7, "uid": 2})
+
+	// records of another folder stay where they are
+	other := save(cols.ib_emails, map[string]any{"folder": "Other"})
+
+	s := &accountSync{
+		app:         app,
+		cols:        cols,
+		smtpAccount: account,
+		folders:     map[string]*core.Record{"Old": folderRecord},
+	}
+	if err := s.renameFolder(folderRecord, "New"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.folders["New"] != folderRecord || s.folders["Old"] != nil {
+		t.Fatalf("expected the folder to be known by its new name, got %v", s.folders)
+	}
+
+	for _, collection := range []*core.Collection{cols.ib_folders, cols.ib_emails, cols.ib_email_locations, cols.ib_sync_failures} {
+		t.Run(collection.Name, func(t *testing.T) {
+			field := "folder"
+			if collection == cols.ib_folders {
+				field = "name"
+			}
+
+			old, err := app.FindAllRecords(collection, dbx.HashExp{field: "Old"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			renamed, err := app.FindAllRecords(collection, dbx.HashExp{field: "New"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(old) != 0 || len(renamed) != 1 {
+				t.Fatalf("expected 1 renamed record, got %d renamed and %d old", len(renamed), len(old))
+			}
+		})
+	}
+
+	other, err = app.FindRecordById(cols.ib_emails, other.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.GetString("folder") != "Other" {
+		t.Fatalf("expected the other email to stay in Other, got %q", other.GetString("folder"))
+	}
+}
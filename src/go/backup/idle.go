@@ -0,0 +1,260 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/connect"
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+)
+
+const (
+	// idleRefresh is the time after which IDLE is ended and sent again, servers
+	// are allowed to drop connections that are idle for 30 minutes.
+	idleRefresh = 29 * time.Minute
+
+	// idlePollInterval is the interval the folder is checked in if the server
+	// does not support IDLE.
+	idlePollInterval = 2 * time.Minute
+
+	// idleMinBackoff and idleMaxBackoff limit the time waited before
+	// reconnecting after the connection failed.
+	idleMinBackoff = 5 * time.Second
+	idleMaxBackoff = 5 * time.Minute
+
+	// idleLockedRetry is the time waited before a sync is tried again if the
+	// account is already being synced.
+	idleLockedRetry = 30 * time.Second
+
+	idleKeyPrefix = "ib_idle_"
+)
+
+// watchedFields are the fields of an account the connections started by
+// watch depend on, a change of any other field leaves them open.
+var watchedFields = []string{
+	"idle", "idle_folders", "sync_paused", "offline",
+	"host", "port", "username", "password", "auth_type",
+	"tls_mode", "tls_ca_bundle", "tls_client_cert", "tls_client_key", "tls_insecure_skip_verify",
+	"oauth2_provider", "oauth2_client_id", "oauth2_client_secret", "oauth2_auth_url",
+	"oauth2_token_url", "oauth2_scopes", "oauth2_refresh_token",
+}
+
+// watchChanged reports whether a saved account has to be watched again,
+// because it is new or one of the watched fields changed.
+func watchChanged(smtpAccount *core.Record) bool {
+	original := smtpAccount.Original()
+	if original.IsNew() {
+		return true
+	}
+
+	for _, field := range watchedFields {
+		if smtpAccount.GetString(field) != original.GetString(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// IdleFolders returns the folders the account is watched in while push mode is
+// enabled. It defaults to the INBOX.
+func IdleFolders(smtpAccount *core.Record) []string {
+	folders := []string{}
+	if err := smtpAccount.UnmarshalJSONField("idle_folders", &folders); err != nil || len(folders) == 0 {
+		return []string{"INBOX"}
+	}
+	return folders
+}
+
+// watch starts a long-lived connection for every folder of the account that
+// is watched for changes, replacing the connections of a previous call. Paused
+// and offline accounts and accounts without push mode are not watched.
+func watch(app core.App, smtpAccount *core.Record) {
+	unwatch(app, smtpAccount.Id)
+
+	if !smtpAccount.GetBool("idle") || smtpAccount.GetBool("sync_paused") || smtpAccount.GetBool("offline") {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.Store().Set(idleKeyPrefix+smtpAccount.Id, cancel)
+
+	for _, folder := range IdleFolders(smtpAccount) {
+		go idleFolder(ctx, app, smtpAccount.Id, folder)
+	}
+}
+
+// unwatch closes the connections of the account started by watch.
+func unwatch(app core.App, smtpAccountId string) {
+	key := idleKeyPrefix + smtpAccountId
+	if cancel, ok := app.Store().Get(key).(context.CancelFunc); ok {
+		cancel()
+		app.Store().Remove(key)
+	}
+}
+
+// idleFolder keeps a connection to the folder open until ctx is done and
+// syncs the folder whenever the server reports a change. A lost connection is
+// reestablished with an increasing delay, and the folder is synced after
+// every reconnect, because changes might have been missed in between.
+func idleFolder(ctx context.Context, app core.App, smtpAccountId string, folder string) {
+	backoff := idleMinBackoff
+	reconnect := false
+
+	for ctx.Err() == nil {
+		if reconnect {
+			idleSync(ctx, app, smtpAccountId, folder)
+		}
+
+		connected, err := idleConnection(ctx, app, smtpAccountId, folder)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = idleMinBackoff
+		}
+
+		log.Printf("watching folder %s of account %s failed, reconnecting in %s: %v\n", folder, smtpAccountId, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, idleMaxBackoff)
+		reconnect = true
+	}
+}
+
+// idleConnection connects to the folder and waits for changes until ctx is
+// done or the connection fails. It reports whether the folder could be
+// selected, so that the caller knows whether to reset its backoff.
+func idleConnection(ctx context.Context, app core.App, smtpAccountId string, folder string) (bool, error) {
+	smtpAccount, err := app.FindRecordById("ib_smtp_accounts", smtpAccountId)
+	if err != nil {
+		return false, err
+	}
+
+	c, err := connect.Account(ctx, app, smtpAccount)
+	if err != nil {
+		return false, err
+	}
+	defer c.Logout()
+
+	if _, err := c.Examine(folder, false); err != nil {
+		return false, err
+	}
+
+	push := c.Capabilities.Has("IDLE")
+	if !push {
+		log.Printf("server of account %s does not support IDLE, polling folder %s every %s\n", smtpAccountId, folder, idlePollInterval)
+	}
+
+	for {
+		changed := false
+		onUntagged := func(line string) {
+			if imapclient.IsFolderChange(line) {
+				changed = true
+			}
+		}
+
+		if push {
+			// IDLE is ended on the first change, so that the folder is synced
+			// right away instead of at the next refresh
+			idleCtx, cancel := context.WithCancel(ctx)
+			err = c.Idle(idleCtx, idleRefresh, func(line string) {
+				onUntagged(line)
+				if changed {
+					cancel()
+				}
+			})
+			cancel()
+		} else {
+			select {
+			case <-ctx.Done():
+				return true, ctx.Err()
+			case <-time.After(idlePollInterval):
+			}
+			err = c.Noop(onUntagged)
+		}
+		if err != nil {
+			return true, err
+		}
+
+		if ctx.Err() != nil {
+			return true, ctx.Err()
+		}
+
+		if changed {
+			idleSync(ctx, app, smtpAccountId, folder)
+		}
+	}
+}
+
+// idleSync syncs the folder. If the account is already being synced, the sync
+// is tried again later, because the running sync might have passed the folder
+// before the change.
+func idleSync(ctx context.Context, app core.App, smtpAccountId string, folder string) {
+	for {
+		err := SyncAccount(app, smtpAccountId, Options{Folders: []string{folder}})
+		if !errors.Is(err, ErrLocked) {
+			if err != nil {
+				log.Printf("sync of folder %s of account %s after a change failed: %v\n", folder, smtpAccountId, err)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(idleLockedRetry):
+		}
+	}
+}
+
+// registerIdle watches the accounts with push mode once the app serves and
+// keeps the connections in line with the account records afterwards.
+func registerIdle(app core.App) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		smtpAccounts, err := se.App.FindAllRecords("ib_smtp_accounts")
+		if err != nil {
+			return err
+		}
+
+		for _, smtpAccount := range smtpAccounts {
+			watch(se.App, smtpAccount)
+		}
+
+		return se.Next()
+	})
+
+	rewatch := func(e *core.RecordEvent) error {
+		// e.App might be a finished transaction, the connections have to use the main app
+		if watchChanged(e.Record) {
+			watch(app, e.Record)
+		}
+		return e.Next()
+	}
+
+	app.OnRecordAfterCreateSuccess("ib_smtp_accounts").BindFunc(rewatch)
+	app.OnRecordAfterUpdateSuccess("ib_smtp_accounts").BindFunc(rewatch)
+
+	app.OnRecordAfterDeleteSuccess("ib_smtp_accounts").BindFunc(func(e *core.RecordEvent) error {
+		unwatch(app, e.Record.Id)
+		return e.Next()
+	})
+
+	app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		for key, value := range app.Store().GetAll() {
+			if cancel, ok := value.(context.CancelFunc); ok && strings.HasPrefix(key, idleKeyPrefix) {
+				cancel()
+			}
+		}
+		return e.Next()
+	})
+}
@@ -0,0 +1,61 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestWatchChanged(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	account := testutil.CreateAccount(t, app, nil)
+
+	scenarios := []struct {
+		name     string
+		field    string
+		value    any
+		expected bool
+	}{
+		{"unchanged", "", nil, false},
+		{"deletion policy", "deletion_policy", DeletionPolicyMirror, false},
+		{"sync schedule", "sync_schedule", "0 * * * *", false},
+		{"push mode", "idle", true, true},
+		{"push folders", "idle_folders", "INBOX\nArchive", true},
+		{"paused", "sync_paused", true, true},
+		{"host", "host", "imap.example.org", true},
+		{"password", "password", "changed", true},
+		{"refresh token", "oauth2_refresh_token", "refresh", true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			// Original is only set for records loaded from the database
+			record, err := app.FindRecordById("ib_smtp_accounts", account.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.field != "" {
+				record.Set(s.field, s.value)
+			}
+
+			if changed := watchChanged(record); changed != s.expected {
+				t.Fatalf("expected %v, got %v", s.expected, changed)
+			}
+		})
+	}
+
+	t.Run("new", func(t *testing.T) {
+		record := core.NewRecord(account.Collection())
+		if !watchChanged(record) {
+			t.Fatal("expected a new account to be watched")
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package backup
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// Init schedules the sync of every account, watches the accounts with push
+// mode and registers the sync command and API endpoints.
+func Init(app *pocketbase.PocketBase) {
+	registerScheduler(app)
+	registerIdle(app)
+
+	app.RootCmd.AddCommand(newCommand(app))
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.POST("/api/ib/accounts/{id}/sync", handleSync).Bind(apis.RequireAuth())
+		se.Router.GET("/api/ib/accounts/{id}/folders", handleFolders).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+}
+
+func newCommand(app core.App) *cobra.Command {
+	var account string
+	options := Options{}
+
+	command := &cobra.Command{
+		Use:   "sync",
+		Short: "Syncs the accounts once without starting the server",
+		Long: "Syncs every account that is not paused, or only the given one even if it is paused.\n" +
+			"The command is meant to be run from a scheduler like a systemd timer.",
+		RunE: func(command *cobra.Command, args []string) error {
+			if account != "" {
+				return SyncAccount(app, account, options)
+			}
+			return SyncAll(app, options)
+		},
+	}
+
+	command.Flags().StringVar(&account, "account", "", "id of the account to sync, all accounts are synced if empty")
+	command.Flags().StringSliceVar(&options.Folders, "folder", nil, "folder to sync, can be repeated, all folders are synced if empty")
+
+	return command
+}
+
+type syncRequest struct {
+	Folders []string `json:"folders"`
+}
+
+type syncResponse struct {
+	Run string `json:"run"`
+}
+
+// handleSync starts an immediate sync of the account in the background and
+// returns the id of its 'ib_sync_runs' record.
+func handleSync(e *core.RequestEvent) error {
+	body := syncRequest{}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body.", err)
+	}
+
+	account, err := e.App.FindRecordById("ib_smtp_accounts", e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("Account not found.", nil)
+	}
+
+	if !e.HasSuperuserAuth() && account.GetString("created_by") != e.Auth.Id {
+		return e.NotFoundError("Account not found.", nil)
+	}
+
+	if account.GetBool("offline") {
+		return e.BadRequestError("Offline accounts can not be synced.", nil)
+	}
+
+	run, err := StartSync(e.App, account.Id, Options{Folders: body.Folders})
+	if err != nil {
+		if errors.Is(err, ErrLocked) {
+			return e.Error(http.StatusConflict, "The account is already being synced.", nil)
+		}
+		return e.InternalServerError("Failed to start sync.", err)
+	}
+
+	return e.JSON(http.StatusAccepted, syncResponse{Run: run})
+}
+
+// handleFolders lists the folders of the server and tells which ones a sync
+// would back up, so that the folder rules can be checked before syncing.
+func handleFolders(e *core.RequestEvent) error {
+	account, err := e.App.FindRecordById("ib_smtp_accounts", e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("Account not found.", nil)
+	}
+
+	if !e.HasSuperuserAuth() && account.GetString("created_by") != e.Auth.Id {
+		return e.NotFoundError("Account not found.", nil)
+	}
+
+	if account.GetBool("offline") {
+		return e.BadRequestError("Offline accounts have no folders on a server.", nil)
+	}
+
+	folders, err := PlanFolders(e.Request.Context(), e.App, account)
+	if err != nil {
+		return e.BadRequestError("Failed to list folders: "+err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, folders)
+}
@@ -0,0 +1,76 @@
+package backup
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestHandleSync(t *testing.T) {
+	const accountId = "account12345678"
+
+	scenarios := []struct {
+		name       string
+		collection string
+		email      string
+		account    string
+
+		expectedStatus  int
+		expectedContent string
+	}{
+		{"guest", "", "", accountId, http.StatusUnauthorized, `"data":{}`},
+		// the account is locked, so the request ends before a sync would start
+		{"owner", "users", testutil.OwnerEmail, accountId, http.StatusConflict, "already being synced"},
+		{"superuser", core.CollectionNameSuperusers, "test@example.com", accountId, http.StatusConflict, "already being synced"},
+		{"other user", "users", "test2@example.com", accountId, http.StatusNotFound, "Account not found."},
+		{"unknown account", "users", testutil.OwnerEmail, "unknown", http.StatusNotFound, "Account not found."},
+	}
+
+	for _, s := range scenarios {
+		// the token is only valid in the app it is created in
+		headers := map[string]string{}
+
+		scenario := tests.ApiScenario{
+			Name:    s.name,
+			Method:  http.MethodPost,
+			URL:     "/api/ib/accounts/" + s.account + "/sync",
+			Headers: headers,
+			BeforeTestFunc: func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+				e.Router.POST("/api/ib/accounts/{id}/sync", handleSync).Bind(apis.RequireAuth())
+
+				account := testutil.CreateAccount(t, app, map[string]any{"id": accountId})
+
+				lock := core.NewRecord(testutil.Collection(t, app, "ib_sync_locks"))
+				lock.Set("smtp_account", account.Id)
+				lock.Set("holder", "other")
+				lock.Set("acquired", types.NowDateTime())
+				lock.Set("expires", types.NowDateTime().Add(time.Hour))
+				if err := app.Save(lock); err != nil {
+					t.Fatal(err)
+				}
+
+				if s.email == "" {
+					return
+				}
+				auth, err := app.FindAuthRecordByEmail(s.collection, s.email)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if headers["Authorization"], err = auth.NewAuthToken(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			ExpectedStatus:  s.expectedStatus,
+			ExpectedContent: []string{s.expectedContent},
+		}
+
+		scenario.Test(t)
+	}
+}
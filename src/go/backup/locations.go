@@ -0,0 +1,181 @@
+package backup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// locate records that the email was seen in the folder under the UID. It
+// reports whether the email was not known at that location before.
+func locate(txApp core.App, cols *collections, emailRecord *core.Record, folder string, uidValidity uint32, uid int) (bool, error) {
+	record, err := txApp.FindFirstRecordByFilter(
+		cols.ib_email_locations,
+		"email = {:email} && folder = {:folder} && uid_validity = {:uid_validity} && uid = {:uid}",
+		dbx.Params{
+			"email":        emailRecord.Id,
+			"folder":       folder,
+			"uid_validity": uidValidity,
+			"uid":          uid,
+		},
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to find email location: %w", err)
+	}
+
+	now := types.NowDateTime()
+
+	isNew := record == nil
+	if isNew {
+		record = core.NewRecord(cols.ib_email_locations)
+		record.Set("email", emailRecord.Id)
+		record.Set("smtp_account", emailRecord.GetString("smtp_account"))
+		record.Set("folder", folder)
+		record.Set("uid_validity", uidValidity)
+		record.Set("uid", uid)
+		record.Set("first_seen", now)
+	}
+	record.Set("last_seen", now)
+
+	if err := txApp.Save(record); err != nil {
+		return false, fmt.Errorf("failed to save email location: %w", err)
+	}
+
+	return isNew, nil
+}
+
+// runStarted returns the time the current run started.
+func (s *accountSync) runStarted() types.DateTime {
+	return s.run.record.GetDateTime("started")
+}
+
+// markDeleted forgets every location in the folder whose UID is no longer in
+// serverUIDs or that belongs to a previous UIDVALIDITY, and touches the
+// remaining ones. Emails without any location left are marked as deleted on
+// the server. An email that lost its location here but was found in another
+// folder during the same run was moved there.
+func (s *accountSync) markDeleted(folder string, uidValidity uint32, serverUIDs []int, stats *syncStats) error {
+	existing := make(map[int]bool, len(serverUIDs))
+	for _, uid := range serverUIDs {
+		existing[uid] = true
+	}
+
+	rows := []struct {
+		Id          string `db:"id"`
+		Email       string `db:"email"`
+		UIDValidity uint32 `db:"uid_validity"`
+		UID         int    `db:"uid"`
+	}{}
+	err := s.app.RecordQuery(s.cols.ib_email_locations).
+		Select("id", "email", "uid_validity", "uid").
+		AndWhere(dbx.HashExp{
+			"smtp_account": s.smtpAccount.Id,
+			"folder":       folder,
+		}).
+		All(&rows)
+	if err != nil {
+		return fmt.Errorf("failed to find email locations: %w", err)
+	}
+
+	goneIds := make([]any, 0)
+	emailIds := make([]string, 0)
+	for _, row := range rows {
+		if row.UIDValidity != uidValidity || !existing[row.UID] {
+			goneIds = append(goneIds, row.Id)
+			emailIds = append(emailIds, row.Email)
+		}
+	}
+
+	_, err = s.app.DB().Update(
+		s.cols.ib_email_locations.Name,
+		dbx.Params{"last_seen": types.NowDateTime().String()},
+		dbx.HashExp{
+			"smtp_account": s.smtpAccount.Id,
+			"folder":       folder,
+			"uid_validity": uidValidity,
+		},
+	).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to update email locations: %w", err)
+	}
+
+	if len(goneIds) == 0 {
+		return nil
+	}
+
+	_, err = s.app.DB().Delete(s.cols.ib_email_locations.Name, dbx.In("id", goneIds...)).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to delete email locations: %w", err)
+	}
+
+	deletedIds := make([]string, 0)
+	for i := 0; i < len(emailIds); i += syncBatchSize {
+		batchSliceEnd := i + syncBatchSize
+		if batchSliceEnd > len(emailIds) {
+			batchSliceEnd = len(emailIds)
+		}
+
+		emailRecords, err := s.app.FindRecordsByIds(s.cols.ib_emails, emailIds[i:batchSliceEnd])
+		if err != nil {
+			return fmt.Errorf("failed to find emails: %w", err)
+		}
+
+		for _, emailRecord := range emailRecords {
+			remaining, err := s.app.FindAllRecords(s.cols.ib_email_locations, dbx.HashExp{"email": emailRecord.Id})
+			if err != nil {
+				return fmt.Errorf("failed to find email locations: %w", err)
+			}
+
+			if len(remaining) == 0 {
+				if emailRecord.GetDateTime("deleted_on_server").IsZero() {
+					deletedIds = append(deletedIds, emailRecord.Id)
+				}
+				continue
+			}
+
+			if err := s.relocate(emailRecord, folder, remaining, stats); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.markDeletedByIds(deletedIds)
+}
+
+// relocate handles an email that is gone from the folder but still has other
+// locations. It counts as moved if one of them was found during this run, and
+// the email points to one of them if it pointed to the folder.
+func (s *accountSync) relocate(emailRecord *core.Record, folder string, remaining []*core.Record, stats *syncStats) error {
+	primary := remaining[0]
+	moved := false
+	for _, location := range remaining {
+		if location.GetString("folder") != folder && !location.GetDateTime("first_seen").Time().Before(s.runStarted().Time()) {
+			primary = location
+			moved = true
+			break
+		}
+	}
+
+	if moved {
+		log.Printf("moved email from folder %s to %s\n", folder, primary.GetString("folder"))
+		stats.Moved++
+	}
+
+	if emailRecord.GetString("folder") != folder {
+		return nil
+	}
+
+	emailRecord.Set("folder", primary.GetString("folder"))
+	emailRecord.Set("mailbox", s.mailboxId(primary.GetString("folder")))
+	emailRecord.Set("uid", primary.GetInt("uid"))
+	if err := s.app.Save(emailRecord); err != nil {
+		return fmt.Errorf("failed to save email: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// lockLease is how long a lock stays valid without heartbeat. A process
+	// that crashed mid-run blocks the account for at most this long.
+	lockLease = 5 * time.Minute
+
+	lockHeartbeat = time.Minute
+)
+
+// ErrLocked is returned if the account is already being synced.
+var ErrLocked = errors.New("account is already being synced")
+
+// ErrLockLost is the cause the context of a lock gets canceled with if the
+// lock was taken over by another sync.
+var ErrLockLost = errors.New("sync lock was lost to another sync")
+
+// lockHolder identifies this process in the locks it holds.
+var lockHolder = func() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d:%s", hostname, os.Getpid(), security.RandomString(8))
+}()
+
+// Lock is the lease of a single sync on an account. It is stored in the
+// database, so it also keeps syncs of other processes away, and extended by
+// a heartbeat until it is released.
+type Lock struct {
+	app    core.App
+	id     string
+	holder string
+
+	// expires is the end of the lease as last stored by this lock.
+	expires time.Time
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// AcquireLock locks the account for a sync. ErrLocked is returned if another
+// sync holds an unexpired lock, an expired lock is taken over.
+func AcquireLock(app core.App, smtpAccount *core.Record) (*Lock, error) {
+	lock := &Lock{
+		app:     app,
+		holder:  lockHolder + ":" + security.RandomString(8),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	lock.ctx, lock.cancel = context.WithCancelCause(context.Background())
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		record, err := txApp.FindFirstRecordByData("ib_sync_locks", "smtp_account", smtpAccount.Id)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+
+			collection, err := txApp.FindCollectionByNameOrId("ib_sync_locks")
+			if err != nil {
+				return err
+			}
+			record = core.NewRecord(collection)
+			record.Set("smtp_account", smtpAccount.Id)
+		} else if record.GetDateTime("expires").Time().After(time.Now()) {
+			return ErrLocked
+		} else {
+			log.Printf("taking over expired sync lock of account %s held by %s\n", smtpAccount.Id, record.GetString("holder"))
+		}
+
+		now := types.NowDateTime()
+		record.Set("holder", lock.holder)
+		record.Set("acquired", now)
+		record.Set("expires", now.Add(lockLease))
+
+		if err := txApp.Save(record); err != nil {
+			return err
+		}
+
+		lock.id = record.Id
+		lock.expires = record.GetDateTime("expires").Time()
+		return nil
+	})
+	if err != nil {
+		lock.cancel(err)
+		if errors.Is(err, ErrLocked) {
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("failed to acquire sync lock: %w", err)
+	}
+
+	go lock.heartbeat()
+
+	return lock, nil
+}
+
+// Context returns a context that is canceled with ErrLockLost as cause once
+// the lock was taken over by another sync, so the sync holding it can stop.
+func (l *Lock) Context() context.Context {
+	return l.ctx
+}
+
+// heartbeat extends the lease until the lock is released or lost.
+func (l *Lock) heartbeat() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(lockHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if !l.beat() {
+				return
+			}
+		}
+	}
+}
+
+// beat extends the lease once. It cancels the context of the lock and
+// returns false if the lock was lost, either because another sync took it
+// over or because it could not be extended before it expired.
+func (l *Lock) beat() bool {
+	err := l.extend()
+	if err == nil {
+		return true
+	}
+
+	log.Printf("failed to extend sync lock %s: %v\n", l.id, err)
+
+	if errors.Is(err, ErrLockLost) || time.Now().After(l.expires) {
+		l.cancel(ErrLockLost)
+		return false
+	}
+
+	return true
+}
+
+// extend pushes the expiry of the lock forward, as long as it is still held
+// by this lock and was not taken over after it expired.
+func (l *Lock) extend() error {
+	expires := types.NowDateTime().Add(lockLease)
+
+	result, err := l.app.DB().Update(
+		"sync_locks",
+		dbx.Params{"expires": expires.String()},
+		dbx.HashExp{"id": l.id, "holder": l.holder},
+	).Execute()
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrLockLost
+	}
+
+	l.expires = expires.Time()
+	return nil
+}
+
+// Release stops the heartbeat and deletes the lock, unless it was taken
+// over in the meantime.
+func (l *Lock) Release() error {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	<-l.stopped
+	l.cancel(nil)
+
+	_, err := l.app.DB().Delete(
+		"sync_locks",
+		dbx.HashExp{"id": l.id, "holder": l.holder},
+	).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to release sync lock: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	_ "github.com/yerTools/imapbackup/src/go/database/migrations"
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestAcquireLock(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	account := testutil.CreateAccount(t, app, nil)
+
+	lock, err := AcquireLock(app, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AcquireLock(app, account); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected %v, got %v", ErrLocked, err)
+	}
+
+	// a crashed sync leaves its lock behind until it expires
+	_, err = app.DB().Update(
+		"sync_locks",
+		dbx.Params{"expires": types.NowDateTime().Add(-time.Second).String()},
+		dbx.HashExp{"id": lock.id},
+	).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	takeover, err := AcquireLock(app, account)
+	if err != nil {
+		t.Fatalf("expected the expired lock to be taken over, got %v", err)
+	}
+	defer takeover.Release()
+
+	if lock.beat() {
+		t.Fatal("expected the heartbeat of the old lock to fail")
+	}
+	if cause := context.Cause(lock.Context()); !errors.Is(cause, ErrLockLost) {
+		t.Fatalf("expected the old lock to be canceled with %v, got %v", ErrLockLost, cause)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := takeover.Context().Err(); err != nil {
+		t.Fatalf("expected releasing the old lock to keep the new one, got %v", err)
+	}
+}
+
+func TestLockBeat(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		change   func(app core.App, lock *Lock) error
+		expected bool
+	}{
+		{
+			name:     "held",
+			change:   func(app core.App, lock *Lock) error { return nil },
+			expected: true,
+		},
+		{
+			name: "taken over",
+			change: func(app core.App, lock *Lock) error {
+				_, err := app.DB().Update("sync_locks", dbx.Params{"holder": "other"}, dbx.HashExp{"id": lock.id}).Execute()
+				return err
+			},
+			expected: false,
+		},
+		{
+			name: "deleted",
+			change: func(app core.App, lock *Lock) error {
+				_, err := app.DB().Delete("sync_locks", dbx.HashExp{"id": lock.id}).Execute()
+				return err
+			},
+			expected: false,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			app, err := tests.NewTestApp()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer app.Cleanup()
+
+			lock, err := AcquireLock(app, testutil.CreateAccount(t, app, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lock.Release()
+
+			if err := s.change(app, lock); err != nil {
+				t.Fatal(err)
+			}
+
+			if held := lock.beat(); held != s.expected {
+				t.Fatalf("expected the lock to be held %v, got %v", s.expected, held)
+			}
+
+			cause := context.Cause(lock.Context())
+			if s.expected && cause != nil {
+				t.Fatalf("expected the context to stay active, got %v", cause)
+			}
+			if !s.expected && !errors.Is(cause, ErrLockLost) {
+				t.Fatalf("expected the context to be canceled with %v, got %v", ErrLockLost, cause)
+			}
+		})
+	}
+}
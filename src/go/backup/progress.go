@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/subscriptions"
+)
+
+const (
+	progressTopicPrefix = "ib_sync_progress/"
+)
+
+// ProgressTopic returns the realtime topic the sync progress of the account
+// is published to. Only the owner of the account and superusers receive it.
+func ProgressTopic(smtpAccountId string) string {
+	return progressTopicPrefix + smtpAccountId
+}
+
+// progress is the message published while an account syncs.
+type progress struct {
+	Run     string `json:"run"`
+	Account string `json:"account"`
+	Status  string `json:"status"`
+
+	Folder      string `json:"folder"`
+	FolderIndex int    `json:"folder_index"`
+	Folders     int    `json:"folders"`
+
+	// Done of Total emails of the current folder are downloaded.
+	Done  int `json:"done"`
+	Total int `json:"total"`
+
+	// ETA estimates the seconds until the current folder is downloaded, it is
+	// null as long as there is nothing to estimate from.
+	ETA *int `json:"eta_seconds"`
+
+	// Stats are the counters of the run so far, including the current folder.
+	Scanned      int   `json:"scanned"`
+	New          int   `json:"new"`
+	Moved        int   `json:"moved"`
+	FlagsUpdated int   `json:"flags_updated"`
+	Failed       int   `json:"failed"`
+	Bytes        int64 `json:"bytes"`
+}
+
+// publish sends the current progress of the run to every realtime client that
+// subscribed to the topic of the account and is allowed to see it.
+func (r *syncRun) publish() {
+	stats := r.stats
+	if r.folderStats != nil {
+		stats.add(*r.folderStats)
+	}
+
+	p := progress{
+		Run:          r.record.Id,
+		Account:      r.smtpAccount.Id,
+		Status:       r.record.GetString("status"),
+		Folder:       r.currentFolder,
+		FolderIndex:  r.folderIndex,
+		Folders:      r.folders,
+		Done:         r.done,
+		Total:        r.total,
+		Scanned:      stats.Scanned,
+		New:          stats.New,
+		Moved:        stats.Moved,
+		FlagsUpdated: stats.FlagsUpdated,
+		Failed:       stats.Failed,
+		Bytes:        stats.Bytes,
+	}
+
+	if r.done > 0 && r.total > r.done {
+		elapsed := time.Since(r.downloadStarted)
+		eta := int((elapsed * time.Duration(r.total-r.done) / time.Duration(r.done)).Seconds())
+		p.ETA = &eta
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("failed to encode sync progress: %v\n", err)
+		return
+	}
+
+	topic := ProgressTopic(r.smtpAccount.Id)
+	message := subscriptions.Message{
+		Name: topic,
+		Data: data,
+	}
+
+	for _, client := range r.app.SubscriptionsBroker().Clients() {
+		if !client.HasSubscription(topic) {
+			continue
+		}
+
+		// the auth is checked on every message, it might have changed since subscribing
+		auth, _ := client.Get(apis.RealtimeClientAuthKey).(*core.Record)
+		if auth == nil || (!auth.IsSuperuser() && auth.Id != r.smtpAccount.GetString("created_by")) {
+			continue
+		}
+
+		client.Send(message)
+	}
+}
+
+// progress records how many emails of the current folder are downloaded and
+// publishes it.
+func (r *syncRun) progress(done int, total int) {
+	if done == 0 {
+		r.downloadStarted = time.Now()
+	}
+	r.done = done
+	r.total = total
+
+	r.publish()
+}
@@ -0,0 +1,85 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/subscriptions"
+
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+// recordingClient keeps the messages sent to it instead of streaming them.
+type recordingClient struct {
+	*subscriptions.DefaultClient
+	messages []subscriptions.Message
+}
+
+func (c *recordingClient) Send(m subscriptions.Message) {
+	c.messages = append(c.messages, m)
+}
+
+func TestPublishAudience(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	cols, err := findCollections(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := testutil.CreateAccount(t, app, nil)
+	run, err := startRun(app, cols, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		name       string
+		collection string
+		email      string
+		topic      string
+		expected   bool
+	}{
+		{"owner", "users", testutil.OwnerEmail, ProgressTopic(account.Id), true},
+		{"superuser", core.CollectionNameSuperusers, "test@example.com", ProgressTopic(account.Id), true},
+		{"other user", "users", "test2@example.com", ProgressTopic(account.Id), false},
+		{"guest", "", "", ProgressTopic(account.Id), false},
+		{"owner without subscription", "users", testutil.OwnerEmail, ProgressTopic("other"), false},
+	}
+
+	clients := make([]*recordingClient, len(scenarios))
+	for i, s := range scenarios {
+		client := &recordingClient{DefaultClient: subscriptions.NewDefaultClient()}
+		client.Subscribe(s.topic)
+		if s.email != "" {
+			auth, err := app.FindAuthRecordByEmail(s.collection, s.email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.Set(apis.RealtimeClientAuthKey, auth)
+		}
+
+		app.SubscriptionsBroker().Register(client)
+		clients[i] = client
+	}
+
+	run.progress(0, 10)
+
+	for i, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			received := len(clients[i].messages) > 0
+			if received != s.expected {
+				t.Fatalf("expected the progress to be received %v, got %v", s.expected, received)
+			}
+			if received && clients[i].messages[0].Name != ProgressTopic(account.Id) {
+				t.Fatalf("expected the topic %s, got %s", ProgressTopic(account.Id), clients[i].messages[0].Name)
+			}
+		})
+	}
+}
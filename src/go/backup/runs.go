@@ -0,0 +1,199 @@
+package backup
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// RunStatusRunning marks a run that has not finished yet.
+	RunStatusRunning = "running"
+	// RunStatusSuccess marks a run that synced every folder.
+	RunStatusSuccess = "success"
+	// RunStatusPartial marks a run that finished, but skipped folders or
+	// emails because of errors.
+	RunStatusPartial = "partial"
+	// RunStatusFailed marks a run that was aborted by an error.
+	RunStatusFailed = "failed"
+)
+
+// syncStats counts what happened during a run or while one of its folders
+// was synced.
+type syncStats struct {
+	Scanned      int
+	New          int
+	Moved        int
+	FlagsUpdated int
+	Failed       int
+	Bytes        int64
+}
+
+func (s *syncStats) add(other syncStats) {
+	s.Scanned += other.Scanned
+	s.New += other.New
+	s.Moved += other.Moved
+	s.FlagsUpdated += other.FlagsUpdated
+	s.Failed += other.Failed
+	s.Bytes += other.Bytes
+}
+
+func (s *syncStats) set(record *core.Record) {
+	record.Set("scanned", s.Scanned)
+	record.Set("new", s.New)
+	record.Set("moved", s.Moved)
+	record.Set("flags_updated", s.FlagsUpdated)
+	record.Set("failed", s.Failed)
+	record.Set("bytes", s.Bytes)
+}
+
+// finishRecord stores the stats and the outcome of a run or folder. Skipped
+// folders are passed as their errors.
+func finishRecord(app core.App, record *core.Record, stats *syncStats, err error, skipped []string) error {
+	stats.set(record)
+	record.Set("finished", types.NowDateTime())
+
+	switch {
+	case err != nil:
+		record.Set("status", RunStatusFailed)
+		record.Set("error", strings.Join(append(skipped, err.Error()), "\n"))
+	case len(skipped) > 0 || stats.Failed > 0:
+		record.Set("status", RunStatusPartial)
+		record.Set("error", strings.Join(skipped, "\n"))
+	default:
+		record.Set("status", RunStatusSuccess)
+	}
+
+	return app.Save(record)
+}
+
+// syncRun records a single sync of an account in 'ib_sync_runs'.
+type syncRun struct {
+	app         core.App
+	cols        *collections
+	smtpAccount *core.Record
+	record      *core.Record
+	stats       syncStats
+
+	// skipped holds the error of every folder that failed.
+	skipped []string
+
+	// the state of the current folder, which is only published as progress
+	folders         int
+	folderIndex     int
+	currentFolder   string
+	folderStats     *syncStats
+	done            int
+	total           int
+	downloadStarted time.Time
+}
+
+// skip remembers a folder that failed while the run went on, so that the run
+// ends up partial.
+func (r *syncRun) skip(folder string, err error) {
+	r.skipped = append(r.skipped, fmt.Sprintf("folder %s: %v", folder, err))
+}
+
+// startRun creates the record of a new run. It must only be called while the
+// lock of the account is held, so every run that is still marked as running
+// belongs to a process that died and is marked as failed.
+func startRun(app core.App, cols *collections, smtpAccount *core.Record) (*syncRun, error) {
+	if err := failInterruptedRuns(app, cols, smtpAccount); err != nil {
+		return nil, err
+	}
+
+	record := core.NewRecord(cols.ib_sync_runs)
+	record.Set("smtp_account", smtpAccount.Id)
+	record.Set("status", RunStatusRunning)
+	record.Set("started", types.NowDateTime())
+
+	if err := app.Save(record); err != nil {
+		return nil, fmt.Errorf("failed to save sync run: %w", err)
+	}
+
+	return &syncRun{
+		app:         app,
+		cols:        cols,
+		smtpAccount: smtpAccount,
+		record:      record,
+	}, nil
+}
+
+// failInterruptedRuns marks the runs of the account that are still running
+// as failed, together with the folder they were syncing.
+func failInterruptedRuns(app core.App, cols *collections, smtpAccount *core.Record) error {
+	interrupted, err := app.FindAllRecords(cols.ib_sync_runs, dbx.HashExp{
+		"smtp_account": smtpAccount.Id,
+		"status":       RunStatusRunning,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find interrupted sync runs: %w", err)
+	}
+
+	for _, record := range interrupted {
+		folders, err := app.FindAllRecords(cols.ib_sync_run_folders, dbx.HashExp{
+			"sync_run": record.Id,
+			"status":   RunStatusRunning,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to find interrupted sync run folders: %w", err)
+		}
+
+		for _, stale := range append(folders, record) {
+			stale.Set("status", RunStatusFailed)
+			stale.Set("error", "interrupted")
+			stale.Set("finished", types.NowDateTime())
+			if err := app.Save(stale); err != nil {
+				return fmt.Errorf("failed to save interrupted sync run: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// folder syncs the folder with fn and records its stats as a child of the run.
+func (r *syncRun) folder(folder string, fn func(stats *syncStats) error) error {
+	record := core.NewRecord(r.cols.ib_sync_run_folders)
+	record.Set("sync_run", r.record.Id)
+	record.Set("folder", folder)
+	record.Set("status", RunStatusRunning)
+	record.Set("started", types.NowDateTime())
+
+	if err := r.app.Save(record); err != nil {
+		return fmt.Errorf("failed to save sync run folder: %w", err)
+	}
+
+	stats := syncStats{}
+
+	r.folderIndex++
+	r.currentFolder = folder
+	r.folderStats = &stats
+	r.done, r.total = 0, 0
+	r.publish()
+
+	err := fn(&stats)
+
+	r.folderStats = nil
+	r.stats.add(stats)
+
+	if saveErr := finishRecord(r.app, record, &stats, err, nil); saveErr != nil {
+		log.Printf("failed to save sync run folder: %v\n", saveErr)
+	}
+
+	return err
+}
+
+// finish stores the totals and the outcome of the run.
+func (r *syncRun) finish(err error) {
+	if saveErr := finishRecord(r.app, r.record, &r.stats, err, r.skipped); saveErr != nil {
+		log.Printf("failed to save sync run: %v\n", saveErr)
+	}
+
+	r.publish()
+}
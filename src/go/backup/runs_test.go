@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestStartRunFailsInterruptedRuns(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	cols, err := findCollections(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := testutil.CreateAccount(t, app, nil)
+	other := testutil.CreateAccount(t, app, nil)
+
+	newRun := func(account *core.Record, status string) *core.Record {
+		record := core.NewRecord(cols.ib_sync_runs)
+		record.Set("smtp_account", account.Id)
+		record.Set("status", status)
+		record.Set("started", types.NowDateTime())
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	newFolder := func(run *core.Record, status string) *core.Record {
+		record := core.NewRecord(cols.ib_sync_run_folders)
+		record.Set("sync_run", run.Id)
+		record.Set("folder", "INBOX")
+		record.Set("status", status)
+		record.Set("started", types.NowDateTime())
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	interrupted := newRun(account, RunStatusRunning)
+	finished := newRun(account, RunStatusSuccess)
+	otherAccount := newRun(other, RunStatusRunning)
+
+	scenarios := []struct {
+		name     string
+		record   *core.Record
+		status   string
+		finished bool
+	}{
+		{"interrupted run", interrupted, RunStatusFailed, true},
+		{"interrupted folder", newFolder(interrupted, RunStatusRunning), RunStatusFailed, true},
+		{"completed folder", newFolder(interrupted, RunStatusSuccess), RunStatusSuccess, false},
+		{"completed run", finished, RunStatusSuccess, false},
+		{"run of other account", otherAccount, RunStatusRunning, false},
+	}
+
+	run, err := startRun(app, cols, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			record, err := app.FindRecordById(s.record.Collection(), s.record.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status := record.GetString("status"); status != s.status {
+				t.Fatalf("expected status %s, got %s", s.status, status)
+			}
+			if finished := !record.GetDateTime("finished").IsZero(); finished != s.finished {
+				t.Fatalf("expected finished to be set %v, got %v", s.finished, finished)
+			}
+		})
+	}
+
+	if status := run.record.GetString("status"); status != RunStatusRunning {
+		t.Fatalf("expected the new run to be running, got %s", status)
+	}
+
+	run.finish(errors.New("connection refused"))
+
+	record, err := app.FindRecordById(cols.ib_sync_runs, run.record.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.GetString("status") != RunStatusFailed || record.GetDateTime("finished").IsZero() {
+		t.Fatalf("expected the finished run to be failed with finished date, got %s %v", record.GetString("status"), record.GetDateTime("finished"))
+	}
+}
@@ -0,0 +1,76 @@
+package backup
+
+import (
+	"log"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// DefaultSchedule is used for accounts without their own cron expression.
+	DefaultSchedule = "*/15 * * * *"
+
+	jobPrefix = "ib_sync_"
+)
+
+// AccountSchedule returns the cron expression the account is synced with.
+func AccountSchedule(smtpAccount *core.Record) string {
+	if schedule := smtpAccount.GetString("sync_schedule"); schedule != "" {
+		return schedule
+	}
+	return DefaultSchedule
+}
+
+// schedule registers the cron job of the account, replacing a previous one.
+// Paused and offline accounts get no job at all.
+func schedule(app core.App, smtpAccount *core.Record) error {
+	jobID := jobPrefix + smtpAccount.Id
+
+	if smtpAccount.GetBool("sync_paused") || smtpAccount.GetBool("offline") {
+		app.Cron().Remove(jobID)
+		return nil
+	}
+
+	// the job only keeps the id, so every run works with the current record
+	id := smtpAccount.Id
+	return app.Cron().Add(jobID, AccountSchedule(smtpAccount), func() {
+		if err := SyncAccount(app, id, Options{}); err != nil {
+			log.Printf("scheduled sync of account %s failed: %v\n", id, err)
+		}
+	})
+}
+
+// registerScheduler schedules every account once the app serves and keeps
+// the jobs in line with the account records afterwards.
+func registerScheduler(app core.App) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		smtpAccounts, err := se.App.FindAllRecords("ib_smtp_accounts")
+		if err != nil {
+			return err
+		}
+
+		for _, smtpAccount := range smtpAccounts {
+			if err := schedule(se.App, smtpAccount); err != nil {
+				log.Printf("failed to schedule sync of account %s: %v\n", smtpAccount.Id, err)
+			}
+		}
+
+		return se.Next()
+	})
+
+	reschedule := func(e *core.RecordEvent) error {
+		// e.App might be a finished transaction, jobs have to use the main app
+		if err := schedule(app, e.Record); err != nil {
+			log.Printf("failed to schedule sync of account %s: %v\n", e.Record.Id, err)
+		}
+		return e.Next()
+	}
+
+	app.OnRecordAfterCreateSuccess("ib_smtp_accounts").BindFunc(reschedule)
+	app.OnRecordAfterUpdateSuccess("ib_smtp_accounts").BindFunc(reschedule)
+
+	app.OnRecordAfterDeleteSuccess("ib_smtp_accounts").BindFunc(func(e *core.RecordEvent) error {
+		app.Cron().Remove(jobPrefix + e.Record.Id)
+		return e.Next()
+	})
+}
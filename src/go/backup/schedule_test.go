@@ -0,0 +1,73 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/tests"
+
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestRegisterScheduler(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	registerScheduler(app)
+
+	account := testutil.CreateAccount(t, app, nil)
+
+	// expression returns the cron expression of the account's job, or an
+	// empty string if it has none
+	expression := func() string {
+		for _, job := range app.Cron().Jobs() {
+			if job.Id() == jobPrefix+account.Id {
+				return job.Expression()
+			}
+		}
+		return ""
+	}
+
+	if result := expression(); result != DefaultSchedule {
+		t.Fatalf("expected a new account to be synced with %q, got %q", DefaultSchedule, result)
+	}
+
+	scenarios := []struct {
+		name     string
+		field    string
+		value    any
+		expected string
+	}{
+		{"own schedule", "sync_schedule", "0 * * * *", "0 * * * *"},
+		{"paused", "sync_paused", true, ""},
+		{"resumed", "sync_paused", false, "0 * * * *"},
+		{"default schedule", "sync_schedule", "", DefaultSchedule},
+		{"offline", "offline", true, ""},
+		{"online", "offline", false, DefaultSchedule},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			account.Set(s.field, s.value)
+			if err := app.Save(account); err != nil {
+				t.Fatal(err)
+			}
+
+			if result := expression(); result != s.expected {
+				t.Fatalf("expected the job %q, got %q", s.expected, result)
+			}
+		})
+	}
+
+	t.Run("deleted", func(t *testing.T) {
+		if err := app.Delete(account); err != nil {
+			t.Fatal(err)
+		}
+
+		if result := expression(); result != "" {
+			t.Fatalf("expected the job to be removed, got %q", result)
+		}
+	})
+}
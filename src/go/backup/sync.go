@@ -0,0 +1,832 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+
+	"github.com/BrianLeishman/go-imap"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+
+	"github.com/yerTools/imapbackup/src/go/connect"
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+)
+
+const (
+	syncBatchSize = 50
+)
+
+type collections struct {
+	ib_smtp_accounts            *core.Collection
+	ib_sync_runs                *core.Collection
+	ib_sync_run_folders         *core.Collection
+	ib_sync_failures            *core.Collection
+	ib_folders                  *core.Collection
+	ib_emails                   *core.Collection
+	ib_email_locations          *core.Collection
+	ib_email_flags              *core.Collection
+	ib_email_labels             *core.Collection
+	ib_email_from_addresses     *core.Collection
+	ib_email_to_addresses       *core.Collection
+	ib_email_reply_to_addresses *core.Collection
+	ib_email_cc_addresses       *core.Collection
+	ib_email_bcc_addresses      *core.Collection
+	ib_email_attachments        *core.Collection
+}
+
+func findCollections(app core.App) (*collections, error) {
+	cols := &collections{}
+
+	for _, c := range []struct {
+		dest *(*core.Collection)
+		name string
+	}{
+		{&cols.ib_smtp_accounts, "ib_smtp_accounts"},
+		{&cols.ib_sync_runs, "ib_sync_runs"},
+		{&cols.ib_sync_run_folders, "ib_sync_run_folders"},
+		{&cols.ib_sync_failures, "ib_sync_failures"},
+		{&cols.ib_folders, "ib_folders"},
+		{&cols.ib_emails, "ib_emails"},
+		{&cols.ib_email_locations, "ib_email_locations"},
+		{&cols.ib_email_flags, "ib_email_flags"},
+		{&cols.ib_email_labels, "ib_email_labels"},
+		{&cols.ib_email_from_addresses, "ib_email_from_addresses"},
+		{&cols.ib_email_to_addresses, "ib_email_to_addresses"},
+		{&cols.ib_email_reply_to_addresses, "ib_email_reply_to_addresses"},
+		{&cols.ib_email_cc_addresses, "ib_email_cc_addresses"},
+		{&cols.ib_email_bcc_addresses, "ib_email_bcc_addresses"},
+		{&cols.ib_email_attachments, "ib_email_attachments"},
+	} {
+		collection, err := app.FindCollectionByNameOrId(c.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find '%s' collection: %w", c.name, err)
+		}
+		*c.dest = collection
+	}
+
+	return cols, nil
+}
+
+// Options limit what a sync covers.
+type Options struct {
+	// Folders limits the sync to these folders. Every folder is synced if it is empty.
+	Folders []string
+}
+
+// SyncAll backs up every SMTP account that is not paused, one after another.
+// An account that fails does not stop the others, the returned error joins
+// the errors of all failed accounts.
+func SyncAll(app core.App, options Options) error {
+	log.Printf("syncing mails with batch size %d ...\n", syncBatchSize)
+
+	cols, err := findCollections(app)
+	if err != nil {
+		return err
+	}
+
+	// offline accounts only hold imported emails and have no server
+	smtpAccounts, err := app.FindAllRecords(cols.ib_smtp_accounts, dbx.HashExp{"offline": false, "sync_paused": false})
+	if err != nil {
+		return fmt.Errorf("failed to find SMTP accounts: %w", err)
+	}
+
+	log.Printf("found %d SMTP account(s)\n", len(smtpAccounts))
+
+	errs := make([]error, 0)
+	for _, smtpAccount := range smtpAccounts {
+		if err := syncLocked(app, cols, smtpAccount, options); err != nil {
+			log.Printf("failed to sync account %s: %v\n", smtpAccount.Id, err)
+			errs = append(errs, fmt.Errorf("account %s: %w", smtpAccount.Id, err))
+		}
+	}
+
+	log.Println("syncing done")
+
+	return errors.Join(errs...)
+}
+
+// SyncAccount backs up the 'ib_smtp_accounts' record with the given id, even
+// if its schedule is paused.
+func SyncAccount(app core.App, id string, options Options) error {
+	cols, smtpAccount, err := findAccount(app, id)
+	if err != nil {
+		return err
+	}
+
+	return syncLocked(app, cols, smtpAccount, options)
+}
+
+// StartSync locks the account and syncs it in the background. It returns the
+// id of the new 'ib_sync_runs' record, or ErrLocked right away if the account
+// is already being synced.
+func StartSync(app core.App, id string, options Options) (string, error) {
+	cols, smtpAccount, err := findAccount(app, id)
+	if err != nil {
+		return "", err
+	}
+
+	lock, run, err := beginSync(app, cols, smtpAccount)
+	if err != nil {
+		return "", err
+	}
+
+	go func() {
+		if err := finishSync(app, cols, smtpAccount, options, lock, run); err != nil {
+			log.Printf("failed to sync account %s: %v\n", smtpAccount.Id, err)
+		}
+	}()
+
+	return run.record.Id, nil
+}
+
+// findAccount returns the collections and the account that can be synced.
+func findAccount(app core.App, id string) (*collections, *core.Record, error) {
+	cols, err := findCollections(app)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	smtpAccount, err := app.FindRecordById(cols.ib_smtp_accounts, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find SMTP account %s: %w", id, err)
+	}
+	if smtpAccount.GetBool("offline") {
+		return nil, nil, fmt.Errorf("SMTP account %s is offline and can not be synced", id)
+	}
+
+	return cols, smtpAccount, nil
+}
+
+// syncLocked syncs the account while holding its lock, so that cron ticks and
+// manual triggers never sync the same account twice at a time. Every sync is
+// recorded as run in 'ib_sync_runs'.
+func syncLocked(app core.App, cols *collections, smtpAccount *core.Record, options Options) error {
+	lock, run, err := beginSync(app, cols, smtpAccount)
+	if err != nil {
+		return err
+	}
+
+	return finishSync(app, cols, smtpAccount, options, lock, run)
+}
+
+// beginSync acquires the lock of the account and starts a new run.
+func beginSync(app core.App, cols *collections, smtpAccount *core.Record) (*Lock, *syncRun, error) {
+	lock, err := AcquireLock(app, smtpAccount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	run, err := startRun(app, cols, smtpAccount)
+	if err != nil {
+		if releaseErr := lock.Release(); releaseErr != nil {
+			log.Println(releaseErr)
+		}
+		return nil, nil, err
+	}
+
+	return lock, run, nil
+}
+
+// finishSync syncs the account, records the outcome of the run and releases the lock.
+func finishSync(app core.App, cols *collections, smtpAccount *core.Record, options Options, lock *Lock, run *syncRun) error {
+	defer func() {
+		if err := lock.Release(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	err := syncAccount(lock.Context(), app, cols, smtpAccount, run, options)
+	run.finish(err)
+
+	return err
+}
+
+// accountSync holds everything needed while a single account gets synced.
+type accountSync struct {
+	app         core.App
+	cols        *collections
+	run         *syncRun
+	im          *imapclient.Client
+	smtpAccount *core.Record
+
+	// folders holds the 'ib_folders' record of every folder by its name.
+	folders map[string]*core.Record
+
+	// allMail is the folder every message of a Gmail account is synced
+	// through, it is empty for other servers.
+	allMail string
+}
+
+// syncAccount syncs the selected folders of the account. It stops as soon as
+// ctx is done, as the account is synced by someone else then.
+func syncAccount(ctx context.Context, app core.App, cols *collections, smtpAccount *core.Record, run *syncRun, options Options) error {
+	log.Printf("syncing user %s on %s with port %d ...\n", smtpAccount.GetString("username"), smtpAccount.GetString("host"), smtpAccount.GetInt("port"))
+
+	rules, err := AccountFolderRules(smtpAccount)
+	if err != nil {
+		return err
+	}
+
+	im, err := connect.Account(ctx, app, smtpAccount)
+	if err != nil {
+		if imapclient.IsCertificateError(err) {
+			return fmt.Errorf("TLS certificate rejected: %w", err)
+		}
+		return err
+	}
+	defer im.Logout()
+
+	// closing the connection aborts the command that is running
+	stop := context.AfterFunc(ctx, func() {
+		im.Close()
+	})
+	defer stop()
+
+	s := &accountSync{
+		app:         app,
+		cols:        cols,
+		run:         run,
+		im:          im,
+		smtpAccount: smtpAccount,
+	}
+
+	mailboxes, err := im.List()
+	if err != nil {
+		return fmt.Errorf("failed to get folders: %w", err)
+	}
+
+	folders := make([]string, 0, len(mailboxes))
+	for _, mailbox := range mailboxes {
+		// parents of other folders may not contain any messages themselves
+		if mailbox.Selectable() {
+			folders = append(folders, mailbox.Name)
+		}
+	}
+
+	log.Printf("found %d folder(s)\n", len(folders))
+
+	if err := s.syncFolderTree(mailboxes); err != nil {
+		return err
+	}
+
+	s.allMail = allMailFolder(im, mailboxes)
+
+	// explicitly requested folders are synced regardless of the folder rules
+	var selected []string
+	if len(options.Folders) > 0 {
+		selected = selectFolders(folders, options.Folders, run)
+
+		// a change of any label shows up in All Mail as well
+		if s.allMail != "" && len(selected) > 0 {
+			requested := selected
+			selected = []string{s.allMail}
+			for i := range mailboxes {
+				if isOutsideAllMail(&mailboxes[i]) && slices.Contains(requested, mailboxes[i].Name) {
+					selected = append(selected, mailboxes[i].Name)
+				}
+			}
+		}
+	} else {
+		for _, choice := range chooseFolders(mailboxes, rules, s.allMail) {
+			if choice.Sync {
+				selected = append(selected, choice.Name)
+			} else if slices.Contains(folders, choice.Name) {
+				log.Printf("not syncing folder %s: %s\n", choice.Name, choice.Reason)
+			}
+		}
+	}
+	run.folders = len(selected)
+
+	for _, folder := range selected {
+		if ctx.Err() != nil {
+			return fmt.Errorf("sync aborted: %w", context.Cause(ctx))
+		}
+
+		log.Printf("syncing folder %s ...\n", folder)
+
+		err := run.folder(folder, func(stats *syncStats) error {
+			return s.syncFolder(folder, stats)
+		})
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("sync aborted in folder %s: %w", folder, context.Cause(ctx))
+		}
+
+		// a broken connection would only fail every remaining folder
+		if imapclient.IsConnectionError(err) {
+			return fmt.Errorf("failed to sync folder %s: %w", folder, err)
+		}
+		log.Printf("skipping folder %s: %v\n", folder, err)
+		run.skip(folder, err)
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("sync aborted: %w", context.Cause(ctx))
+	}
+
+	if s.allMail != "" {
+		if err := s.forgetLabelFolders(s.allMail); err != nil {
+			return err
+		}
+	}
+
+	return s.applyDeletionPolicy()
+}
+
+// selectFolders returns the requested folders that exist on the server. The
+// missing ones are skipped in the run.
+func selectFolders(serverFolders []string, requested []string, run *syncRun) []string {
+	existing := make(map[string]bool, len(serverFolders))
+	for _, folder := range serverFolders {
+		existing[folder] = true
+	}
+
+	selected := make([]string, 0, len(requested))
+	for _, folder := range requested {
+		if !existing[folder] {
+			run.skip(folder, errors.New("folder does not exist on the server"))
+			continue
+		}
+		selected = append(selected, folder)
+	}
+
+	return selected
+}
+
+// findFolder returns the stored sync state of the given folder or a new,
+// unsaved record if the folder has never been synced before.
+func (s *accountSync) findFolder(folder string) (*core.Record, error) {
+	if record, ok := s.folders[folder]; ok {
+		return record, nil
+	}
+
+	record, err := s.app.FindFirstRecordByFilter(
+		s.cols.ib_folders,
+		"smtp_account = {:smtp_account_id} && name = {:name}",
+		dbx.Params{
+			"smtp_account_id": s.smtpAccount.Id,
+			"name":            folder,
+		},
+	)
+	if err == nil {
+		return record, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	record = core.NewRecord(s.cols.ib_folders)
+	record.Set("smtp_account", s.smtpAccount.Id)
+	record.Set("name", folder)
+
+	return record, nil
+}
+
+func (s *accountSync) syncFolder(folder string, stats *syncStats) error {
+	app, cols, im, smtpAccount := s.app, s.cols, s.im, s.smtpAccount
+
+	condStore := im.Capabilities.Has("CONDSTORE")
+
+	status, err := im.Examine(folder, condStore)
+	if err != nil {
+		return fmt.Errorf("failed to select folder: %w", err)
+	}
+
+	folderRecord, err := s.findFolder(folder)
+	if err != nil {
+		return fmt.Errorf("failed to find folder state: %w", err)
+	}
+
+	lastUID := folderRecord.GetInt("last_uid")
+	if status.UIDValidity == 0 || folderRecord.GetInt("uid_validity") != int(status.UIDValidity) {
+		if folderRecord.GetInt("uid_validity") != 0 {
+			log.Printf("UIDVALIDITY of folder %s changed from %d to %d, rescanning\n", folder, folderRecord.GetInt("uid_validity"), status.UIDValidity)
+		}
+		lastUID = 0
+	}
+
+	if lastUID > 0 {
+		var changedSince uint64
+		if status.HighestModSeq > 0 {
+			changedSince, _ = strconv.ParseUint(folderRecord.GetString("highest_modseq"), 10, 64)
+		}
+
+		// emails archived before their Gmail attributes were stored are
+		// all compared once to get them
+		if changedSince > 0 && im.IsGmail() {
+			missing, err := s.missingGmail(folder)
+			if err != nil {
+				return err
+			}
+			if missing {
+				changedSince = 0
+			}
+		}
+
+		updated, err := s.syncFlags(folder, status.UIDValidity, lastUID, changedSince)
+		if err != nil {
+			return err
+		}
+		stats.FlagsUpdated += updated
+	}
+
+	serverUIDs, err := im.UIDSearch("ALL")
+	if err != nil {
+		return fmt.Errorf("failed to get UIDs: %w", err)
+	}
+	stats.Scanned = len(serverUIDs)
+
+	failures, err := s.loadFailures(folder, status.UIDValidity)
+	if err != nil {
+		return err
+	}
+
+	retryUIDs, err := failures.retryUIDs(serverUIDs)
+	if err != nil {
+		return err
+	}
+
+	uids := make([]int, 0)
+	for _, uid := range serverUIDs {
+		if uid > lastUID {
+			uids = append(uids, uid)
+		}
+	}
+	log.Printf("found %d new email(s) since UID %d\n", len(uids), lastUID)
+
+	retries := 0
+	for _, uid := range retryUIDs {
+		// messages above lastUID are part of the new ones anyway
+		if uid <= lastUID {
+			uids = append(uids, uid)
+			retries++
+		}
+	}
+	if retries > 0 {
+		log.Printf("retrying %d email(s) that failed before\n", retries)
+	}
+
+	// failed collects the error of every message that could not be synced,
+	// they are queued and retried on the next run
+	failed := make(map[int]error)
+
+	syncMails := make([]int, 0, len(uids))
+
+	// gmailMessages holds the Gmail attributes of the new messages, it stays
+	// empty for other servers
+	gmailMessages := make(map[int]*imapclient.GmailMessage)
+
+	for i := 0; i < len(uids); i += syncBatchSize {
+		batchSliceEnd := i + syncBatchSize
+		if batchSliceEnd > len(uids) {
+			batchSliceEnd = len(uids)
+		}
+		uidsBatch := uids[i:batchSliceEnd]
+
+		emailOverview, err := im.GetOverviews(uidsBatch...)
+		if err != nil {
+			if imapclient.IsConnectionError(err) {
+				return fmt.Errorf("failed to get email overviews: %w", err)
+			}
+			log.Printf("failed to get email overviews: %v\n", err)
+			for _, uid := range uidsBatch {
+				failed[uid] = fmt.Errorf("failed to get email overview: %w", err)
+			}
+			continue
+		}
+
+		if im.IsGmail() {
+			batchMessages, err := im.FetchGmail(uidsBatch...)
+			if err != nil {
+				if imapclient.IsConnectionError(err) {
+					return fmt.Errorf("failed to get Gmail attributes: %w", err)
+				}
+				log.Printf("failed to get Gmail attributes: %v\n", err)
+				for _, uid := range uidsBatch {
+					failed[uid] = fmt.Errorf("failed to get Gmail attributes: %w", err)
+				}
+				continue
+			}
+			for uid, message := range batchMessages {
+				gmailMessages[uid] = message
+			}
+		}
+
+		for _, uid := range uidsBatch {
+			overview, ok := emailOverview[uid]
+			if !ok {
+				failed[uid] = errors.New("email overview could not be fetched")
+				continue
+			}
+			if _, ok := gmailMessages[uid]; im.IsGmail() && !ok {
+				failed[uid] = errors.New("Gmail attributes could not be fetched")
+				continue
+			}
+
+			existingMails, err := s.findExisting(overview, gmailMessages[uid])
+			if err != nil {
+				failed[uid] = err
+				continue
+			}
+
+			if len(existingMails) == 0 {
+				syncMails = append(syncMails, overview.UID)
+				continue
+			}
+
+			for _, existingMail := range existingMails {
+				if err := s.updateExisting(folder, status.UIDValidity, existingMail, overview, gmailMessages[uid], stats); err != nil {
+					failed[uid] = err
+					break
+				}
+			}
+		}
+	}
+
+	log.Printf("found %d email(s) to sync\n", len(syncMails))
+	s.run.progress(0, len(syncMails))
+
+	for i := 0; i < len(syncMails); i += syncBatchSize {
+		batchSliceEnd := i + syncBatchSize
+		if batchSliceEnd > len(syncMails) {
+			batchSliceEnd = len(syncMails)
+		}
+		uidsBatch := syncMails[i:batchSliceEnd]
+
+		emails, err := im.GetEmails(uidsBatch...)
+		if err != nil {
+			if imapclient.IsConnectionError(err) {
+				return fmt.Errorf("failed to get emails: %w", err)
+			}
+			log.Printf("failed to get emails: %v\n", err)
+			for _, uid := range uidsBatch {
+				failed[uid] = fmt.Errorf("failed to get email: %w", err)
+			}
+			continue
+		}
+
+		for _, uid := range uidsBatch {
+			email, ok := emails[uid]
+			if !ok {
+				log.Printf("failed to sync email with UID %d: email could not be fetched\n", uid)
+				failed[uid] = errors.New("email could not be fetched")
+				continue
+			}
+
+			err = app.RunInTransaction(func(txApp core.App) error {
+				emailRecord, err := saveEmail(txApp, cols, smtpAccount, folder, folderRecord.Id, email, gmailMessages[uid])
+				if err != nil {
+					return err
+				}
+				_, err = locate(txApp, cols, emailRecord, folder, status.UIDValidity, email.UID)
+				return err
+			})
+			if err != nil {
+				log.Printf("failed to sync email: %v\n", err)
+				failed[uid] = err
+				continue
+			}
+
+			stats.New++
+			stats.Bytes += int64(len(email.Raw))
+		}
+
+		log.Printf("synced %d/%d email(s)\n", batchSliceEnd, len(syncMails))
+		s.run.progress(batchSliceEnd, len(syncMails))
+	}
+
+	stats.Failed = len(failed)
+
+	if err := failures.update(uids, failed); err != nil {
+		return err
+	}
+
+	if err := s.markDeleted(folder, status.UIDValidity, serverUIDs, stats); err != nil {
+		return err
+	}
+
+	// failed messages are kept in the retry queue, so the folder state can
+	// move past them
+	for _, uid := range uids {
+		if uid > lastUID {
+			lastUID = uid
+		}
+	}
+
+	folderRecord.Set("uid_validity", status.UIDValidity)
+	folderRecord.Set("last_uid", lastUID)
+	if status.HighestModSeq > 0 {
+		folderRecord.Set("highest_modseq", strconv.FormatUint(status.HighestModSeq, 10))
+	} else {
+		folderRecord.Set("highest_modseq", "")
+	}
+
+	if err := app.Save(folderRecord); err != nil {
+		return fmt.Errorf("failed to save folder state: %w", err)
+	}
+
+	return nil
+}
+
+// updateExisting brings an already archived copy of the message up to date
+// with its flags and records where it was found. A message that is new in the
+// folder is either a copy of one that is still in another folder, a message
+// that was moved here during this run or one that reappeared on the server.
+// The Gmail attributes are only given for Gmail accounts.
+func (s *accountSync) updateExisting(folder string, uidValidity uint32, existingMail *core.Record, overview *imap.Email, message *imapclient.GmailMessage, stats *syncStats) error {
+	changed, err := s.updateFlags(existingMail, overview.Flags)
+	if err != nil {
+		return fmt.Errorf("failed to update flags of existing email: %w", err)
+	}
+	if message != nil {
+		labelsChanged, err := s.updateGmail(existingMail, message)
+		if err != nil {
+			return err
+		}
+		changed = changed || labelsChanged
+	}
+	if changed {
+		stats.FlagsUpdated++
+	}
+
+	isNew, err := locate(s.app, s.cols, existingMail, folder, uidValidity, overview.UID)
+	if err != nil {
+		return err
+	}
+	if !isNew {
+		return nil
+	}
+
+	deleted := existingMail.GetDateTime("deleted_on_server")
+	switch {
+	case deleted.IsZero():
+		log.Printf("found copy of email in folder %s\n", folder)
+		return nil
+	case !deleted.Time().Before(s.runStarted().Time()):
+		log.Printf("moved email from folder %s to %s\n", existingMail.GetString("folder"), folder)
+		stats.Moved++
+	default:
+		log.Printf("email reappeared on the server in folder %s\n", folder)
+	}
+
+	existingMail.Set("folder", folder)
+	existingMail.Set("mailbox", s.mailboxId(folder))
+	existingMail.Set("uid", overview.UID)
+	existingMail.Set("deleted_on_server", "")
+	if err := s.app.Save(existingMail); err != nil {
+		return fmt.Errorf("failed to save existing email: %w", err)
+	}
+
+	return nil
+}
+
+// findDuplicates returns the archived emails of the account that are the same
+// message as the given email.
+func findDuplicates(app core.App, smtpAccount *core.Record, email *imap.Email) ([]*core.Record, error) {
+	existingMails, err := app.FindRecordsByFilter(
+		"ib_emails",
+		`smtp_account.id = {:smtp_account_id} &&
+		message_id = {:message_id} &&
+		size = {:size} &&
+		subject = {:subject}`,
+		"",
+		0,
+		0,
+		dbx.Params{
+			"smtp_account_id": smtpAccount.Id,
+			"message_id":      email.MessageID,
+			"size":            email.Size,
+			"subject":         email.Subject,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find existing mails: %w", err)
+	}
+
+	duplicates := make([]*core.Record, 0, len(existingMails))
+	for _, existingMail := range existingMails {
+		received := existingMail.GetDateTime("received")
+		sent := existingMail.GetDateTime("sent")
+		if email.Received.Unix() == received.Unix() && email.Sent.Unix() == sent.Unix() {
+			duplicates = append(duplicates, existingMail)
+		}
+	}
+
+	return duplicates, nil
+}
+
+func saveEmail(txApp core.App, cols *collections, smtpAccount *core.Record, folder string, mailbox string, email *imapclient.Email, gmail *imapclient.GmailMessage) (*core.Record, error) {
+	email_record := core.NewRecord(cols.ib_emails)
+
+	raw_file, err := filesystem.NewFileFromBytes(email.Raw, "message.eml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create raw message file: %w", err)
+	}
+	raw_sha256 := sha256.Sum256(email.Raw)
+
+	email_record.Set("smtp_account", smtpAccount.Id)
+	email_record.Set("folder", folder)
+	email_record.Set("mailbox", mailbox)
+	email_record.Set("received", email.Received)
+	email_record.Set("sent", email.Sent)
+	email_record.Set("size", email.Size)
+	email_record.Set("subject", email.Subject)
+	email_record.Set("uid", email.UID)
+	email_record.Set("message_id", email.MessageID)
+	email_record.Set("text", email.Text)
+	email_record.Set("html", email.HTML)
+	email_record.Set("raw", raw_file)
+	email_record.Set("raw_sha256", hex.EncodeToString(raw_sha256[:]))
+	if gmail != nil {
+		email_record.Set("gmail_msgid", strconv.FormatUint(gmail.MsgID, 10))
+		email_record.Set("gmail_thrid", strconv.FormatUint(gmail.ThrID, 10))
+	}
+
+	err = txApp.Save(email_record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save email record: %w", err)
+	}
+
+	for index, flag := range email.Flags {
+		email_flag := core.NewRecord(cols.ib_email_flags)
+		email_flag.Set("email", email_record.Id)
+		email_flag.Set("index", index)
+		email_flag.Set("flag", flag)
+
+		err := txApp.Save(email_flag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save email flag: %w", err)
+		}
+	}
+
+	if gmail != nil {
+		for index, label := range gmail.Labels {
+			email_label := core.NewRecord(cols.ib_email_labels)
+			email_label.Set("email", email_record.Id)
+			email_label.Set("index", index)
+			email_label.Set("label", label)
+
+			err := txApp.Save(email_label)
+			if err != nil {
+				return nil, fmt.Errorf("failed to save email label: %w", err)
+			}
+		}
+	}
+
+	for _, a := range []struct {
+		collection *core.Collection
+		addresses  imap.EmailAddresses
+		debug      string
+	}{
+		{cols.ib_email_from_addresses, email.From, "from"},
+		{cols.ib_email_to_addresses, email.To, "to"},
+		{cols.ib_email_reply_to_addresses, email.ReplyTo, "reply to"},
+		{cols.ib_email_cc_addresses, email.CC, "cc"},
+		{cols.ib_email_bcc_addresses, email.BCC, "bcc"},
+	} {
+		for email_address, display_name := range a.addresses {
+			email_address_record := core.NewRecord(a.collection)
+			email_address_record.Set("email", email_record.Id)
+			email_address_record.Set("email_address", email_address)
+			email_address_record.Set("display_name", display_name)
+
+			err := txApp.Save(email_address_record)
+			if err != nil {
+				return nil, fmt.Errorf("failed to save email %s address: %w", a.debug, err)
+			}
+		}
+	}
+
+	for index, attachment := range email.Attachments {
+		email_attachment := core.NewRecord(cols.ib_email_attachments)
+		email_attachment.Set("email", email_record.Id)
+		email_attachment.Set("index", index)
+		email_attachment.Set("name", attachment.Name)
+		email_attachment.Set("mime_type", attachment.MimeType)
+
+		content_file, err := filesystem.NewFileFromBytes(attachment.Content, attachment.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create content file: %w", err)
+		}
+
+		email_attachment.Set("content", content_file)
+
+		err = txApp.Save(email_attachment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save email attachment: %w", err)
+		}
+	}
+
+	return email_record, nil
+}
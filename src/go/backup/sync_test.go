@@ -0,0 +1,197 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	_ "github.com/yerTools/imapbackup/src/go/database/migrations"
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+// serverCert is the certificate of the test servers. The IMAP client trusts
+// the system roots only, so it is made the one system root of the tests.
+var serverCert tls.Certificate
+
+func TestMain(m *testing.M) {
+	certificate, certPEM, err := testutil.NewCertificate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	serverCert = certificate
+
+	dir, err := os.MkdirTemp("", "backup_test")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		log.Fatal(err)
+	}
+	os.Setenv("SSL_CERT_FILE", certFile)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestSyncFolderResume(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	be, addr := testutil.NewTLSServer(t, serverCert)
+	inbox := testutil.ServerMailbox(t, be, "INBOX")
+
+	account := testutil.CreateAccount(t, app, map[string]any{
+		"host": addr.IP.String(),
+		"port": addr.Port,
+	})
+
+	subjects := func() []string {
+		records, err := app.FindRecordsByFilter("ib_emails", "smtp_account = {:account}", "subject", 0, 0, dbx.Params{"account": account.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := make([]string, len(records))
+		for i, record := range records {
+			result[i] = record.GetString("subject")
+		}
+		return result
+	}
+
+	folderState := func() *core.Record {
+		record, err := app.FindFirstRecordByFilter("ib_folders", "smtp_account = {:account} && name = 'INBOX'", dbx.Params{"account": account.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	scenarios := []struct {
+		name     string
+		prepare  func()
+		expected []string
+	}{
+		{
+			name:     "first sync",
+			prepare:  func() {},
+			expected: []string{"A little message, just for you"},
+		},
+		{
+			// the archived copy of the first message is gone, it must not be
+			// fetched again as it is below the last synced UID
+			name: "resume after the last UID",
+			prepare: func() {
+				// the references to the emails don't matter to the sync
+				_, err := app.DB().Delete("emails", dbx.HashExp{"smtp_account": account.Id}).Execute()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				message := "Subject: Second\r\nMessage-ID: <second@example.org>\r\nDate: Wed, 1 May 2024 12:30:00 +0000\r\n\r\nHi\r\n"
+				if err := inbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(message)); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expected: []string{"Second"},
+		},
+		{
+			// the memory server always reports UIDVALIDITY 1
+			name: "UIDVALIDITY reset",
+			prepare: func() {
+				record := folderState()
+				record.Set("uid_validity", 7)
+				if err := app.Save(record); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expected: []string{"A little message, just for you", "Second"},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			s.prepare()
+
+			if err := SyncAccount(app, account.Id, Options{}); err != nil {
+				t.Fatal(err)
+			}
+
+			if result := subjects(); !slices.Equal(result, s.expected) {
+				t.Fatalf("expected the emails %q, got %q", s.expected, result)
+			}
+
+			lastUID := int(inbox.Messages[len(inbox.Messages)-1].Uid)
+			state := folderState()
+			if state.GetInt("uid_validity") != 1 || state.GetInt("last_uid") != lastUID {
+				t.Fatalf("expected UIDVALIDITY 1 and last UID %d, got %d and %d", lastUID, state.GetInt("uid_validity"), state.GetInt("last_uid"))
+			}
+		})
+	}
+}
+
+func TestSyncRawSHA256(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	be, addr := testutil.NewTLSServer(t, serverCert)
+	message := testutil.ServerMailbox(t, be, "INBOX").Messages[0]
+
+	account := testutil.CreateAccount(t, app, map[string]any{
+		"host": addr.IP.String(),
+		"port": addr.Port,
+	})
+
+	if err := SyncAccount(app, account.Id, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	email, err := app.FindFirstRecordByFilter("ib_emails", "smtp_account = {:account}", dbx.Params{"account": account.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+
+	file, err := fsys.GetFile(email.BaseFilesPath() + "/" + email.GetString("raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	raw, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := sha256.Sum256(message.Body)
+	if !bytes.Equal(raw, message.Body) {
+		t.Fatalf("expected the raw message to be stored as it is, got %q", raw)
+	}
+	if hash := email.GetString("raw_sha256"); hash != hex.EncodeToString(expected[:]) {
+		t.Fatalf("expected SHA-256 %x, got %s", expected, hash)
+	}
+}
@@ -0,0 +1,128 @@
+// Package connect opens IMAP connections to accounts using their TLS and
+// authentication settings.
+package connect
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+	"github.com/yerTools/imapbackup/src/go/oauth"
+	"github.com/yerTools/imapbackup/src/go/secrets"
+)
+
+const (
+	// TLSModeImplicit connects with TLS right away, usually on port 993.
+	// It is the default of accounts without TLS mode.
+	TLSModeImplicit = "tls"
+
+	// TLSModeStartTLS connects without TLS and upgrades the connection with
+	// STARTTLS before logging in, usually on port 143.
+	TLSModeStartTLS = "starttls"
+
+	// TLSModeNone never encrypts the connection.
+	TLSModeNone = "none"
+)
+
+// TLSConfig returns the TLS configuration of the 'ib_smtp_accounts' record.
+func TLSConfig(account *core.Record) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         account.GetString("host"),
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: account.GetBool("tls_insecure_skip_verify"),
+	}
+
+	if bundle := account.GetString("tls_ca_bundle"); bundle != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(bundle)) {
+			return nil, errors.New("CA bundle contains no PEM encoded certificate")
+		}
+		config.RootCAs = pool
+	}
+
+	cert, key := account.GetString("tls_client_cert"), account.GetString("tls_client_key")
+	if cert != "" || key != "" {
+		key, err := secrets.Reveal(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt client key: %w", err)
+		}
+
+		certificate, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// Dial connects to the server of the account using its TLS mode, without
+// logging in.
+func Dial(account *core.Record) (*imapclient.Client, error) {
+	host, port := account.GetString("host"), account.GetInt("port")
+
+	mode := account.GetString("tls_mode")
+	if mode == TLSModeNone {
+		return imapclient.DialPlain(host, port)
+	}
+
+	config, err := TLSConfig(account)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case TLSModeStartTLS:
+		return imapclient.DialStartTLS(host, port, config)
+	case TLSModeImplicit, "":
+		return imapclient.Dial(host, port, config)
+	default:
+		return nil, fmt.Errorf("unknown TLS mode %q", mode)
+	}
+}
+
+// Login authenticates as the account, either with its password or with a
+// freshly refreshed OAuth2 access token.
+func Login(ctx context.Context, app core.App, c *imapclient.Client, account *core.Record) error {
+	if oauth.IsOAuth2(account) {
+		accessToken, err := oauth.AccessToken(ctx, app, account)
+		if err != nil {
+			return err
+		}
+
+		return c.AuthenticateXOAuth2(account.GetString("username"), accessToken)
+	}
+
+	password, err := secrets.Reveal(account.GetString("password"))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt password: %w", err)
+	}
+
+	return c.Login(account.GetString("username"), password)
+}
+
+// Account connects to the server of the account and logs in. Offline
+// accounts have no server and are rejected.
+func Account(ctx context.Context, app core.App, account *core.Record) (*imapclient.Client, error) {
+	if account.GetBool("offline") {
+		return nil, errors.New("offline accounts have no server")
+	}
+
+	c, err := Dial(account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	if err := Login(ctx, app, c, account); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("failed to login: %w", err)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,81 @@
+package connect
+
+import (
+	"net/http"
+	"strconv"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/oauth"
+)
+
+// testConnectionParam is the query parameter that makes creating or updating
+// an account fail if its connection test fails.
+const testConnectionParam = "test_connection"
+
+// Init registers the connection test endpoint and the option to test the
+// connection while an account is created or updated.
+func Init(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.POST("/api/ib/accounts/{id}/test", handleTest).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+
+	app.OnRecordCreateRequest("ib_smtp_accounts").BindFunc(testBeforeSave)
+	app.OnRecordUpdateRequest("ib_smtp_accounts").BindFunc(testBeforeSave)
+}
+
+// handleTest tests the connection of a saved account. The result is returned
+// even if the test failed, only a missing or offline account is an error.
+func handleTest(e *core.RequestEvent) error {
+	account, err := e.App.FindRecordById("ib_smtp_accounts", e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("Account not found.", nil)
+	}
+
+	if !e.HasSuperuserAuth() && account.GetString("created_by") != e.Auth.Id {
+		return e.NotFoundError("Account not found.", nil)
+	}
+
+	if account.GetBool("offline") {
+		return e.BadRequestError("Offline accounts have no server to test.", nil)
+	}
+
+	return e.JSON(http.StatusOK, Test(e.Request.Context(), e.App, account))
+}
+
+// testBeforeSave tests the connection with the submitted settings if the
+// request asks for it, and rejects the request with an error on the field
+// that most likely has to be fixed.
+func testBeforeSave(e *core.RecordRequestEvent) error {
+	test, _ := strconv.ParseBool(e.Request.URL.Query().Get(testConnectionParam))
+	if !test || e.Record.GetBool("offline") {
+		return e.Next()
+	}
+
+	result := Test(e.Request.Context(), e.App, e.Record)
+	if result.OK {
+		return e.Next()
+	}
+
+	field := "host"
+	switch result.Stage {
+	case StageTCP:
+		field = "port"
+	case StageTLS:
+		field = "tls_mode"
+	case StageAuth:
+		field = "password"
+		if oauth.IsOAuth2(e.Record) {
+			field = "username"
+		}
+	}
+
+	return e.BadRequestError("Connection test failed.", validation.Errors{
+		field: validation.NewError("validation_connection_"+result.Stage, result.Error),
+	})
+}
@@ -0,0 +1,119 @@
+package connect
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+)
+
+// The stages of a connection test, in the order they are run.
+const (
+	StageDNS        = "dns"
+	StageTCP        = "tcp"
+	StageTLS        = "tls"
+	StageAuth       = "auth"
+	StageCapability = "capability"
+)
+
+// TestResult is the outcome of a connection test. Stage and Error are only
+// set if the test failed, the other fields hold what was learned until then.
+type TestResult struct {
+	OK    bool   `json:"ok"`
+	Stage string `json:"stage,omitempty"`
+	Error string `json:"error,omitempty"`
+
+	TLS          bool     `json:"tls"`
+	Capabilities []string `json:"capabilities"`
+	Folders      int      `json:"folders"`
+}
+
+func (r *TestResult) fail(stage string, err error) *TestResult {
+	r.Stage = stage
+	r.Error = err.Error()
+	return r
+}
+
+// Test connects to the server of the account, logs in, lists the folders and
+// logs out again. Every error is reported in the result together with the
+// stage it happened in, so that the user knows which setting to fix.
+// Offline accounts have no server and must not be tested.
+func Test(ctx context.Context, app core.App, account *core.Record) *TestResult {
+	result := &TestResult{
+		Capabilities: []string{},
+	}
+
+	host := account.GetString("host")
+	if net.ParseIP(host) == nil {
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			return result.fail(StageDNS, fmt.Errorf("failed to resolve %q: %w", host, err))
+		}
+	}
+
+	// an invalid CA bundle or client certificate is reported before connecting
+	if mode := account.GetString("tls_mode"); mode != TLSModeNone {
+		if _, err := TLSConfig(account); err != nil {
+			return result.fail(StageTLS, err)
+		}
+	}
+
+	c, err := Dial(account)
+	if err != nil {
+		return result.fail(dialStage(err), err)
+	}
+	defer c.Logout()
+
+	result.TLS = c.IsTLS()
+
+	if err := Login(ctx, app, c, account); err != nil {
+		return result.fail(StageAuth, err)
+	}
+
+	for capability := range c.Capabilities {
+		result.Capabilities = append(result.Capabilities, capability)
+	}
+	sort.Strings(result.Capabilities)
+
+	if !c.Capabilities.Has("IMAP4rev1") && !c.Capabilities.Has("IMAP4rev2") {
+		return result.fail(StageCapability, errors.New("server does not announce IMAP4rev1 or IMAP4rev2"))
+	}
+
+	folders, err := c.List()
+	if err != nil {
+		return result.fail(StageCapability, fmt.Errorf("failed to list folders: %w", err))
+	}
+	result.Folders = len(folders)
+
+	result.OK = true
+	return result
+}
+
+// dialStage tells whether a failed Dial could not reach the server at all or
+// failed while setting up TLS.
+func dialStage(err error) string {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		switch opErr.Op {
+		case "dial":
+			return StageTCP
+		case "remote error":
+			// the server sent a TLS alert
+			return StageTLS
+		}
+	}
+
+	var recordHeader tls.RecordHeaderError
+	if imapclient.IsCertificateError(err) ||
+		errors.Is(err, imapclient.ErrNoStartTLS) ||
+		errors.As(err, &recordHeader) {
+		return StageTLS
+	}
+
+	return StageTCP
+}
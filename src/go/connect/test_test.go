@@ -0,0 +1,147 @@
+package connect
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	_ "github.com/yerTools/imapbackup/src/go/database/migrations"
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+// closedPort returns a local port nothing listens on.
+func closedPort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	return port
+}
+
+func TestTest(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	collection, err := app.FindCollectionByNameOrId("ib_smtp_accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, addr := testutil.NewServer(t)
+
+	scenarios := []struct {
+		name     string
+		host     string
+		port     int
+		tlsMode  string
+		password string
+		caBundle string
+
+		expectedStage string
+		expectedOK    bool
+	}{
+		{
+			name:       "success",
+			port:       addr.Port,
+			tlsMode:    TLSModeNone,
+			password:   "password",
+			expectedOK: true,
+		},
+		{
+			name:          "unknown host",
+			host:          "imap.invalid",
+			port:          addr.Port,
+			tlsMode:       TLSModeNone,
+			password:      "password",
+			expectedStage: StageDNS,
+		},
+		{
+			name:          "nothing listening",
+			port:          closedPort(t),
+			tlsMode:       TLSModeNone,
+			password:      "password",
+			expectedStage: StageTCP,
+		},
+		{
+			name:          "implicit TLS against plaintext",
+			port:          addr.Port,
+			tlsMode:       TLSModeImplicit,
+			password:      "password",
+			expectedStage: StageTLS,
+		},
+		{
+			name:          "STARTTLS not offered",
+			port:          addr.Port,
+			tlsMode:       TLSModeStartTLS,
+			password:      "password",
+			expectedStage: StageTLS,
+		},
+		{
+			name:          "invalid CA bundle",
+			port:          addr.Port,
+			tlsMode:       TLSModeImplicit,
+			password:      "password",
+			caBundle:      "not a certificate",
+			expectedStage: StageTLS,
+		},
+		{
+			name:          "wrong password",
+			port:          addr.Port,
+			tlsMode:       TLSModeNone,
+			password:      "wrong",
+			expectedStage: StageAuth,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			host := s.host
+			if host == "" {
+				host = addr.IP.String()
+			}
+
+			account := core.NewRecord(collection)
+			account.Set("username", "username")
+			account.Set("password", s.password)
+			account.Set("host", host)
+			account.Set("port", s.port)
+			account.Set("tls_mode", s.tlsMode)
+			account.Set("tls_ca_bundle", s.caBundle)
+
+			result := Test(context.Background(), app, account)
+
+			if result.OK != s.expectedOK || result.Stage != s.expectedStage {
+				t.Fatalf("expected ok %v in stage %q, got ok %v in stage %q: %s", s.expectedOK, s.expectedStage, result.OK, result.Stage, result.Error)
+			}
+
+			if !s.expectedOK {
+				if result.Error == "" {
+					t.Fatal("expected an error message")
+				}
+				return
+			}
+
+			if !slices.Contains(result.Capabilities, "IMAP4REV1") {
+				t.Fatalf("expected IMAP4rev1 to be announced, got %v", result.Capabilities)
+			}
+			if result.Folders == 0 {
+				t.Fatal("expected the folders to be listed")
+			}
+			if result.TLS {
+				t.Fatal("expected the connection to be unencrypted")
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/cron"
+
+	"github.com/yerTools/imapbackup/src/go/backup"
+)
+
+// registerAccountValidation validates the settings of an account and requires
+// the ones needed to connect, unless the account is offline.
+func registerAccountValidation(app core.App) {
+	app.OnRecordValidate("ib_smtp_accounts").BindFunc(func(e *core.RecordEvent) error {
+		if schedule := e.Record.GetString("sync_schedule"); schedule != "" {
+			if _, err := cron.NewSchedule(schedule); err != nil {
+				return validation.Errors{"sync_schedule": validation.NewError("validation_invalid_cron", err.Error())}
+			}
+		}
+
+		if raw := e.Record.GetString("idle_folders"); raw != "" && raw != "null" {
+			folders := []string{}
+			if err := json.Unmarshal([]byte(raw), &folders); err != nil {
+				return validation.Errors{"idle_folders": validation.NewError("validation_invalid_folders", "Must be a list of folder names.")}
+			}
+		}
+
+		for _, field := range []string{"folder_include", "folder_exclude"} {
+			raw := e.Record.GetString(field)
+			if raw == "" || raw == "null" {
+				continue
+			}
+
+			patterns := []string{}
+			if err := json.Unmarshal([]byte(raw), &patterns); err != nil {
+				return validation.Errors{field: validation.NewError("validation_invalid_pattern", "Must be a list of patterns.")}
+			}
+			for _, pattern := range patterns {
+				if _, err := backup.CompilePattern(pattern); err != nil {
+					return validation.Errors{field: validation.NewError("validation_invalid_pattern", fmt.Sprintf("Invalid pattern %q: %v.", pattern, err))}
+				}
+			}
+		}
+
+		if e.Record.GetBool("offline") {
+			return e.Next()
+		}
+
+		required := []string{"host"}
+		if e.Record.GetString("auth_type") == "oauth2" {
+			required = append(required, "oauth2_provider", "oauth2_client_id")
+			if e.Record.GetString("oauth2_provider") == "custom" {
+				required = append(required, "oauth2_auth_url", "oauth2_token_url")
+			}
+		} else {
+			required = append(required, "password")
+		}
+
+		errs := validation.Errors{}
+		for _, field := range required {
+			if e.Record.GetString(field) == "" {
+				errs[field] = validation.ErrRequired
+			}
+		}
+		if e.Record.GetInt("port") == 0 {
+			errs["port"] = validation.ErrRequired
+		}
+
+		// a client certificate is useless without its key and vice versa
+		cert, key := e.Record.GetString("tls_client_cert"), e.Record.GetString("tls_client_key")
+		if cert != "" && key == "" {
+			errs["tls_client_key"] = validation.ErrRequired
+		}
+		if key != "" && cert == "" {
+			errs["tls_client_cert"] = validation.ErrRequired
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+
+		return e.Next()
+	})
+}
@@ -14,4 +14,6 @@ func Init(app *pocketbase.PocketBase, isGoRun bool) {
 		Automigrate: isGoRun,
 		Dir:         "./src/go/database/migrations",
 	})
+
+	registerAccountValidation(app)
 }
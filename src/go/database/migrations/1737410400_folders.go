@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func createFolders(app core.App) error {
+	collection := core.NewCollection("base", "folders")
+	collection.Id = "ib_folders"
+
+	collection.ListRule = types.Pointer("smtp_account.created_by.id = @request.auth.id")
+	collection.ViewRule = types.Pointer("smtp_account.created_by.id = @request.auth.id")
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = types.Pointer("smtp_account.created_by.id = @request.auth.id")
+
+	collection.Fields.Add(
+		&core.RelationField{
+			Name:          "smtp_account",
+			CollectionId:  "ib_smtp_accounts",
+			MinSelect:     1,
+			MaxSelect:     1,
+			Presentable:   true,
+			Required:      true,
+			CascadeDelete: true,
+		},
+		&core.TextField{
+			Name:        "name",
+			Presentable: true,
+			Required:    true,
+		},
+		&core.NumberField{
+			Name:    "uid_validity",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		},
+		&core.NumberField{
+			Name:    "last_uid",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		},
+		&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		},
+		&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		},
+	)
+
+	collection.AddIndex("idx_ib_folders_smtp_account_name", true, "`smtp_account`,`name`", "")
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to create 'folders' collection: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := createFolders(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
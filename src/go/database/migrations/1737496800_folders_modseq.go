@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func addFoldersHighestModSeq(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("ib_folders")
+	if err != nil {
+		return err
+	}
+
+	// modification sequences are unsigned 63-bit values, which do not fit
+	// into the float64 of a number field without losing precision
+	collection.Fields.Add(
+		&core.TextField{
+			Name:    "highest_modseq",
+			Pattern: `^\d*$`,
+		},
+	)
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to update 'folders' collection: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := addFoldersHighestModSeq(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
@@ -0,0 +1,106 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func addSmtpAccountsDeletionPolicy(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("ib_smtp_accounts")
+	if err != nil {
+		return err
+	}
+
+	collection.Fields.Add(
+		&core.SelectField{
+			Name:      "deletion_policy",
+			Values:    []string{"keep", "purge", "mirror"},
+			MaxSelect: 1,
+		},
+		&core.NumberField{
+			Name:    "purge_after_days",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		},
+	)
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to update 'smtp_accounts' collection: %w", err)
+	}
+
+	return nil
+}
+
+func addEmailsDeletedOnServer(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("ib_emails")
+	if err != nil {
+		return err
+	}
+
+	collection.Fields.Add(
+		&core.DateField{
+			Name: "deleted_on_server",
+		},
+	)
+
+	collection.AddIndex("idx_ib_emails_deleted_on_server", false, "`smtp_account`,`deleted_on_server`", "")
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to update 'emails' collection: %w", err)
+	}
+
+	return nil
+}
+
+// cascadeEmailDeletes makes sure that purging an email also removes
+// everything that was stored alongside it.
+func cascadeEmailDeletes(app core.App) error {
+	for _, id := range []string{
+		"ib_email_flags",
+		"ib_email_from_addresses",
+		"ib_email_to_addresses",
+		"ib_email_reply_to_addresses",
+		"ib_email_cc_addresses",
+		"ib_email_bcc_addresses",
+		"ib_email_attachments",
+	} {
+		collection, err := app.FindCollectionByNameOrId(id)
+		if err != nil {
+			return err
+		}
+
+		field, ok := collection.Fields.GetByName("email").(*core.RelationField)
+		if !ok {
+			return fmt.Errorf("'%s' collection has no 'email' relation field", id)
+		}
+		field.CascadeDelete = true
+
+		if err := app.Save(collection); err != nil {
+			return fmt.Errorf("failed to update '%s' collection: %w", collection.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := addSmtpAccountsDeletionPolicy(app); err != nil {
+			return err
+		}
+
+		if err := addEmailsDeletedOnServer(app); err != nil {
+			return err
+		}
+
+		if err := cascadeEmailDeletes(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
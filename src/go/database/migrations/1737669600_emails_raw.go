@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func addEmailsRaw(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("ib_emails")
+	if err != nil {
+		return err
+	}
+
+	collection.Fields.Add(
+		&core.FileField{
+			Name:      "raw",
+			MaxSize:   maxFileSize,
+			MaxSelect: 1,
+		},
+		&core.TextField{
+			Name:    "raw_sha256",
+			Pattern: `^([0-9a-f]{64})?$`,
+		},
+	)
+
+	collection.AddIndex("idx_ib_emails_raw_sha256", false, "`smtp_account`,`raw_sha256`", "")
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to update 'emails' collection: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := addEmailsRaw(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
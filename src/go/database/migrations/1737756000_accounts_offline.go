@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// addSmtpAccountsOffline adds accounts that only hold imported emails. They
+// have no server, so the connection settings are no longer required on the
+// collection and get validated by a hook for all other accounts instead.
+func addSmtpAccountsOffline(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("ib_smtp_accounts")
+	if err != nil {
+		return err
+	}
+
+	collection.Fields.Add(
+		&core.BoolField{
+			Name: "offline",
+		},
+	)
+
+	for _, name := range []string{"password", "host"} {
+		field, ok := collection.Fields.GetByName(name).(*core.TextField)
+		if !ok {
+			return fmt.Errorf("field '%s' of 'smtp_accounts' is not a text field", name)
+		}
+		field.Required = false
+	}
+
+	port, ok := collection.Fields.GetByName("port").(*core.NumberField)
+	if !ok {
+		return fmt.Errorf("field 'port' of 'smtp_accounts' is not a number field")
+	}
+	port.Required = false
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to update 'smtp_accounts' collection: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := addSmtpAccountsOffline(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// createEmailsFts creates the full-text index over the subject, text and
+// addresses of every email and fills it with the already archived emails.
+// It is kept up to date by the record hooks of the search package. The index
+// is keyed by its rowid, which is taken from 'emails_fts_ids', as the ids of
+// PocketBase are text and the implicit rowid of 'emails' may change on
+// VACUUM. Entries can then be replaced without scanning the whole index.
+func createEmailsFts(app core.App) error {
+	for _, query := range []string{
+		`CREATE TABLE {{emails_fts_ids}} (
+			[[id]] INTEGER PRIMARY KEY,
+			[[email]] TEXT NOT NULL UNIQUE
+		)`,
+		`CREATE VIRTUAL TABLE {{emails_fts}} USING fts5(
+			subject,
+			text,
+			addresses,
+			tokenize = 'unicode61 remove_diacritics 2'
+		)`,
+		`INSERT INTO {{emails_fts_ids}} ([[email]]) SELECT [[id]] FROM {{emails}}`,
+	} {
+		if _, err := app.DB().NewQuery(query).Execute(); err != nil {
+			return fmt.Errorf("failed to create full-text index: %w", err)
+		}
+	}
+
+	_, err := app.DB().NewQuery(`
+		INSERT INTO {{emails_fts}} ([[rowid]], [[subject]], [[text]], [[addresses]])
+		SELECT [[m.id]], [[e.subject]], [[e.text]], (
+			SELECT group_concat([[a.display_name]] || ' ' || [[a.email_address]], ' ') FROM (
+				SELECT [[display_name]], [[email_address]] FROM {{email_from_addresses}} WHERE [[email]] = [[e.id]]
+				UNION ALL SELECT [[display_name]], [[email_address]] FROM {{email_to_addresses}} WHERE [[email]] = [[e.id]]
+				UNION ALL SELECT [[display_name]], [[email_address]] FROM {{email_reply_to_addresses}} WHERE [[email]] = [[e.id]]
+				UNION ALL SELECT [[display_name]], [[email_address]] FROM {{email_cc_addresses}} WHERE [[email]] = [[e.id]]
+				UNION ALL SELECT [[display_name]], [[email_address]] FROM {{email_bcc_addresses}} WHERE [[email]] = [[e.id]]
+			) a
+		)
+		FROM {{emails}} e
+		INNER JOIN {{emails_fts_ids}} m ON [[m.email]] = [[e.id]]
+	`).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to fill 'emails_fts' table: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := createEmailsFts(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
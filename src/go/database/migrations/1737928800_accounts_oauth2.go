@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func addSmtpAccountsOAuth2(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("ib_smtp_accounts")
+	if err != nil {
+		return err
+	}
+
+	collection.Fields.Add(
+		&core.SelectField{
+			Name:      "auth_type",
+			Values:    []string{"password", "oauth2"},
+			MaxSelect: 1,
+		},
+		&core.SelectField{
+			Name:      "oauth2_provider",
+			Values:    []string{"google", "microsoft", "custom"},
+			MaxSelect: 1,
+		},
+		&core.URLField{
+			Name: "oauth2_auth_url",
+		},
+		&core.URLField{
+			Name: "oauth2_token_url",
+		},
+		&core.TextField{
+			Name: "oauth2_scopes",
+		},
+		&core.TextField{
+			Name: "oauth2_client_id",
+		},
+		&core.TextField{
+			Name:   "oauth2_client_secret",
+			Hidden: true,
+		},
+		&core.TextField{
+			Name:   "oauth2_refresh_token",
+			Hidden: true,
+		},
+	)
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to update 'smtp_accounts' collection: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := addSmtpAccountsOAuth2(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
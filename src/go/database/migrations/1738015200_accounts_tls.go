@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func addSmtpAccountsTLS(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("ib_smtp_accounts")
+	if err != nil {
+		return err
+	}
+
+	collection.Fields.Add(
+		&core.SelectField{
+			Name:      "tls_mode",
+			Values:    []string{"tls", "starttls", "none"},
+			MaxSelect: 1,
+		},
+		&core.TextField{
+			Name: "tls_ca_bundle",
+			Max:  100000,
+		},
+		&core.TextField{
+			Name: "tls_client_cert",
+			Max:  100000,
+		},
+		&core.TextField{
+			Name:   "tls_client_key",
+			Max:    100000,
+			Hidden: true,
+		},
+		&core.BoolField{
+			Name: "tls_insecure_skip_verify",
+		},
+	)
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to update 'smtp_accounts' collection: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := addSmtpAccountsTLS(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func addSmtpAccountsSchedule(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("ib_smtp_accounts")
+	if err != nil {
+		return err
+	}
+
+	collection.Fields.Add(
+		&core.TextField{
+			Name: "sync_schedule",
+			Max:  255,
+		},
+		&core.BoolField{
+			Name: "sync_paused",
+		},
+	)
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to update 'smtp_accounts' collection: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := addSmtpAccountsSchedule(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
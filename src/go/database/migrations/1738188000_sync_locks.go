@@ -0,0 +1,71 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func createSyncLocks(app core.App) error {
+	collection := core.NewCollection("base", "sync_locks")
+	collection.Id = "ib_sync_locks"
+
+	collection.ListRule = types.Pointer("smtp_account.created_by.id = @request.auth.id")
+	collection.ViewRule = types.Pointer("smtp_account.created_by.id = @request.auth.id")
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = nil
+
+	collection.Fields.Add(
+		&core.RelationField{
+			Name:          "smtp_account",
+			CollectionId:  "ib_smtp_accounts",
+			MinSelect:     1,
+			MaxSelect:     1,
+			Presentable:   true,
+			Required:      true,
+			CascadeDelete: true,
+		},
+		&core.TextField{
+			Name:     "holder",
+			Required: true,
+		},
+		&core.DateField{
+			Name: "acquired",
+		},
+		&core.DateField{
+			Name:     "expires",
+			Required: true,
+		},
+		&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		},
+		&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		},
+	)
+
+	collection.AddIndex("idx_ib_sync_locks_smtp_account", true, "`smtp_account`", "")
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to create 'sync_locks' collection: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := createSyncLocks(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
@@ -0,0 +1,134 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// syncStatsFields returns the counters shared by runs and their folders.
+func syncStatsFields() []core.Field {
+	fields := []core.Field{
+		&core.SelectField{
+			Name:      "status",
+			Values:    []string{"running", "success", "failed"},
+			MaxSelect: 1,
+			Required:  true,
+		},
+		&core.DateField{
+			Name: "started",
+		},
+		&core.DateField{
+			Name: "finished",
+		},
+	}
+
+	for _, name := range []string{"scanned", "new", "moved", "flags_updated", "failed", "bytes"} {
+		fields = append(fields, &core.NumberField{
+			Name:    name,
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		})
+	}
+
+	return append(fields,
+		&core.TextField{
+			Name: "error",
+			Max:  10000,
+		},
+		&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		},
+		&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		},
+	)
+}
+
+func createSyncRuns(app core.App) error {
+	collection := core.NewCollection("base", "sync_runs")
+	collection.Id = "ib_sync_runs"
+
+	collection.ListRule = types.Pointer("smtp_account.created_by.id = @request.auth.id")
+	collection.ViewRule = types.Pointer("smtp_account.created_by.id = @request.auth.id")
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = types.Pointer("smtp_account.created_by.id = @request.auth.id")
+
+	collection.Fields.Add(
+		&core.RelationField{
+			Name:          "smtp_account",
+			CollectionId:  "ib_smtp_accounts",
+			MinSelect:     1,
+			MaxSelect:     1,
+			Presentable:   true,
+			Required:      true,
+			CascadeDelete: true,
+		},
+	)
+	collection.Fields.Add(syncStatsFields()...)
+
+	collection.AddIndex("idx_ib_sync_runs_smtp_account_started", false, "`smtp_account`,`started`", "")
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to create 'sync_runs' collection: %w", err)
+	}
+
+	return nil
+}
+
+func createSyncRunFolders(app core.App) error {
+	collection := core.NewCollection("base", "sync_run_folders")
+	collection.Id = "ib_sync_run_folders"
+
+	collection.ListRule = types.Pointer("sync_run.smtp_account.created_by.id = @request.auth.id")
+	collection.ViewRule = types.Pointer("sync_run.smtp_account.created_by.id = @request.auth.id")
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = types.Pointer("sync_run.smtp_account.created_by.id = @request.auth.id")
+
+	collection.Fields.Add(
+		&core.RelationField{
+			Name:          "sync_run",
+			CollectionId:  "ib_sync_runs",
+			MinSelect:     1,
+			MaxSelect:     1,
+			Required:      true,
+			CascadeDelete: true,
+		},
+		&core.TextField{
+			Name:        "folder",
+			Presentable: true,
+			Required:    true,
+		},
+	)
+	collection.Fields.Add(syncStatsFields()...)
+
+	collection.AddIndex("idx_ib_sync_run_folders_sync_run", false, "`sync_run`", "")
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to create 'sync_run_folders' collection: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := createSyncRuns(app); err != nil {
+			return err
+		}
+
+		if err := createSyncRunFolders(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
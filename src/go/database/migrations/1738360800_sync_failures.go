@@ -0,0 +1,115 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func createSyncFailures(app core.App) error {
+	collection := core.NewCollection("base", "sync_failures")
+	collection.Id = "ib_sync_failures"
+
+	collection.ListRule = types.Pointer("smtp_account.created_by.id = @request.auth.id")
+	collection.ViewRule = types.Pointer("smtp_account.created_by.id = @request.auth.id")
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = nil
+
+	collection.Fields.Add(
+		&core.RelationField{
+			Name:          "smtp_account",
+			CollectionId:  "ib_smtp_accounts",
+			MinSelect:     1,
+			MaxSelect:     1,
+			Presentable:   true,
+			Required:      true,
+			CascadeDelete: true,
+		},
+		&core.TextField{
+			Name:        "folder",
+			Presentable: true,
+			Required:    true,
+		},
+		&core.NumberField{
+			Name:    "uid_validity",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		},
+		&core.NumberField{
+			Name:     "uid",
+			Min:      types.Pointer(1.0),
+			OnlyInt:  true,
+			Required: true,
+		},
+		&core.NumberField{
+			Name:    "attempts",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		},
+		&core.TextField{
+			Name: "error",
+			Max:  10000,
+		},
+		&core.BoolField{
+			Name: "permanent",
+		},
+		&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		},
+		&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		},
+	)
+
+	collection.AddIndex("idx_ib_sync_failures_smtp_account_folder_uid", true, "`smtp_account`,`folder`,`uid`", "")
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to create 'sync_failures' collection: %w", err)
+	}
+
+	return nil
+}
+
+// addPartialRunStatus adds the status of runs and folders that finished, but
+// skipped some folders or messages because of errors.
+func addPartialRunStatus(app core.App) error {
+	for _, name := range []string{"ib_sync_runs", "ib_sync_run_folders"} {
+		collection, err := app.FindCollectionByNameOrId(name)
+		if err != nil {
+			return err
+		}
+
+		status, ok := collection.Fields.GetByName("status").(*core.SelectField)
+		if !ok {
+			return fmt.Errorf("'%s' has no status select field", name)
+		}
+		status.Values = []string{"running", "success", "partial", "failed"}
+
+		if err := app.Save(collection); err != nil {
+			return fmt.Errorf("failed to update '%s' collection: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := createSyncFailures(app); err != nil {
+			return err
+		}
+
+		if err := addPartialRunStatus(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
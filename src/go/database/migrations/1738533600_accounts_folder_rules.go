@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func addSmtpAccountsFolderRules(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("ib_smtp_accounts")
+	if err != nil {
+		return err
+	}
+
+	collection.Fields.Add(
+		&core.JSONField{
+			Name:    "folder_include",
+			MaxSize: 10000,
+		},
+		&core.JSONField{
+			Name:    "folder_exclude",
+			MaxSize: 10000,
+		},
+		&core.BoolField{
+			Name: "skip_special_use",
+		},
+	)
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to update 'smtp_accounts' collection: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := addSmtpAccountsFolderRules(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
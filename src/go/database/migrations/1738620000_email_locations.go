@@ -0,0 +1,117 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func createEmailLocations(app core.App) error {
+	collection := core.NewCollection("base", "email_locations")
+	collection.Id = "ib_email_locations"
+
+	collection.ListRule = types.Pointer("smtp_account.created_by.id = @request.auth.id")
+	collection.ViewRule = types.Pointer("smtp_account.created_by.id = @request.auth.id")
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = nil
+
+	collection.Fields.Add(
+		&core.RelationField{
+			Name:          "email",
+			CollectionId:  "ib_emails",
+			MinSelect:     1,
+			MaxSelect:     1,
+			Required:      true,
+			CascadeDelete: true,
+		},
+		&core.RelationField{
+			Name:          "smtp_account",
+			CollectionId:  "ib_smtp_accounts",
+			MinSelect:     1,
+			MaxSelect:     1,
+			Presentable:   true,
+			Required:      true,
+			CascadeDelete: true,
+		},
+		&core.TextField{
+			Name:        "folder",
+			Presentable: true,
+			Required:    true,
+		},
+		&core.NumberField{
+			Name:    "uid_validity",
+			Min:     types.Pointer(0.0),
+			OnlyInt: true,
+		},
+		&core.NumberField{
+			Name:     "uid",
+			Min:      types.Pointer(1.0),
+			OnlyInt:  true,
+			Required: true,
+		},
+		&core.DateField{
+			Name: "first_seen",
+		},
+		&core.DateField{
+			Name: "last_seen",
+		},
+		&core.AutodateField{
+			Name:     "created",
+			OnCreate: true,
+		},
+		&core.AutodateField{
+			Name:     "updated",
+			OnCreate: true,
+			OnUpdate: true,
+		},
+	)
+
+	// copies that were archived as separate emails share the same location
+	collection.AddIndex("idx_ib_email_locations_email_folder_uid", true, "`email`,`folder`,`uid_validity`,`uid`", "")
+	collection.AddIndex("idx_ib_email_locations_smtp_account_folder_uid", false, "`smtp_account`,`folder`,`uid`", "")
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to create 'email_locations' collection: %w", err)
+	}
+
+	return nil
+}
+
+// fillEmailLocations gives every email that is still on the server the
+// location it was last seen at.
+func fillEmailLocations(app core.App) error {
+	_, err := app.DB().NewQuery(`
+		INSERT INTO {{email_locations}} (
+			[[email]], [[smtp_account]], [[folder]], [[uid_validity]], [[uid]],
+			[[first_seen]], [[last_seen]], [[created]], [[updated]]
+		)
+		SELECT [[e.id]], [[e.smtp_account]], [[e.folder]], COALESCE([[f.uid_validity]], 0), [[e.uid]],
+			[[e.created]], [[e.updated]], [[e.created]], [[e.updated]]
+		FROM {{emails}} e
+		LEFT JOIN {{folders}} f ON [[f.smtp_account]] = [[e.smtp_account]] AND [[f.name]] = [[e.folder]]
+		WHERE [[e.uid]] > 0 AND [[e.deleted_on_server]] = ''
+	`).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to fill 'email_locations' collection: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := createEmailLocations(app); err != nil {
+			return err
+		}
+
+		if err := fillEmailLocations(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
@@ -0,0 +1,108 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// addFoldersHierarchy stores every folder of the server with its place in the
+// hierarchy instead of only the state of the synced ones. The name stays the
+// raw name the server uses, which is modified UTF-7 for non-ASCII names.
+func addFoldersHierarchy(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("ib_folders")
+	if err != nil {
+		return err
+	}
+
+	collection.Fields.Add(
+		&core.TextField{
+			Name: "display_name",
+		},
+		&core.RelationField{
+			Name:         "parent",
+			CollectionId: "ib_folders",
+			MaxSelect:    1,
+		},
+		&core.TextField{
+			Name: "delimiter",
+			Max:  10,
+		},
+		&core.SelectField{
+			Name:      "special_use",
+			MaxSelect: 7,
+			Values:    []string{"all", "archive", "drafts", "flagged", "junk", "sent", "trash"},
+		},
+		&core.BoolField{
+			Name: "subscribed",
+		},
+		&core.BoolField{
+			Name: "selectable",
+		},
+		&core.DateField{
+			Name: "deleted_on_server",
+		},
+	)
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to update 'folders' collection: %w", err)
+	}
+
+	// only folders that were synced had a record so far, the next sync
+	// decodes their names and fills in the rest
+	_, err = app.DB().NewQuery(`
+		UPDATE {{folders}} SET [[display_name]] = [[name]], [[selectable]] = TRUE
+	`).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to fill 'folders' collection: %w", err)
+	}
+
+	return nil
+}
+
+func addEmailsMailbox(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("ib_emails")
+	if err != nil {
+		return err
+	}
+
+	collection.Fields.Add(
+		&core.RelationField{
+			Name:         "mailbox",
+			CollectionId: "ib_folders",
+			MaxSelect:    1,
+		},
+	)
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to update 'emails' collection: %w", err)
+	}
+
+	_, err = app.DB().NewQuery(`
+		UPDATE {{emails}} SET [[mailbox]] = COALESCE((
+			SELECT [[f.id]] FROM {{folders}} f
+			WHERE [[f.smtp_account]] = {{emails}}.[[smtp_account]] AND [[f.name]] = {{emails}}.[[folder]]
+		), '')
+	`).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to fill 'mailbox' of emails: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := addFoldersHierarchy(app); err != nil {
+			return err
+		}
+
+		if err := addEmailsMailbox(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
@@ -0,0 +1,95 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// addEmailsGmail stores the ids Gmail gives every message and conversation.
+// They are 64 bit numbers, which a number field could not hold exactly.
+func addEmailsGmail(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("ib_emails")
+	if err != nil {
+		return err
+	}
+
+	collection.Fields.Add(
+		&core.TextField{
+			Name: "gmail_msgid",
+			Max:  20,
+		},
+		&core.TextField{
+			Name: "gmail_thrid",
+			Max:  20,
+		},
+	)
+
+	collection.AddIndex("idx_ib_emails_smtp_account_gmail_msgid", false, "`smtp_account`,`gmail_msgid`", "")
+	collection.AddIndex("idx_ib_emails_smtp_account_gmail_thrid", false, "`smtp_account`,`gmail_thrid`", "")
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to update 'emails' collection: %w", err)
+	}
+
+	return nil
+}
+
+func createEmailLabels(app core.App) error {
+	collection := core.NewCollection("base", "email_labels")
+	collection.Id = "ib_email_labels"
+
+	collection.ListRule = types.Pointer("email.smtp_account.created_by.id = @request.auth.id")
+	collection.ViewRule = types.Pointer("email.smtp_account.created_by.id = @request.auth.id")
+	collection.CreateRule = nil
+	collection.UpdateRule = nil
+	collection.DeleteRule = nil
+
+	collection.Fields.Add(
+		&core.RelationField{
+			Name:          "email",
+			CollectionId:  "ib_emails",
+			MinSelect:     1,
+			MaxSelect:     1,
+			Required:      true,
+			CascadeDelete: true,
+		},
+		&core.NumberField{
+			Name:        "index",
+			Presentable: true,
+			Min:         types.Pointer(0.0),
+			OnlyInt:     true,
+		},
+		&core.TextField{
+			Name:        "label",
+			Presentable: true,
+			Max:         maxTextLength,
+		},
+	)
+
+	collection.AddIndex("idx_ib_email_labels_email_index", false, "`email`,`index`", "")
+	collection.AddIndex("idx_ib_email_labels_label", false, "`label`", "")
+
+	if err := app.Save(collection); err != nil {
+		return fmt.Errorf("failed to create 'email_labels' collection: %w", err)
+	}
+
+	return nil
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		if err := addEmailsGmail(app); err != nil {
+			return err
+		}
+
+		if err := createEmailLabels(app); err != nil {
+			return err
+		}
+
+		return nil
+	}, nil)
+}
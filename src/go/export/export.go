@@ -0,0 +1,140 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/archive"
+)
+
+// Format writes archived emails in a specific on-disk format.
+type Format interface {
+	// OpenFolder prepares writing the emails of a single account folder.
+	OpenFolder(account *core.Record, folder string) (FolderWriter, error)
+}
+
+// FolderWriter receives the emails of a single account folder, ordered by
+// their received date.
+type FolderWriter interface {
+	// Skip reports whether the email is already part of a previous export.
+	Skip(email *core.Record) bool
+	WriteMessage(email *core.Record, flags []string, message io.Reader) error
+	Close() error
+}
+
+// Result counts what an export wrote.
+type Result struct {
+	Folders  int
+	Written  int
+	Skipped  int
+	Failures int
+}
+
+// Run exports the selected emails folder by folder. Only a single page of
+// emails is held in memory, messages are streamed to the writer. Gmail emails
+// are written to the folder of every label they had, see
+// archive.GmailFolders.
+func Run(app core.App, selection archive.Selection, format Format) (*Result, error) {
+	reader, err := archive.NewReader(app)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	mailboxes, err := selection.Mailboxes(app)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find folders: %w", err)
+	}
+
+	result := &Result{}
+
+	for _, mailbox := range mailboxes {
+		account, err := app.FindRecordById("ib_smtp_accounts", mailbox.Account)
+		if err != nil {
+			return result, fmt.Errorf("failed to find account %s: %w", mailbox.Account, err)
+		}
+
+		writer, err := format.OpenFolder(account, mailbox.Folder)
+		if err != nil {
+			return result, fmt.Errorf("failed to open folder %s: %w", mailbox.Folder, err)
+		}
+
+		err = selection.In(mailbox).Each(app, func(email *core.Record) error {
+			if writer.Skip(email) {
+				result.Skipped++
+				return nil
+			}
+
+			flags, err := reader.Flags(email)
+			if err != nil {
+				return err
+			}
+
+			message, err := reader.Open(email)
+			if err != nil {
+				log.Printf("failed to read email %s: %v\n", email.Id, err)
+				result.Failures++
+				return nil
+			}
+			defer message.Close()
+
+			if err := writer.WriteMessage(email, flags, message); err != nil {
+				return fmt.Errorf("failed to write email %s: %w", email.Id, err)
+			}
+
+			result.Written++
+			return nil
+		})
+
+		closeErr := writer.Close()
+		if err != nil {
+			return result, err
+		}
+		if closeErr != nil {
+			return result, fmt.Errorf("failed to close folder %s: %w", mailbox.Folder, closeErr)
+		}
+
+		result.Folders++
+	}
+
+	return result, nil
+}
+
+// sanitize turns a name into something that can be used as a single path
+// element on every common file system. Characters that are not allowed are
+// percent-encoded together with '%' itself, so different names never end up
+// as the same path element.
+func sanitize(name string) string {
+	if name == "" {
+		return "%"
+	}
+
+	b := strings.Builder{}
+	for i, r := range name {
+		escape := r < ' ' || r == 0x7f
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', '%':
+			escape = true
+		case '.', ' ':
+			// some file systems drop leading or trailing dots and spaces
+			escape = i == 0 || i == len(name)-1
+		}
+
+		if escape {
+			fmt.Fprintf(&b, "%%%02X", r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// accountDir returns the directory name used for an account.
+func accountDir(account *core.Record) string {
+	return sanitize(account.GetString("username")) + "_" + account.Id
+}
@@ -0,0 +1,46 @@
+package export
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		expected string
+	}{
+		{"INBOX", "INBOX"},
+		{"Sent Items", "Sent Items"},
+		{"a/b", "a%2Fb"},
+		{"a_b", "a_b"},
+		{"a%2Fb", "a%252Fb"},
+		{`C:\Users`, "C%3A%5CUsers"},
+		{"what?*", "what%3F%2A"},
+		{"tab\there", "tab%09here"},
+		{".hidden", "%2Ehidden"},
+		{"dots.inside.", "dots.inside%2E"},
+		{" padded ", "%20padded%20"},
+		{".", "%2E"},
+		{"", "%"},
+		{"Entwürfe", "Entwürfe"},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if result := sanitize(s.name); result != s.expected {
+				t.Fatalf("expected %q, got %q", s.expected, result)
+			}
+		})
+	}
+}
+
+func TestSanitizeCollisions(t *testing.T) {
+	names := []string{"a/b", "a_b", "a\\b", "a:b", "a%2Fb", "a%b", ".a", "a", "", "_", "%"}
+
+	seen := map[string]string{}
+	for _, name := range names {
+		result := sanitize(name)
+		if other, ok := seen[result]; ok {
+			t.Fatalf("%q and %q are both sanitized to %q", other, name, result)
+		}
+		seen[result] = name
+	}
+}
@@ -0,0 +1,84 @@
+package export
+
+import (
+	"log"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+
+	"github.com/yerTools/imapbackup/src/go/archive"
+)
+
+// Init registers the export commands.
+func Init(app *pocketbase.PocketBase) {
+	command := &cobra.Command{
+		Use:   "export",
+		Short: "Exports archived emails into other formats",
+	}
+
+	command.AddCommand(newMboxCommand(app))
+	command.AddCommand(newMaildirCommand(app))
+
+	app.RootCmd.AddCommand(command)
+}
+
+func newMboxCommand(app core.App) *cobra.Command {
+	var out string
+	selectionFlags := &archive.SelectionFlags{}
+
+	command := &cobra.Command{
+		Use:   "mbox",
+		Short: "Writes one mboxrd file per account folder",
+		RunE: func(command *cobra.Command, args []string) error {
+			selection, err := selectionFlags.Selection()
+			if err != nil {
+				return err
+			}
+
+			result, err := Run(app, selection, &Mbox{App: app, Dir: out})
+			if result != nil {
+				logResult(result)
+			}
+			return err
+		},
+	}
+
+	command.Flags().StringVar(&out, "out", "export", "directory the mbox files are written to")
+	selectionFlags.Register(command.Flags())
+
+	return command
+}
+
+func newMaildirCommand(app core.App) *cobra.Command {
+	format := &Maildir{App: app}
+	selectionFlags := &archive.SelectionFlags{}
+
+	command := &cobra.Command{
+		Use:   "maildir",
+		Short: "Writes one Maildir++ tree per account",
+		RunE: func(command *cobra.Command, args []string) error {
+			selection, err := selectionFlags.Selection()
+			if err != nil {
+				return err
+			}
+
+			result, err := Run(app, selection, format)
+			if result != nil {
+				logResult(result)
+			}
+			return err
+		},
+	}
+
+	command.Flags().StringVar(&format.Dir, "out", "export", "directory the Maildir trees are written to")
+	command.Flags().StringVar(&format.Delimiter, "delimiter", "", "hierarchy delimiter of folders the server reported none for")
+	command.Flags().BoolVar(&format.Incremental, "incremental", false, "only write emails that were not exported before")
+	selectionFlags.Register(command.Flags())
+
+	return command
+}
+
+func logResult(result *Result) {
+	log.Printf("exported %d email(s) from %d folder(s), skipped %d, failed %d\n", result.Written, result.Folders, result.Skipped, result.Failures)
+}
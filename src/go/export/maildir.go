@@ -0,0 +1,246 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// maildirFlags maps IMAP flags to the letters of the Maildir info suffix.
+var maildirFlags = map[string]byte{
+	`\Draft`:     'D',
+	`\Flagged`:   'F',
+	`$Forwarded`: 'P',
+	`Forwarded`:  'P',
+	`\Answered`:  'R',
+	`\Seen`:      'S',
+	`\Deleted`:   'T',
+}
+
+// Maildir writes one Maildir++ tree per account into Dir. INBOX becomes the
+// root of the tree, every other folder a ".Parent.Child" sub folder.
+type Maildir struct {
+	App core.App
+	Dir string
+
+	// Delimiter is the hierarchy delimiter of the folders the server never
+	// reported one for. Every other folder is split at the delimiter that
+	// was stored with it by the last sync.
+	Delimiter string
+
+	// Incremental skips emails that were written by a previous export
+	// instead of writing them again.
+	Incremental bool
+}
+
+// delimiter returns the hierarchy delimiter of the folder.
+func (m *Maildir) delimiter(account *core.Record, folder string) string {
+	if m.App == nil {
+		return m.Delimiter
+	}
+
+	folderRecord, err := m.App.FindFirstRecordByFilter(
+		"ib_folders",
+		"smtp_account = {:smtp_account} && name = {:name}",
+		dbx.Params{"smtp_account": account.Id, "name": folder},
+	)
+	if err != nil || folderRecord.GetString("delimiter") == "" {
+		return m.Delimiter
+	}
+
+	return folderRecord.GetString("delimiter")
+}
+
+// folderPath returns the Maildir++ directory of the folder.
+func (m *Maildir) folderPath(account *core.Record, folder string) string {
+	root := filepath.Join(m.Dir, accountDir(account))
+	if strings.EqualFold(folder, "INBOX") {
+		return root
+	}
+
+	parts := []string{folder}
+	delimiter := m.delimiter(account, folder)
+	if delimiter != "" {
+		parts = strings.Split(folder, delimiter)
+	}
+
+	// servers that keep every folder below INBOX, like Courier, already
+	// use the Maildir++ names, "INBOX.Sent" is stored as ".Sent"
+	if delimiter == "." && len(parts) > 1 && strings.EqualFold(parts[0], "INBOX") {
+		parts = parts[1:]
+	}
+
+	for i, part := range parts {
+		// dots separate the levels in Maildir++, so they are encoded in a name
+		parts[i] = strings.ReplaceAll(sanitize(part), ".", "%2E")
+	}
+
+	return filepath.Join(root, "."+strings.Join(parts, "."))
+}
+
+// OpenFolder creates the cur, new and tmp directories of the folder and
+// indexes the emails a previous export already wrote into it.
+func (m *Maildir) OpenFolder(account *core.Record, folder string) (FolderWriter, error) {
+	dir := m.folderPath(account, folder)
+
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	if !strings.EqualFold(folder, "INBOX") {
+		marker, err := os.OpenFile(filepath.Join(dir, "maildirfolder"), os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		marker.Close()
+	}
+
+	w := &maildirWriter{
+		dir:         dir,
+		incremental: m.Incremental,
+		existing:    map[string]string{},
+	}
+
+	for _, sub := range []string{"cur", "new"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if id, ok := maildirID(entry.Name()); ok {
+				w.existing[id] = filepath.Join(sub, entry.Name())
+			}
+		}
+	}
+
+	return w, nil
+}
+
+type maildirWriter struct {
+	dir         string
+	incremental bool
+
+	// existing maps the record id of every exported email to its path
+	// relative to the folder directory.
+	existing map[string]string
+}
+
+// maildirName returns the unique part of the file name, which is derived from
+// the record id so that a later export can recognize the email again.
+func maildirName(email *core.Record) string {
+	return fmt.Sprintf("%d.%s.imapbackup", email.GetDateTime("received").Time().Unix(), email.Id)
+}
+
+// maildirID extracts the record id from a file name written by maildirName.
+func maildirID(name string) (string, bool) {
+	name, _, _ = strings.Cut(name, ":")
+
+	parts := strings.Split(name, ".")
+	if len(parts) != 3 || parts[2] != "imapbackup" {
+		return "", false
+	}
+
+	return parts[1], true
+}
+
+// maildirInfo returns the ":2," info suffix for the flags.
+func maildirInfo(flags []string) string {
+	letters := make([]byte, 0, len(flags))
+	for _, flag := range flags {
+		if letter, ok := maildirFlags[flag]; ok && bytes.IndexByte(letters, letter) == -1 {
+			letters = append(letters, letter)
+		}
+	}
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i] < letters[j]
+	})
+
+	return ":2," + string(letters)
+}
+
+func (w *maildirWriter) Skip(email *core.Record) bool {
+	_, ok := w.existing[email.Id]
+	return ok && w.incremental
+}
+
+// WriteMessage delivers the message the Maildir way: it is written to tmp
+// first and then moved into cur together with its flags.
+func (w *maildirWriter) WriteMessage(email *core.Record, flags []string, message io.Reader) error {
+	name := maildirName(email)
+	tmpPath := filepath.Join(w.dir, "tmp", name)
+	curPath := filepath.Join(w.dir, "cur", name+maildirInfo(flags))
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	err = writeLF(file, message)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if received := email.GetDateTime("received").Time(); !received.IsZero() {
+		os.Chtimes(tmpPath, received, received)
+	}
+
+	if err := os.Rename(tmpPath, curPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// a previous export of the same email might carry different flags
+	if previous, ok := w.existing[email.Id]; ok && filepath.Join(w.dir, previous) != curPath {
+		os.Remove(filepath.Join(w.dir, previous))
+	}
+	w.existing[email.Id] = filepath.Join("cur", filepath.Base(curPath))
+
+	return nil
+}
+
+func (w *maildirWriter) Close() error {
+	return nil
+}
+
+// writeLF copies the message and converts CRLF line endings to LF, which is
+// what Maildir readers expect.
+func writeLF(file io.Writer, message io.Reader) error {
+	w := bufio.NewWriter(file)
+	r := bufio.NewReader(message)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			line = append(line[:len(line)-2], '\n')
+		}
+		if _, writeErr := w.Write(line); writeErr != nil {
+			return writeErr
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,139 @@
+package export
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	_ "github.com/yerTools/imapbackup/src/go/database/migrations"
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestMaildirInfo(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		flags    []string
+		expected string
+	}{
+		{"no flags", nil, ":2,"},
+		{"seen", []string{`\Seen`}, ":2,S"},
+		{"sorted", []string{`\Seen`, `\Answered`, `\Flagged`, `\Draft`}, ":2,DFRS"},
+		{"deleted", []string{`\Deleted`}, ":2,T"},
+		{"forwarded keywords", []string{`$Forwarded`, `Forwarded`}, ":2,P"},
+		{"duplicates", []string{`\Seen`, `\Seen`}, ":2,S"},
+		{"unknown flags", []string{`\Recent`, `$Junk`, `custom`}, ":2,"},
+		{"case sensitive", []string{`\seen`}, ":2,"},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if result := maildirInfo(s.flags); result != s.expected {
+				t.Fatalf("expected %q, got %q", s.expected, result)
+			}
+		})
+	}
+}
+
+func TestMaildirID(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		id       string
+		expected bool
+	}{
+		{"1714566600.abc123.imapbackup:2,S", "abc123", true},
+		{"1714566600.abc123.imapbackup", "abc123", true},
+		{"1714566600.abc123.otherhost:2,S", "", false},
+		{"1714566600.M1P2.host.imapbackup:2,", "", false},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			id, ok := maildirID(s.name)
+			if ok != s.expected || id != s.id {
+				t.Fatalf("expected (%q, %v), got (%q, %v)", s.id, s.expected, id, ok)
+			}
+		})
+	}
+}
+
+func TestMaildirFolderPath(t *testing.T) {
+	account := core.NewRecord(core.NewBaseCollection("smtp_accounts"))
+	account.Id = "account12345678"
+	account.Set("username", "user@example.org")
+	root := filepath.Join("out", "user@example.org_account12345678")
+
+	scenarios := []struct {
+		folder    string
+		delimiter string
+		expected  string
+	}{
+		{"INBOX", "/", root},
+		{"inbox", "/", root},
+		{"Sent", "/", filepath.Join(root, ".Sent")},
+		{"Archive/2024", "/", filepath.Join(root, ".Archive.2024")},
+		{"Archive/v1.2", "/", filepath.Join(root, ".Archive.v1%2E2")},
+		{"INBOX/Sub", "/", filepath.Join(root, ".INBOX.Sub")},
+		{"INBOX.Sent", ".", filepath.Join(root, ".Sent")},
+		{"INBOX.Archive.2024", ".", filepath.Join(root, ".Archive.2024")},
+		{"Archive.2024", ".", filepath.Join(root, ".Archive.2024")},
+		{"a/b", "", filepath.Join(root, ".a%2Fb")},
+		{"a_b", "/", filepath.Join(root, ".a_b")},
+		{"100%", "/", filepath.Join(root, ".100%25")},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.folder+" "+s.delimiter, func(t *testing.T) {
+			m := &Maildir{Dir: "out", Delimiter: s.delimiter}
+
+			if result := m.folderPath(account, s.folder); result != s.expected {
+				t.Fatalf("expected %q, got %q", s.expected, result)
+			}
+		})
+	}
+}
+
+func TestMaildirStoredDelimiter(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	account := testutil.CreateAccount(t, app, map[string]any{
+		"id":       "account12345678",
+		"username": "user@example.org",
+	})
+
+	folders, err := app.FindCollectionByNameOrId("ib_folders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	folder := core.NewRecord(folders)
+	folder.Set("smtp_account", account.Id)
+	folder.Set("name", "INBOX.Lists.Go")
+	folder.Set("delimiter", ".")
+	if err := app.Save(folder); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Maildir{App: app, Dir: "out", Delimiter: "/"}
+	root := filepath.Join("out", "user@example.org_account12345678")
+
+	scenarios := []struct {
+		folder   string
+		expected string
+	}{
+		{"INBOX.Lists.Go", filepath.Join(root, ".Lists.Go")},
+		{"Unknown/Folder", filepath.Join(root, ".Unknown.Folder")},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.folder, func(t *testing.T) {
+			if result := m.folderPath(account, s.folder); result != s.expected {
+				t.Fatalf("expected %q, got %q", s.expected, result)
+			}
+		})
+	}
+}
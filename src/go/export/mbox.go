@@ -0,0 +1,131 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// regexFromLine matches lines that have to be escaped in the mboxrd format.
+var regexFromLine = regexp.MustCompile(`^>*From `)
+
+// Mbox writes one mboxrd file per account folder into Dir.
+type Mbox struct {
+	App core.App
+	Dir string
+}
+
+// OpenFolder creates the mbox file of the folder, replacing an existing one.
+func (m *Mbox) OpenFolder(account *core.Record, folder string) (FolderWriter, error) {
+	dir := filepath.Join(m.Dir, accountDir(account))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(filepath.Join(dir, sanitize(folder)+".mbox"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &mboxWriter{
+		app:  m.App,
+		file: file,
+		w:    bufio.NewWriter(file),
+	}, nil
+}
+
+type mboxWriter struct {
+	app  core.App
+	file *os.File
+	w    *bufio.Writer
+}
+
+func (w *mboxWriter) Skip(email *core.Record) bool {
+	return false
+}
+
+// WriteMessage appends the message in mboxrd format: a "From " separator line,
+// the message with LF line endings and every line matching /^>*From / quoted
+// with one more '>', followed by an empty line.
+func (w *mboxWriter) WriteMessage(email *core.Record, flags []string, message io.Reader) error {
+	if _, err := io.WriteString(w.w, "From "+w.sender(email)+" "+w.date(email)+"\n"); err != nil {
+		return err
+	}
+
+	if err := writeMboxrd(w.w, message); err != nil {
+		return err
+	}
+
+	return w.w.WriteByte('\n')
+}
+
+// writeMboxrd writes the message with LF line endings and quotes every line
+// matching /^>*From / with one more '>'.
+func writeMboxrd(w *bufio.Writer, message io.Reader) error {
+	r := bufio.NewReader(message)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(line, []byte("\n"))
+			line = bytes.TrimSuffix(line, []byte("\r"))
+
+			if regexFromLine.Match(line) {
+				if err := w.WriteByte('>'); err != nil {
+					return err
+				}
+			}
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+			if err := w.WriteByte('\n'); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sender returns the envelope sender for the separator line.
+func (w *mboxWriter) sender(email *core.Record) string {
+	from, err := w.app.FindFirstRecordByFilter(
+		"ib_email_from_addresses",
+		"email = {:email}",
+		dbx.Params{"email": email.Id},
+	)
+	if err != nil || from.GetString("email_address") == "" {
+		return "MAILER-DAEMON"
+	}
+
+	return from.GetString("email_address")
+}
+
+func (w *mboxWriter) date(email *core.Record) string {
+	date := email.GetDateTime("received").Time()
+	if date.IsZero() {
+		date = email.GetDateTime("sent").Time()
+	}
+
+	return date.UTC().Format(time.ANSIC)
+}
+
+func (w *mboxWriter) Close() error {
+	err := w.w.Flush()
+	closeErr := w.file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
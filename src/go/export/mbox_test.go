@@ -0,0 +1,69 @@
+package export
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestWriteMboxrd(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		message  string
+		expected string
+	}{
+		{
+			"plain",
+			"Subject: hi\r\n\r\nbody\r\n",
+			"Subject: hi\n\nbody\n",
+		},
+		{
+			"from line",
+			"Subject: hi\r\n\r\nFrom here on\r\n",
+			"Subject: hi\n\n>From here on\n",
+		},
+		{
+			"quoted from lines",
+			"\r\n>From one\r\n>>From two\r\n",
+			"\n>>From one\n>>>From two\n",
+		},
+		{
+			"other lines with from",
+			"from lower case\r\n From indented\r\n>From: no space\r\nFrom\r\n",
+			"from lower case\n From indented\n>From: no space\nFrom\n",
+		},
+		{
+			"missing final line break",
+			"body\r\nFrom the end",
+			"body\n>From the end\n",
+		},
+		{
+			"LF line endings",
+			"a\nFrom b\n",
+			"a\n>From b\n",
+		},
+		{
+			"empty",
+			"",
+			"",
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			result := strings.Builder{}
+			w := bufio.NewWriter(&result)
+
+			if err := writeMboxrd(w, strings.NewReader(s.message)); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if result.String() != s.expected {
+				t.Fatalf("expected %q, got %q", s.expected, result.String())
+			}
+		})
+	}
+}
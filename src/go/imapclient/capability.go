@@ -0,0 +1,14 @@
+package imapclient
+
+import (
+	"strings"
+)
+
+// Capabilities is the set of capabilities a server announced, keyed by their
+// upper case name.
+type Capabilities map[string]bool
+
+// Has reports whether the server announced the given capability.
+func (c Capabilities) Has(capability string) bool {
+	return c[strings.ToUpper(capability)]
+}
@@ -0,0 +1,492 @@
+package imapclient
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout is the time a single command may take before the
+	// connection is considered dead.
+	DefaultTimeout = 5 * time.Minute
+
+	// imapDateTimeFormat is the format of the date-time used by APPEND.
+	imapDateTimeFormat = "02-Jan-2006 15:04:05 -0700"
+)
+
+var regexLiteral = regexp.MustCompile(`\{(\d+)\+?\}\r?\n$`)
+
+// Literal is a command argument that gets sent as an IMAP literal.
+type Literal []byte
+
+// Continuation is the last argument of a command that gets sent on a line
+// of its own once the server asked for it with a continuation request, like
+// the response of a SASL mechanism.
+type Continuation string
+
+// StatusError is returned if the server completed a command with NO or BAD.
+type StatusError struct {
+	Status string
+	Text   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("imap command failed: %s %s", e.Status, e.Text)
+}
+
+// Response is the completion of a command together with every untagged
+// response the server sent while it was running.
+type Response struct {
+	// Untagged holds the untagged responses including the leading "* ",
+	// without the trailing CRLF and with literals inlined.
+	Untagged []string
+	Status   string
+	Text     string
+}
+
+// Client is a minimal IMAP client speaking directly over a connection.
+// It covers what go-imap can not do, most notably commands with
+// synchronizing literals like APPEND.
+type Client struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	nextTag int
+
+	// Timeout limits the duration of every command, zero disables it.
+	Timeout time.Duration
+
+	Capabilities Capabilities
+}
+
+// Dial connects to the server using implicit TLS.
+func Dial(host string, port int, tlsConfig *tls.Config) (*Client, error) {
+	tlsConfig = withServerName(tlsConfig, host)
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, strconv.Itoa(port)), tlsConfig)
+	if err != nil {
+		return nil, certificateError(tlsConfig.ServerName, err)
+	}
+
+	c, err := NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// NewClient reads the server greeting from an established connection and
+// asks for the capabilities of the server.
+func NewClient(conn net.Conn) (*Client, error) {
+	c := &Client{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		Timeout: DefaultTimeout,
+	}
+
+	c.setDeadline()
+	greeting, err := c.readLine()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read greeting: %w", err)
+	}
+
+	switch {
+	case strings.HasPrefix(greeting, "* OK"), strings.HasPrefix(greeting, "* PREAUTH"):
+	case strings.HasPrefix(greeting, "* BYE"):
+		return nil, fmt.Errorf("server rejected connection: %s", greeting)
+	default:
+		return nil, fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+
+	if err := c.Capability(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close closes the connection without logging out.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Logout logs out and closes the connection.
+func (c *Client) Logout() error {
+	_, err := c.Execute("LOGOUT")
+	closeErr := c.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// Quote returns the argument for a string, either as quoted string or as
+// literal if it can not be quoted.
+func Quote(s string) any {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\r' || s[i] == '\n' || s[i] == 0 || s[i] > 0x7f {
+			return Literal(s)
+		}
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (c *Client) setDeadline() {
+	if c.Timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	} else {
+		c.conn.SetDeadline(time.Time{})
+	}
+}
+
+// readLine reads one response line, including every literal it contains.
+func (c *Client) readLine() (string, error) {
+	line := strings.Builder{}
+
+	for {
+		part, err := c.r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line.WriteString(part)
+
+		match := regexLiteral.FindStringSubmatch(part)
+		if match == nil {
+			break
+		}
+
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			return "", err
+		}
+
+		if _, err := io.CopyN(&line, c.r, int64(n)); err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimRight(line.String(), "\r\n"), nil
+}
+
+// Execute sends a command and waits for its completion. Arguments of type
+// Literal are sent as synchronizing literals, a Continuation once the server
+// asked for it, everything else is formatted with fmt and sent as is, so
+// strings have to be quoted using Quote.
+func (c *Client) Execute(args ...any) (*Response, error) {
+	return c.ExecuteFunc(nil, args...)
+}
+
+// ExecuteFunc works like Execute, but calls onUntagged for every untagged
+// response as soon as it arrives.
+func (c *Client) ExecuteFunc(onUntagged func(line string), args ...any) (*Response, error) {
+	c.nextTag++
+	tag := fmt.Sprintf("A%04d", c.nextTag)
+
+	c.setDeadline()
+
+	response := &Response{
+		Untagged: make([]string, 0),
+	}
+
+	// waitFor reads responses until either a continuation request arrives,
+	// or the command completes.
+	waitFor := func(continuation bool) (bool, error) {
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return false, err
+			}
+
+			switch {
+			case strings.HasPrefix(line, "+"):
+				if continuation {
+					return true, nil
+				}
+
+				// a failed SASL exchange sends its error as challenge, answering
+				// it with an empty response lets the server complete the command
+				if _, err := io.WriteString(c.conn, "\r\n"); err != nil {
+					return false, err
+				}
+			case strings.HasPrefix(line, "* "):
+				response.Untagged = append(response.Untagged, line)
+				if onUntagged != nil {
+					onUntagged(line)
+				}
+			case strings.HasPrefix(line, tag+" "):
+				status, text, _ := strings.Cut(line[len(tag)+1:], " ")
+				response.Status = strings.ToUpper(status)
+				response.Text = text
+				return false, nil
+			}
+		}
+	}
+
+	command := strings.Builder{}
+	command.WriteString(tag)
+
+	for _, arg := range args {
+		if continuation, ok := arg.(Continuation); ok {
+			command.WriteString("\r\n")
+			if _, err := io.WriteString(c.conn, command.String()); err != nil {
+				return nil, err
+			}
+			command.Reset()
+
+			continued, err := waitFor(true)
+			if err != nil {
+				return nil, err
+			}
+			if !continued {
+				return response, &StatusError{Status: response.Status, Text: response.Text}
+			}
+
+			command.WriteString(string(continuation))
+			continue
+		}
+
+		command.WriteByte(' ')
+
+		literal, ok := arg.(Literal)
+		if !ok {
+			fmt.Fprint(&command, arg)
+			continue
+		}
+
+		fmt.Fprintf(&command, "{%d}\r\n", len(literal))
+		if _, err := io.WriteString(c.conn, command.String()); err != nil {
+			return nil, err
+		}
+		command.Reset()
+
+		continued, err := waitFor(true)
+		if err != nil {
+			return nil, err
+		}
+		if !continued {
+			return response, &StatusError{Status: response.Status, Text: response.Text}
+		}
+
+		if _, err := c.conn.Write(literal); err != nil {
+			return nil, err
+		}
+	}
+
+	command.WriteString("\r\n")
+	if _, err := io.WriteString(c.conn, command.String()); err != nil {
+		return nil, err
+	}
+
+	if _, err := waitFor(false); err != nil {
+		return nil, err
+	}
+
+	if response.Status != "OK" {
+		return response, &StatusError{Status: response.Status, Text: response.Text}
+	}
+
+	return response, nil
+}
+
+// IsStatusError reports whether err is the server refusing a command,
+// instead of a connection or protocol problem.
+func IsStatusError(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr)
+}
+
+// IsConnectionError reports whether err means that the connection is broken,
+// so that no further command can be sent over it.
+func IsConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.As(err, &netErr)
+}
+
+// Capability asks the server for its capabilities and stores them in Capabilities.
+func (c *Client) Capability() error {
+	r, err := c.Execute("CAPABILITY")
+	if err != nil {
+		return err
+	}
+
+	c.Capabilities = parseCapabilities(r.Untagged)
+
+	return nil
+}
+
+func parseCapabilities(lines []string) Capabilities {
+	capabilities := Capabilities{}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "*" || !strings.EqualFold(fields[1], "CAPABILITY") {
+			continue
+		}
+
+		for _, capability := range fields[2:] {
+			capabilities[strings.ToUpper(capability)] = true
+		}
+	}
+
+	return capabilities
+}
+
+// Login authenticates with username and password.
+func (c *Client) Login(username, password string) error {
+	if err := c.loginAllowed(); err != nil {
+		return err
+	}
+
+	if _, err := c.Execute("LOGIN", Quote(username), Quote(password)); err != nil {
+		return err
+	}
+
+	// servers are allowed to announce different capabilities after login
+	return c.Capability()
+}
+
+// AuthenticateXOAuth2 authenticates with an OAuth2 access token using the
+// SASL mechanism XOAUTH2. The token is sent with the command if the server
+// supports SASL-IR, otherwise after the server asked for it.
+func (c *Client) AuthenticateXOAuth2(username, accessToken string) error {
+	if !c.Capabilities.Has("AUTH=XOAUTH2") {
+		return errors.New("server does not support XOAUTH2")
+	}
+
+	response := base64.StdEncoding.EncodeToString([]byte("user=" + username + "\x01auth=Bearer " + accessToken + "\x01\x01"))
+
+	var err error
+	if c.Capabilities.Has("SASL-IR") {
+		_, err = c.Execute("AUTHENTICATE XOAUTH2", response)
+	} else {
+		_, err = c.Execute("AUTHENTICATE XOAUTH2", Continuation(response))
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.Capability()
+}
+
+// Select opens the folder, read-only if readOnly is set.
+func (c *Client) Select(folder string, readOnly bool) (*FolderStatus, error) {
+	command := "SELECT"
+	if readOnly {
+		command = "EXAMINE"
+	}
+
+	r, err := c.Execute(command, Quote(folder))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFolderStatus(folder, strings.Join(r.Untagged, "\r\n"))
+}
+
+// Create creates a new folder.
+func (c *Client) Create(folder string) error {
+	_, err := c.Execute("CREATE", Quote(folder))
+	return err
+}
+
+// UIDSearch returns the UIDs of the messages in the selected folder that
+// match the search criteria.
+func (c *Client) UIDSearch(criteria ...any) ([]int, error) {
+	r, err := c.Execute(append([]any{"UID SEARCH"}, criteria...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	uids := make([]int, 0)
+	for _, line := range r.Untagged {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[1], "SEARCH") {
+			continue
+		}
+
+		for _, field := range fields[2:] {
+			uid, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SEARCH response %q: %w", line, err)
+			}
+			uids = append(uids, uid)
+		}
+	}
+
+	return uids, nil
+}
+
+// FetchRaw returns the complete messages with the given UIDs from the
+// selected folder, keyed by their UID.
+func (c *Client) FetchRaw(uids ...int) (map[int][]byte, error) {
+	messages := make(map[int][]byte, len(uids))
+	if len(uids) == 0 {
+		return messages, nil
+	}
+
+	r, err := c.Execute("UID FETCH", joinUIDs(uids), "BODY.PEEK[]")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range r.Untagged {
+		if !regexFetchLine.MatchString(line) {
+			continue
+		}
+
+		uid := 0
+		var raw []byte
+		err := fetchAttributes(line, func(name string, value string) error {
+			var err error
+			switch name {
+			case "UID":
+				uid, err = strconv.Atoi(value)
+			case "BODY[]":
+				raw = []byte(value)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid FETCH response: %w", err)
+		}
+
+		if uid != 0 && raw != nil {
+			messages[uid] = raw
+		}
+	}
+
+	return messages, nil
+}
+
+// Append adds the message to the folder with the given flags and internal date.
+func (c *Client) Append(folder string, flags []string, date time.Time, message []byte) error {
+	args := []any{"APPEND", Quote(folder)}
+
+	if len(flags) > 0 {
+		args = append(args, "("+strings.Join(flags, " ")+")")
+	}
+
+	if !date.IsZero() {
+		args = append(args, `"`+date.Format(imapDateTimeFormat)+`"`)
+	}
+
+	args = append(args, Literal(message))
+
+	_, err := c.Execute(args...)
+	return err
+}
@@ -0,0 +1,161 @@
+package imapclient
+
+import (
+	"bufio"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// exchange is a line the scripted server expects and the lines it answers with.
+type exchange struct {
+	expect string
+	reply  []string
+}
+
+// scriptedServer returns a client connected to a server that greets it and
+// answers CAPABILITY with the given capabilities. Every further line has to
+// match the script. The returned function waits for the server and returns
+// the lines it received after the greeting.
+func scriptedServer(t *testing.T, capabilities string, script []exchange) (*Client, func() []string) {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+
+	script = append([]exchange{{
+		expect: "A0001 CAPABILITY",
+		reply:  []string{"* CAPABILITY " + capabilities, "A0001 OK done"},
+	}}, script...)
+
+	received := make(chan []string, 1)
+	go func() {
+		defer serverConn.Close()
+
+		lines := []string{}
+		defer func() { received <- lines }()
+
+		r := bufio.NewReader(serverConn)
+		if _, err := serverConn.Write([]byte("* OK ready\r\n")); err != nil {
+			return
+		}
+
+		for _, step := range script {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+
+			if line != step.expect {
+				return
+			}
+
+			for _, reply := range step.reply {
+				if _, err := serverConn.Write([]byte(reply + "\r\n")); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	c, err := NewClient(clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c, func() []string {
+		c.Close()
+		return <-received
+	}
+}
+
+func TestAuthenticateXOAuth2(t *testing.T) {
+	// base64 of "user=alice@example.org\x01auth=Bearer token\x01\x01"
+	const response = "dXNlcj1hbGljZUBleGFtcGxlLm9yZwFhdXRoPUJlYXJlciB0b2tlbgEB"
+
+	capabilities := []exchange{{
+		expect: "A0003 CAPABILITY",
+		reply:  []string{"* CAPABILITY IMAP4rev1", "A0003 OK done"},
+	}}
+
+	scenarios := []struct {
+		name         string
+		capabilities string
+		script       []exchange
+		err          bool
+	}{
+		{
+			"initial response",
+			"IMAP4rev1 AUTH=XOAUTH2 SASL-IR",
+			append([]exchange{{
+				expect: "A0002 AUTHENTICATE XOAUTH2 " + response,
+				reply:  []string{"A0002 OK authenticated"},
+			}}, capabilities...),
+			false,
+		},
+		{
+			"continuation",
+			"IMAP4rev1 AUTH=XOAUTH2",
+			append([]exchange{
+				{expect: "A0002 AUTHENTICATE XOAUTH2", reply: []string{"+ "}},
+				{expect: response, reply: []string{"A0002 OK authenticated"}},
+			}, capabilities...),
+			false,
+		},
+		{
+			"continuation rejected",
+			"IMAP4rev1 AUTH=XOAUTH2",
+			[]exchange{
+				{expect: "A0002 AUTHENTICATE XOAUTH2", reply: []string{"+ "}},
+				{expect: response, reply: []string{"+ eyJzdGF0dXMiOiI0MDEifQ=="}},
+				{expect: "", reply: []string{"A0002 NO invalid credentials"}},
+			},
+			true,
+		},
+		{
+			"command rejected",
+			"IMAP4rev1 AUTH=XOAUTH2",
+			[]exchange{
+				{expect: "A0002 AUTHENTICATE XOAUTH2", reply: []string{"A0002 NO disabled"}},
+			},
+			true,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			c, wait := scriptedServer(t, s.capabilities, s.script)
+
+			err := c.AuthenticateXOAuth2("alice@example.org", "token")
+			if s.err != (err != nil) {
+				t.Fatalf("expected an error to be %v, got %v", s.err, err)
+			}
+			if s.err && !IsStatusError(err) {
+				t.Fatalf("expected a status error, got %v", err)
+			}
+
+			expected := []string{"A0001 CAPABILITY"}
+			for _, step := range s.script {
+				expected = append(expected, step.expect)
+			}
+
+			if lines := wait(); !slices.Equal(lines, expected) {
+				t.Fatalf("expected the server to receive %q, got %q", expected, lines)
+			}
+		})
+	}
+}
+
+func TestAuthenticateXOAuth2Unsupported(t *testing.T) {
+	c, wait := scriptedServer(t, "IMAP4rev1 SASL-IR", nil)
+
+	if err := c.AuthenticateXOAuth2("alice@example.org", "token"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if lines := wait(); len(lines) != 1 {
+		t.Fatalf("expected no command to be sent, got %q", lines)
+	}
+}
@@ -0,0 +1,157 @@
+package imapclient
+
+import (
+	"bytes"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/BrianLeishman/go-imap"
+	"github.com/jhillyerd/enmime"
+)
+
+// Email is an imap.Email together with the raw RFC 822 message it was parsed from.
+type Email struct {
+	*imap.Email
+	Raw []byte
+}
+
+// GetEmails works like imap.Dialer.GetEmails, but keeps the complete BODY[]
+// literal of every message. Messages whose body can not be parsed are still
+// returned with their overview and raw message, instead of being dropped.
+func (c *Client) GetEmails(uids ...int) (map[int]*Email, error) {
+	emails := make(map[int]*Email, len(uids))
+	if len(uids) == 0 {
+		return emails, nil
+	}
+
+	overviews, err := c.GetOverviews(uids...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(overviews) == 0 {
+		return emails, nil
+	}
+
+	overviewUIDs := make([]int, 0, len(overviews))
+	for uid := range overviews {
+		overviewUIDs = append(overviewUIDs, uid)
+	}
+
+	records, _, err := c.fetch("UID FETCH", joinUIDs(overviewUIDs), "BODY.PEEK[]")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tks := range records {
+		uid := 0
+		var raw []byte
+
+		for i := 0; i+1 < len(tks); i += 2 {
+			if err = checkType(tks[i], []imap.TType{imap.TLiteral}, tks, "in root"); err != nil {
+				return nil, err
+			}
+
+			switch tks[i].Str {
+			case "BODY[]":
+				if err = checkType(tks[i+1], []imap.TType{imap.TAtom, imap.TQuoted}, tks, "after BODY[]"); err != nil {
+					return nil, err
+				}
+				raw = []byte(tks[i+1].Str)
+			case "UID":
+				if err = checkType(tks[i+1], []imap.TType{imap.TNumber}, tks, "after UID"); err != nil {
+					return nil, err
+				}
+				uid = tks[i+1].Num
+			}
+		}
+
+		overview, ok := overviews[uid]
+		if !ok || raw == nil {
+			continue
+		}
+
+		if err := parseBody(overview, raw); err != nil {
+			log.Printf("body of email with UID %d could not be parsed, storing raw message only: %v\n", uid, err)
+		}
+
+		emails[uid] = &Email{
+			Email: overview,
+			Raw:   raw,
+		}
+	}
+
+	return emails, nil
+}
+
+// ParseEmail builds an Email from a raw RFC 822 message that was not fetched
+// from a server. The overview fields are filled the way a server would report
+// them, so the email compares equal to the same message when it gets synced.
+func ParseEmail(raw []byte, received time.Time, flags []string) *Email {
+	e := &imap.Email{
+		Flags:    flags,
+		Received: received.UTC(),
+		Size:     uint64(len(raw)),
+	}
+
+	if message, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		e.MessageID = message.Header.Get("Message-ID")
+		if sent, err := mail.ParseDate(message.Header.Get("Date")); err == nil {
+			e.Sent = sent.UTC()
+		}
+	}
+
+	if err := parseBody(e, raw); err != nil {
+		log.Printf("body of email could not be parsed, storing raw message only: %v\n", err)
+	}
+
+	return &Email{
+		Email: e,
+		Raw:   raw,
+	}
+}
+
+// parseBody fills the body related fields of the email the same way
+// imap.Dialer.GetEmails does.
+func parseBody(e *imap.Email, raw []byte) error {
+	env, err := enmime.ReadEnvelope(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+
+	e.Subject = env.GetHeader("Subject")
+	e.Text = env.Text
+	e.HTML = env.HTML
+
+	e.Attachments = make([]imap.Attachment, 0, len(env.Attachments)+len(env.Inlines))
+	for _, parts := range [][]*enmime.Part{env.Attachments, env.Inlines} {
+		for _, a := range parts {
+			e.Attachments = append(e.Attachments, imap.Attachment{
+				Name:     a.FileName,
+				MimeType: a.ContentType,
+				Content:  a.Content,
+			})
+		}
+	}
+
+	for _, a := range []struct {
+		dest   *imap.EmailAddresses
+		header string
+	}{
+		{&e.From, "From"},
+		{&e.ReplyTo, "Reply-To"},
+		{&e.To, "To"},
+		{&e.CC, "cc"},
+		{&e.BCC, "bcc"},
+	} {
+		alist, _ := env.AddressList(a.header)
+		(*a.dest) = make(map[string]string, len(alist))
+		for _, addr := range alist {
+			(*a.dest)[strings.ToLower(addr.Address)] = addr.Name
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package imapclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEmail(t *testing.T) {
+	received := time.Date(2024, 5, 2, 8, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	scenarios := []struct {
+		name      string
+		raw       string
+		sent      time.Time
+		messageID string
+	}{
+		{
+			"RFC 5322 date",
+			"Message-ID: <a@example.org>\r\nDate: Wed, 01 May 2024 12:30:00 +0200\r\n\r\nbody\r\n",
+			time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC),
+			"<a@example.org>",
+		},
+		{
+			"single digit day",
+			"Date: Wed, 1 May 2024 12:30:00 +0200\r\n\r\nbody\r\n",
+			time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC),
+			"",
+		},
+		{
+			"without weekday",
+			"Date: 1 May 2024 12:30:00 -0000\r\n\r\nbody\r\n",
+			time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+			"",
+		},
+		{
+			"without seconds",
+			"Date: Wed, 1 May 2024 12:30 +0000\r\n\r\nbody\r\n",
+			time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+			"",
+		},
+		{
+			"obsolete zone with comment",
+			"Date: Wed, 1 May 2024 12:30:00 GMT (UTC)\r\n\r\nbody\r\n",
+			time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+			"",
+		},
+		{
+			"invalid date",
+			"Date: yesterday\r\n\r\nbody\r\n",
+			time.Time{},
+			"",
+		},
+		{
+			"missing date",
+			"Subject: hi\r\n\r\nbody\r\n",
+			time.Time{},
+			"",
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			email := ParseEmail([]byte(s.raw), received, []string{`\Seen`})
+
+			if !email.Sent.Equal(s.sent) {
+				t.Errorf("expected sent date %v, got %v", s.sent, email.Sent)
+			}
+			if email.Sent.Location() != time.UTC {
+				t.Errorf("expected sent date in UTC, got %v", email.Sent.Location())
+			}
+			if !email.Received.Equal(received) || email.Received.Location() != time.UTC {
+				t.Errorf("expected received date %v in UTC, got %v", received, email.Received)
+			}
+			if email.MessageID != s.messageID {
+				t.Errorf("expected Message-ID %q, got %q", s.messageID, email.MessageID)
+			}
+			if email.Size != uint64(len(s.raw)) {
+				t.Errorf("expected size %d, got %d", len(s.raw), email.Size)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package imapclient
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BrianLeishman/go-imap"
+)
+
+var regexFetchLine = regexp.MustCompile(`^\*\s+\d+\s+FETCH\s`)
+
+// fetch executes the given FETCH command and returns the tokens of every
+// FETCH response the server sent, parsed by the go-imap fetch parser,
+// together with the response lines they were parsed from.
+func (c *Client) fetch(args ...any) ([][]*imap.Token, []string, error) {
+	// Only the FETCH responses are collected, the server is free to send
+	// unrelated untagged responses which the fetch parser would choke on.
+	lines := make([]string, 0)
+	fetchResponse := strings.Builder{}
+	_, err := c.ExecuteFunc(func(line string) {
+		if regexFetchLine.MatchString(line) {
+			lines = append(lines, line)
+			fetchResponse.WriteString(line)
+			fetchResponse.WriteString("\r\n")
+		}
+	}, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if fetchResponse.Len() == 0 {
+		return [][]*imap.Token{}, lines, nil
+	}
+
+	// the parser keeps its state in the dialer, so every response needs its own
+	records, err := (&imap.Dialer{}).ParseFetchResponse(fetchResponse.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) != len(lines) {
+		return nil, nil, fmt.Errorf("parsed %d FETCH response(s) from %d line(s)", len(records), len(lines))
+	}
+
+	return records, lines, nil
+}
+
+// parseFlags returns the FLAGS of a FETCH response line. They are parsed
+// here, because the go-imap fetch parser drops characters like '$' or '-'
+// from keywords.
+func parseFlags(line string) ([]string, error) {
+	flags := []string{}
+	err := fetchAttributes(line, func(name string, value string) error {
+		if name == "FLAGS" {
+			flags = strings.Fields(value)
+		}
+		return nil
+	})
+
+	return flags, err
+}
+
+// checkType returns an error if the token is none of the acceptable types.
+func checkType(token *imap.Token, acceptableTypes []imap.TType, tks []*imap.Token, loc string, v ...any) error {
+	if token == nil {
+		return fmt.Errorf("missing token %s in %v", fmt.Sprintf(loc, v...), tks)
+	}
+	return (&imap.Dialer{}).CheckType(token, acceptableTypes, tks, loc, v...)
+}
+
+// joinUIDs formats the UIDs as a comma separated sequence set.
+func joinUIDs(uids []int) string {
+	uidsStr := strings.Builder{}
+	i := 0
+	for _, u := range uids {
+		if u == 0 {
+			continue
+		}
+
+		if i != 0 {
+			uidsStr.WriteByte(',')
+		}
+		uidsStr.WriteString(strconv.Itoa(u))
+		i++
+	}
+	return uidsStr.String()
+}
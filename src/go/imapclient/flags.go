@@ -0,0 +1,70 @@
+package imapclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MessageFlags are the flags of a single message in the selected folder.
+type MessageFlags struct {
+	UID    int
+	Flags  []string
+	ModSeq uint64
+}
+
+// FetchFlags returns the flags of every message in the given UID range of the
+// selected folder. If changedSince is greater than zero, the CONDSTORE
+// CHANGEDSINCE modifier is used, so only messages whose flags changed after
+// that modification sequence are returned.
+func (c *Client) FetchFlags(uidRange string, changedSince uint64) ([]MessageFlags, error) {
+	args := []any{"UID FETCH", uidRange, "(UID FLAGS)"}
+	if changedSince > 0 {
+		args = append(args, fmt.Sprintf("(CHANGEDSINCE %d)", changedSince))
+	}
+
+	r, err := c.Execute(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]MessageFlags, 0, len(r.Untagged))
+	for _, line := range r.Untagged {
+		if !regexFetchLine.MatchString(line) {
+			continue
+		}
+
+		message, err := parseFlagsFetch(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FETCH response %q: %w", line, err)
+		}
+
+		if message.UID != 0 {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+// parseFlagsFetch parses a FETCH response line with UID, FLAGS and MODSEQ.
+func parseFlagsFetch(line string) (MessageFlags, error) {
+	message := MessageFlags{
+		Flags: []string{},
+	}
+
+	err := fetchAttributes(line, func(name string, value string) error {
+		var err error
+		switch name {
+		case "UID":
+			message.UID, err = strconv.Atoi(value)
+		case "FLAGS":
+			message.Flags = strings.Fields(value)
+		case "MODSEQ":
+			message.ModSeq, err = strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		}
+		return err
+	})
+
+	return message, err
+}
@@ -0,0 +1,268 @@
+package imapclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFetchFlags(t *testing.T) {
+	scenarios := []struct {
+		name         string
+		changedSince uint64
+		command      string
+		reply        []string
+		expected     []MessageFlags
+	}{
+		{
+			name:    "flags",
+			command: "A0002 UID FETCH 1:* (UID FLAGS)",
+			reply: []string{
+				`* 1 FETCH (UID 5 FLAGS (\Seen \Flagged))`,
+				`* 2 FETCH (FLAGS () UID 7)`,
+				"A0002 OK done",
+			},
+			expected: []MessageFlags{
+				{UID: 5, Flags: []string{`\Seen`, `\Flagged`}},
+				{UID: 7, Flags: []string{}},
+			},
+		},
+		{
+			name:         "changed since",
+			changedSince: 41,
+			command:      "A0002 UID FETCH 1:* (UID FLAGS) (CHANGEDSINCE 41)",
+			reply: []string{
+				`* 3 FETCH (UID 9 MODSEQ (42) FLAGS ($Forwarded \Answered))`,
+				"* 4 EXPUNGE",
+				"A0002 OK done",
+			},
+			expected: []MessageFlags{
+				{UID: 9, Flags: []string{"$Forwarded", `\Answered`}, ModSeq: 42},
+			},
+		},
+		{
+			name:     "nothing changed",
+			command:  "A0002 UID FETCH 1:* (UID FLAGS)",
+			reply:    []string{"A0002 OK done"},
+			expected: []MessageFlags{},
+		},
+		{
+			name:    "without UID",
+			command: "A0002 UID FETCH 1:* (UID FLAGS)",
+			reply: []string{
+				`* 1 FETCH (FLAGS (\Seen))`,
+				"A0002 OK done",
+			},
+			expected: []MessageFlags{},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			c, wait := scriptedServer(t, "IMAP4rev1 CONDSTORE", []exchange{{expect: s.command, reply: s.reply}})
+
+			messages, err := c.FetchFlags("1:*", s.changedSince)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(messages, s.expected) {
+				t.Fatalf("expected %+v, got %+v", s.expected, messages)
+			}
+
+			if lines := wait(); lines[len(lines)-1] != s.command {
+				t.Fatalf("expected command %q, got %q", s.command, lines[len(lines)-1])
+			}
+		})
+	}
+}
+
+func TestParseFlagsFetch(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		line     string
+		expected MessageFlags
+		err      bool
+	}{
+		{
+			name:     "flags",
+			line:     `* 1 FETCH (UID 5 FLAGS (\Seen \Flagged))`,
+			expected: MessageFlags{UID: 5, Flags: []string{`\Seen`, `\Flagged`}},
+		},
+		{
+			name:     "keywords and modification sequence",
+			line:     `* 3 FETCH (UID 9 MODSEQ (42) FLAGS ($Forwarded Junk-Mail \Answered))`,
+			expected: MessageFlags{UID: 9, Flags: []string{"$Forwarded", "Junk-Mail", `\Answered`}, ModSeq: 42},
+		},
+		{
+			name:     "no flags",
+			line:     `* 2 FETCH (FLAGS () UID 7)`,
+			expected: MessageFlags{UID: 7, Flags: []string{}},
+		},
+		{
+			name:     "after other attributes",
+			line:     `* 1 FETCH (X-UNKNOWN ("FLAGS (\Draft) \"(\"" NIL) UID 4 FLAGS ($NotJunk))`,
+			expected: MessageFlags{UID: 4, Flags: []string{"$NotJunk"}},
+		},
+		{
+			name:     "without UID",
+			line:     `* 1 FETCH (FLAGS (\Seen))`,
+			expected: MessageFlags{Flags: []string{`\Seen`}},
+		},
+		{
+			name: "unterminated",
+			line: `* 1 FETCH (UID 3 FLAGS (\Seen`,
+			err:  true,
+		},
+		{
+			name: "invalid UID",
+			line: `* 1 FETCH (UID x FLAGS ())`,
+			err:  true,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			message, err := parseFlagsFetch(s.line)
+			if s.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(message, s.expected) {
+				t.Fatalf("expected %+v, got %+v", s.expected, message)
+			}
+		})
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		lines    []string
+		expected Capabilities
+	}{
+		{
+			"single line",
+			[]string{"* CAPABILITY IMAP4rev1 CONDSTORE auth=xoauth2"},
+			Capabilities{"IMAP4REV1": true, "CONDSTORE": true, "AUTH=XOAUTH2": true},
+		},
+		{
+			"several lines and unrelated responses",
+			[]string{"* OK still here", "* capability IMAP4rev1", "* CAPABILITY IDLE"},
+			Capabilities{"IMAP4REV1": true, "IDLE": true},
+		},
+		{
+			"none",
+			[]string{"* CAPABILITY"},
+			Capabilities{},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			capabilities := parseCapabilities(s.lines)
+			if !reflect.DeepEqual(capabilities, s.expected) {
+				t.Fatalf("expected %v, got %v", s.expected, capabilities)
+			}
+
+			for capability := range s.expected {
+				if !capabilities.Has(capability) {
+					t.Fatalf("expected %s to be announced", capability)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		line     string
+		expected []string
+		err      bool
+	}{
+		{
+			name:     "keywords",
+			line:     `* 1 FETCH (UID 3 FLAGS (\Seen $Forwarded Junk-Mail $label1))`,
+			expected: []string{`\Seen`, "$Forwarded", "Junk-Mail", "$label1"},
+		},
+		{
+			name:     "after envelope",
+			line:     `* 1 FETCH (ENVELOPE ("Mon, 1 Jan 2024 10:00:00 +0000" "FLAGS (\Draft) \"(\"" NIL NIL NIL NIL NIL NIL NIL "<id@example.org>") FLAGS ($NotJunk))`,
+			expected: []string{"$NotJunk"},
+		},
+		{
+			name:     "after literal",
+			line:     "* 1 FETCH (ENVELOPE (NIL {12}\r\n) FLAGS (\\x) NIL NIL NIL NIL NIL NIL NIL NIL) FLAGS (\\Answered))",
+			expected: []string{`\Answered`},
+		},
+		{
+			name:     "no flags",
+			line:     `* 1 FETCH (UID 3 FLAGS ())`,
+			expected: []string{},
+		},
+		{
+			name:     "not fetched",
+			line:     `* 1 FETCH (UID 3)`,
+			expected: []string{},
+		},
+		{
+			name: "unterminated",
+			line: `* 1 FETCH (UID 3 FLAGS (\Seen`,
+			err:  true,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			flags, err := parseFlags(s.line)
+			if s.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", flags)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(flags, s.expected) {
+				t.Fatalf("expected %q, got %q", s.expected, flags)
+			}
+		})
+	}
+}
+
+func TestGetOverviewsFlags(t *testing.T) {
+	c, wait := scriptedServer(t, "IMAP4rev1", []exchange{{
+		expect: "A0002 UID FETCH 4 ALL",
+		reply: []string{
+			`* 1 FETCH (UID 4 FLAGS (\Seen $Forwarded) INTERNALDATE "01-Jan-2024 10:00:00 +0000" RFC822.SIZE 120 ` +
+				`ENVELOPE ("Mon, 1 Jan 2024 10:00:00 +0000" "Hello" NIL NIL NIL NIL NIL NIL NIL "<id@example.org>"))`,
+			"A0002 OK done",
+		},
+	}})
+	defer wait()
+
+	overviews, err := c.GetOverviews(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overview, ok := overviews[4]
+	if !ok {
+		t.Fatalf("expected an overview of UID 4, got %v", overviews)
+	}
+
+	if expected := []string{`\Seen`, "$Forwarded"}; !reflect.DeepEqual(overview.Flags, expected) {
+		t.Fatalf("expected flags %q, got %q", expected, overview.Flags)
+	}
+	if overview.Subject != "Hello" || overview.Size != 120 {
+		t.Fatalf("expected subject Hello and size 120, got %q and %d", overview.Subject, overview.Size)
+	}
+}
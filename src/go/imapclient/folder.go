@@ -0,0 +1,133 @@
+package imapclient
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	regexExists      = regexp.MustCompile(`(?m)^\*\s+(\d+)\s+EXISTS`)
+	regexUIDValidity = regexp.MustCompile(`\[UIDVALIDITY\s+(\d+)\]`)
+	regexUIDNext     = regexp.MustCompile(`\[UIDNEXT\s+(\d+)\]`)
+	regexModSeq      = regexp.MustCompile(`\[HIGHESTMODSEQ\s+(\d+)\]`)
+)
+
+// FolderStatus holds the state a server reports when a folder gets selected.
+type FolderStatus struct {
+	Name        string
+	Exists      int
+	UIDValidity uint32
+	UIDNext     uint32
+
+	// HighestModSeq is only set if CONDSTORE was requested and the folder
+	// supports modification sequences.
+	HighestModSeq uint64
+}
+
+// Examine selects the folder read-only and returns the status the server sent
+// along with the EXAMINE response. If condStore is true, the CONDSTORE
+// parameter is sent as well, which makes the server report the highest
+// modification sequence of the folder.
+func (c *Client) Examine(folder string, condStore bool) (*FolderStatus, error) {
+	args := []any{"EXAMINE", Quote(folder)}
+	if condStore {
+		args = append(args, "(CONDSTORE)")
+	}
+
+	r, err := c.Execute(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFolderStatus(folder, strings.Join(r.Untagged, "\r\n"))
+}
+
+// parseFolderStatus extracts the folder status from the untagged responses
+// of a SELECT or EXAMINE command.
+func parseFolderStatus(folder string, r string) (*FolderStatus, error) {
+	var err error
+	status := &FolderStatus{
+		Name: folder,
+	}
+
+	if match := regexExists.FindStringSubmatch(r); match != nil {
+		status.Exists, err = strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid EXISTS response %q: %w", match[0], err)
+		}
+	}
+
+	if match := regexUIDValidity.FindStringSubmatch(r); match != nil {
+		uidValidity, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UIDVALIDITY response %q: %w", match[0], err)
+		}
+		status.UIDValidity = uint32(uidValidity)
+	}
+
+	if match := regexUIDNext.FindStringSubmatch(r); match != nil {
+		uidNext, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UIDNEXT response %q: %w", match[0], err)
+		}
+		status.UIDNext = uint32(uidNext)
+	}
+
+	if match := regexModSeq.FindStringSubmatch(r); match != nil {
+		status.HighestModSeq, err = strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HIGHESTMODSEQ response %q: %w", match[0], err)
+		}
+	}
+
+	return status, nil
+}
+
+// Status returns the number of messages, the UIDVALIDITY and the UIDNEXT of
+// the folder without selecting it.
+func (c *Client) Status(folder string) (*FolderStatus, error) {
+	r, err := c.Execute("STATUS", Quote(folder), "(MESSAGES UIDVALIDITY UIDNEXT)")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range r.Untagged {
+		rest, ok := cutPrefixFold(line, "* STATUS ")
+		if !ok {
+			continue
+		}
+
+		_, rest, err := parseString(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid STATUS response %q: %w", line, err)
+		}
+		rest = strings.Trim(strings.TrimSpace(rest), "()")
+
+		status := &FolderStatus{
+			Name: folder,
+		}
+
+		items := strings.Fields(rest)
+		for i := 0; i+1 < len(items); i += 2 {
+			value, err := strconv.ParseUint(items[i+1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid STATUS response %q: %w", line, err)
+			}
+
+			switch strings.ToUpper(items[i]) {
+			case "MESSAGES":
+				status.Exists = int(value)
+			case "UIDVALIDITY":
+				status.UIDValidity = uint32(value)
+			case "UIDNEXT":
+				status.UIDNext = uint32(value)
+			}
+		}
+
+		return status, nil
+	}
+
+	return nil, fmt.Errorf("missing STATUS response for folder %s", folder)
+}
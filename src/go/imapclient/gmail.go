@@ -0,0 +1,161 @@
+package imapclient
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// GmailExtension is the capability of servers that support the Gmail
+// extensions X-GM-MSGID, X-GM-THRID and X-GM-LABELS.
+const GmailExtension = "X-GM-EXT-1"
+
+// GmailMessage holds the Gmail attributes of a single message.
+type GmailMessage struct {
+	UID int
+
+	// MsgID identifies the message across every folder of the account and
+	// never changes.
+	MsgID uint64
+
+	// ThrID identifies the conversation the message belongs to.
+	ThrID uint64
+
+	// Labels are the decoded labels of the message, system labels like
+	// \Inbox or \Starred keep their backslash.
+	Labels []string
+}
+
+// IsGmail reports whether the server supports the Gmail extensions.
+func (c *Client) IsGmail() bool {
+	return c.Capabilities.Has(GmailExtension)
+}
+
+// FetchGmail returns the Gmail attributes of the messages with the given UIDs
+// in the selected folder. The responses are parsed here, because the go-imap
+// fetch parser splits attribute names and labels at every hyphen.
+func (c *Client) FetchGmail(uids ...int) (map[int]*GmailMessage, error) {
+	messages := make(map[int]*GmailMessage, len(uids))
+	if len(uids) == 0 {
+		return messages, nil
+	}
+
+	r, err := c.Execute("UID FETCH", joinUIDs(uids), "(UID X-GM-MSGID X-GM-THRID X-GM-LABELS)")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range r.Untagged {
+		if !regexFetchLine.MatchString(line) {
+			continue
+		}
+
+		start := strings.IndexByte(line, '(')
+		if start == -1 {
+			return nil, fmt.Errorf("invalid FETCH response %q", line)
+		}
+
+		message, err := parseGmailFetch(line[start+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid FETCH response %q: %w", line, err)
+		}
+
+		if message.UID != 0 {
+			messages[message.UID] = message
+		}
+	}
+
+	return messages, nil
+}
+
+// parseGmailFetch parses the attributes of a FETCH response after the opening
+// parenthesis. Attributes other than the Gmail ones and the UID are skipped.
+func parseGmailFetch(s string) (*GmailMessage, error) {
+	message := &GmailMessage{
+		Labels: []string{},
+	}
+
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return nil, errors.New("unterminated attribute list")
+		}
+		if s[0] == ')' {
+			return message, nil
+		}
+
+		end := strings.IndexByte(s, ' ')
+		if end == -1 {
+			return nil, errors.New("missing attribute value")
+		}
+		name := strings.ToUpper(s[:end])
+		s = strings.TrimLeft(s[end:], " ")
+
+		var err error
+		switch {
+		case name == "X-GM-LABELS":
+			message.Labels, s, err = parseLabels(s)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case strings.HasPrefix(s, "("):
+			if s, err = skipList(s); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var value string
+		if value, s, err = parseValue(s); err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case "UID":
+			message.UID, err = strconv.Atoi(value)
+		case "X-GM-MSGID":
+			message.MsgID, err = strconv.ParseUint(value, 10, 64)
+		case "X-GM-THRID":
+			message.ThrID, err = strconv.ParseUint(value, 10, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+}
+
+// parseLabels parses the list of an X-GM-LABELS attribute and returns the
+// decoded labels together with the remainder of s. Labels are encoded like
+// folder names, a label that can not be decoded is kept as it is.
+func parseLabels(s string) ([]string, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", errors.New("missing label list")
+	}
+	s = s[1:]
+
+	labels := make([]string, 0)
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return nil, "", errors.New("unterminated label list")
+		}
+		if s[0] == ')' {
+			return labels, s[1:], nil
+		}
+
+		raw, rest, err := parseValue(s)
+		if err != nil {
+			return nil, "", err
+		}
+		s = rest
+
+		label, err := DecodeMailboxName(raw)
+		if err != nil {
+			log.Printf("failed to decode label %s: %v\n", raw, err)
+		}
+		labels = append(labels, label)
+	}
+}
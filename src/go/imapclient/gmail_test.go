@@ -0,0 +1,130 @@
+package imapclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGmailFetch(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		line     string
+		expected *GmailMessage
+		err      bool
+	}{
+		{
+			name: "every attribute",
+			line: `UID 5 X-GM-MSGID 1278455344230334865 X-GM-THRID 1278455344230334866 X-GM-LABELS (\Inbox \Important "Work/Projects"))`,
+			expected: &GmailMessage{
+				UID:    5,
+				MsgID:  1278455344230334865,
+				ThrID:  1278455344230334866,
+				Labels: []string{`\Inbox`, `\Important`, "Work/Projects"},
+			},
+		},
+		{
+			name: "lower case names and other order",
+			line: `x-gm-labels () x-gm-thrid 2 uid 7 x-gm-msgid 1)`,
+			expected: &GmailMessage{
+				UID:    7,
+				MsgID:  1,
+				ThrID:  2,
+				Labels: []string{},
+			},
+		},
+		{
+			name: "encoded and hyphenated labels",
+			line: `UID 3 X-GM-LABELS ("B&APw-cher" to-do "with \"quotes\"" {5}` + "\r\n" + `a b c))`,
+			expected: &GmailMessage{
+				UID:    3,
+				Labels: []string{"Bücher", "to-do", `with "quotes"`, "a b c"},
+			},
+		},
+		{
+			name: "skipped attributes",
+			line: `FLAGS (\Seen (nested) ")") MODSEQ (12) UID 9 X-GM-MSGID 4)`,
+			expected: &GmailMessage{
+				UID:    9,
+				MsgID:  4,
+				Labels: []string{},
+			},
+		},
+		{
+			name: "label that can not be decoded",
+			line: `UID 1 X-GM-LABELS (Broken&))`,
+			expected: &GmailMessage{
+				UID:    1,
+				Labels: []string{"Broken&"},
+			},
+		},
+		{
+			name: "invalid message id",
+			line: `UID 1 X-GM-MSGID abc)`,
+			err:  true,
+		},
+		{
+			name: "unterminated label list",
+			line: `UID 1 X-GM-LABELS (\Inbox`,
+			err:  true,
+		},
+		{
+			name: "missing label list",
+			line: `UID 1 X-GM-LABELS NIL)`,
+			err:  true,
+		},
+		{
+			name: "unterminated attribute list",
+			line: `UID 1`,
+			err:  true,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			message, err := parseGmailFetch(s.line)
+			if s.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(message, s.expected) {
+				t.Fatalf("expected %+v, got %+v", s.expected, message)
+			}
+		})
+	}
+}
+
+func TestFetchGmail(t *testing.T) {
+	c, wait := scriptedServer(t, "IMAP4rev1 X-GM-EXT-1", []exchange{{
+		expect: "A0002 UID FETCH 4,6 (UID X-GM-MSGID X-GM-THRID X-GM-LABELS)",
+		reply: []string{
+			`* 1 FETCH (X-GM-THRID 2 X-GM-MSGID 1 X-GM-LABELS (\Inbox) UID 4)`,
+			"* 3 EXISTS",
+			`* 2 FETCH (UID 6 X-GM-MSGID 3 X-GM-THRID 2 X-GM-LABELS ())`,
+			"A0002 OK done",
+		},
+	}})
+	defer wait()
+
+	if !c.IsGmail() {
+		t.Fatal("expected the server to be detected as Gmail")
+	}
+
+	messages, err := c.FetchGmail(4, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[int]*GmailMessage{
+		4: {UID: 4, MsgID: 1, ThrID: 2, Labels: []string{`\Inbox`}},
+		6: {UID: 6, MsgID: 3, ThrID: 2, Labels: []string{}},
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, messages)
+	}
+}
@@ -0,0 +1,113 @@
+package imapclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoIdle is returned if IDLE is requested from a server that does not
+// announce it.
+var ErrNoIdle = errors.New("server does not support IDLE")
+
+// Idle waits for the server to push changes of the selected folder and calls
+// onUntagged for every untagged response as soon as it arrives. IDLE is ended
+// with DONE once ctx is done or timeout elapsed, and Idle returns after the
+// server completed the command. Cancelling ctx is therefore no error.
+func (c *Client) Idle(ctx context.Context, timeout time.Duration, onUntagged func(line string)) error {
+	if !c.Capabilities.Has("IDLE") {
+		return ErrNoIdle
+	}
+
+	c.nextTag++
+	tag := fmt.Sprintf("A%04d", c.nextTag)
+
+	// the connection stays quiet for the whole timeout, only after DONE the
+	// usual timeout of a command applies
+	deadline := time.Now().Add(timeout)
+	if c.Timeout > 0 {
+		deadline = deadline.Add(c.Timeout)
+	}
+	c.conn.SetDeadline(deadline)
+
+	if _, err := io.WriteString(c.conn, tag+" IDLE\r\n"); err != nil {
+		return err
+	}
+
+	idling := false
+	finished := make(chan struct{})
+	wg := sync.WaitGroup{}
+	defer func() {
+		close(finished)
+		wg.Wait()
+	}()
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case strings.HasPrefix(line, "+"):
+			if idling {
+				continue
+			}
+			idling = true
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				timer := time.NewTimer(timeout)
+				defer timer.Stop()
+
+				select {
+				case <-ctx.Done():
+				case <-timer.C:
+				case <-finished:
+					return
+				}
+
+				io.WriteString(c.conn, "DONE\r\n")
+			}()
+		case strings.HasPrefix(line, "* "):
+			if onUntagged != nil {
+				onUntagged(line)
+			}
+		case strings.HasPrefix(line, tag+" "):
+			status, text, _ := strings.Cut(line[len(tag)+1:], " ")
+			if status = strings.ToUpper(status); status != "OK" {
+				return &StatusError{Status: status, Text: text}
+			}
+			return nil
+		}
+	}
+}
+
+// Noop sends NOOP, which gives the server the chance to report changes of the
+// selected folder. They are passed to onUntagged like the ones of IDLE.
+func (c *Client) Noop(onUntagged func(line string)) error {
+	_, err := c.ExecuteFunc(onUntagged, "NOOP")
+	return err
+}
+
+// IsFolderChange reports whether an untagged response announces a new,
+// expunged or changed email in the selected folder.
+func IsFolderChange(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || fields[0] != "*" {
+		return false
+	}
+
+	switch strings.ToUpper(fields[2]) {
+	case "EXISTS", "EXPUNGE", "FETCH":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,122 @@
+package imapclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mailbox is a folder as reported by LIST.
+type Mailbox struct {
+	Name string
+
+	// Delimiter separates the levels of the folder hierarchy, it is empty if
+	// the server has no hierarchy.
+	Delimiter string
+
+	// Attributes are the name attributes like \Noselect or \Sent.
+	Attributes []string
+}
+
+// HasAttribute reports whether the mailbox has the attribute, ignoring case.
+func (m *Mailbox) HasAttribute(attribute string) bool {
+	for _, a := range m.Attributes {
+		if strings.EqualFold(a, attribute) {
+			return true
+		}
+	}
+	return false
+}
+
+// Selectable reports whether the mailbox can be selected, folders that only
+// exist as parent of other folders can not.
+func (m *Mailbox) Selectable() bool {
+	return !m.HasAttribute(`\Noselect`) && !m.HasAttribute(`\NonExistent`)
+}
+
+// List returns every folder of the account.
+func (c *Client) List() ([]Mailbox, error) {
+	r, err := c.Execute(`LIST "" "*"`)
+	if err != nil {
+		return nil, err
+	}
+
+	mailboxes := make([]Mailbox, 0, len(r.Untagged))
+	for _, line := range r.Untagged {
+		rest, ok := cutPrefixFold(line, "* LIST ")
+		if !ok {
+			continue
+		}
+
+		mailbox, err := parseList(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LIST response %q: %w", line, err)
+		}
+		mailboxes = append(mailboxes, mailbox)
+	}
+
+	return mailboxes, nil
+}
+
+// parseList parses the part of a LIST response after "* LIST ".
+func parseList(s string) (Mailbox, error) {
+	mailbox := Mailbox{}
+
+	if !strings.HasPrefix(s, "(") {
+		return mailbox, fmt.Errorf("missing attribute list")
+	}
+	end := strings.IndexByte(s, ')')
+	if end == -1 {
+		return mailbox, fmt.Errorf("unterminated attribute list")
+	}
+	mailbox.Attributes = strings.Fields(s[1:end])
+	s = strings.TrimLeft(s[end+1:], " ")
+
+	delimiter, s, err := parseString(s)
+	if err != nil {
+		return mailbox, fmt.Errorf("invalid delimiter: %w", err)
+	}
+	mailbox.Delimiter = delimiter
+
+	mailbox.Name, _, err = parseString(strings.TrimLeft(s, " "))
+	if err != nil {
+		return mailbox, fmt.Errorf("invalid name: %w", err)
+	}
+
+	return mailbox, nil
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// Subscribed returns the names of the folders the user subscribed to.
+func (c *Client) Subscribed() (map[string]bool, error) {
+	r, err := c.Execute(`LSUB "" "*"`)
+	if err != nil {
+		return nil, err
+	}
+
+	subscribed := make(map[string]bool, len(r.Untagged))
+	for _, line := range r.Untagged {
+		rest, ok := cutPrefixFold(line, "* LSUB ")
+		if !ok {
+			continue
+		}
+
+		mailbox, err := parseList(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LSUB response %q: %w", line, err)
+		}
+
+		// parents of subscribed folders are reported as \Noselect without
+		// being subscribed themselves
+		if !mailbox.HasAttribute(`\Noselect`) {
+			subscribed[mailbox.Name] = true
+		}
+	}
+
+	return subscribed, nil
+}
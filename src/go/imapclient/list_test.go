@@ -0,0 +1,115 @@
+package imapclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		response string
+		expected Mailbox
+		err      bool
+	}{
+		{
+			name:     "quoted",
+			response: `(\HasNoChildren) "/" "INBOX"`,
+			expected: Mailbox{Name: "INBOX", Delimiter: "/", Attributes: []string{`\HasNoChildren`}},
+		},
+		{
+			name:     "atom name",
+			response: `(\HasChildren \Noselect) "." Archive`,
+			expected: Mailbox{Name: "Archive", Delimiter: ".", Attributes: []string{`\HasChildren`, `\Noselect`}},
+		},
+		{
+			name:     "no attributes",
+			response: `() "/" "Sent Items"`,
+			expected: Mailbox{Name: "Sent Items", Delimiter: "/", Attributes: []string{}},
+		},
+		{
+			name:     "no hierarchy",
+			response: `(\Sent) NIL "Sent"`,
+			expected: Mailbox{Name: "Sent", Attributes: []string{`\Sent`}},
+		},
+		{
+			name:     "escaped characters",
+			response: `() "\\" "Say \"hi\"\\there"`,
+			expected: Mailbox{Name: `Say "hi"\there`, Delimiter: `\`, Attributes: []string{}},
+		},
+		{
+			name:     "literal",
+			response: "() \"/\" {9}\r\nodd\"name)",
+			expected: Mailbox{Name: `odd"name)`, Delimiter: "/", Attributes: []string{}},
+		},
+		{
+			name:     "non-synchronizing literal",
+			response: "() \"/\" {5+}\r\nHello",
+			expected: Mailbox{Name: "Hello", Delimiter: "/", Attributes: []string{}},
+		},
+		{
+			name:     "missing attribute list",
+			response: `"/" "INBOX"`,
+			err:      true,
+		},
+		{
+			name:     "unterminated attribute list",
+			response: `(\HasNoChildren "/" "INBOX"`,
+			err:      true,
+		},
+		{
+			name:     "missing name",
+			response: `() "/"`,
+			err:      true,
+		},
+		{
+			name:     "unterminated name",
+			response: `() "/" "INBOX`,
+			err:      true,
+		},
+		{
+			name:     "short literal",
+			response: "() \"/\" {9}\r\nshort",
+			err:      true,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			mailbox, err := parseList(s.response)
+			if s.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", mailbox)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(mailbox, s.expected) {
+				t.Fatalf("expected %+v, got %+v", s.expected, mailbox)
+			}
+		})
+	}
+}
+
+func TestMailboxSelectable(t *testing.T) {
+	scenarios := []struct {
+		attributes []string
+		expected   bool
+	}{
+		{nil, true},
+		{[]string{`\HasChildren`}, true},
+		{[]string{`\Noselect`}, false},
+		{[]string{`\NOSELECT`}, false},
+		{[]string{`\NonExistent`}, false},
+	}
+
+	for _, s := range scenarios {
+		mailbox := Mailbox{Name: "Folder", Attributes: s.attributes}
+		if selectable := mailbox.Selectable(); selectable != s.expected {
+			t.Errorf("expected %v to be selectable %v, got %v", s.attributes, s.expected, selectable)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package imapclient
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/BrianLeishman/go-imap"
+	"golang.org/x/net/html/charset"
+)
+
+// wordDecoder decodes RFC 2047 encoded words of the envelope, using every
+// charset x/net knows about.
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: func(label string, input io.Reader) (io.Reader, error) {
+		label = strings.ReplaceAll(label, "windows-", "cp")
+		encoding, _ := charset.Lookup(label)
+		if encoding == nil {
+			return input, nil
+		}
+		return encoding.NewDecoder().Reader(input), nil
+	},
+}
+
+// GetOverviews fetches flags, internal date, size and envelope of the
+// messages with the given UIDs, just like imap.Dialer.GetOverviews.
+func (c *Client) GetOverviews(uids ...int) (map[int]*imap.Email, error) {
+	emails := make(map[int]*imap.Email, len(uids))
+	if len(uids) == 0 {
+		return emails, nil
+	}
+
+	records, lines, err := c.fetch("UID FETCH", joinUIDs(uids), "ALL")
+	if err != nil {
+		return nil, err
+	}
+
+	for r, tks := range records {
+		e := &imap.Email{}
+
+		for i := 0; i+1 < len(tks); i += 2 {
+			if err = checkType(tks[i], []imap.TType{imap.TLiteral}, tks, "in root"); err != nil {
+				return nil, err
+			}
+
+			switch tks[i].Str {
+			case "FLAGS":
+				if e.Flags, err = parseFlags(lines[r]); err != nil {
+					return nil, fmt.Errorf("invalid FETCH response %q: %w", lines[r], err)
+				}
+			case "INTERNALDATE":
+				if err = checkType(tks[i+1], []imap.TType{imap.TQuoted}, tks, "after INTERNALDATE"); err != nil {
+					return nil, err
+				}
+				e.Received, err = time.Parse(imap.TimeFormat, tks[i+1].Str)
+				if err != nil {
+					return nil, err
+				}
+				e.Received = e.Received.UTC()
+			case "RFC822.SIZE":
+				if err = checkType(tks[i+1], []imap.TType{imap.TNumber}, tks, "after RFC822.SIZE"); err != nil {
+					return nil, err
+				}
+				e.Size = uint64(tks[i+1].Num)
+			case "ENVELOPE":
+				if err = parseEnvelope(e, tks[i+1], tks); err != nil {
+					return nil, err
+				}
+			case "UID":
+				if err = checkType(tks[i+1], []imap.TType{imap.TNumber}, tks, "after UID"); err != nil {
+					return nil, err
+				}
+				e.UID = tks[i+1].Num
+			}
+		}
+
+		emails[e.UID] = e
+	}
+
+	return emails, nil
+}
+
+// parseEnvelope sets date, subject, addresses and message id of the email
+// from an ENVELOPE container.
+func parseEnvelope(e *imap.Email, envelope *imap.Token, tks []*imap.Token) error {
+	if err := checkType(envelope, []imap.TType{imap.TContainer}, tks, "after ENVELOPE"); err != nil {
+		return err
+	}
+	if len(envelope.Tokens) <= int(imap.EMessageID) {
+		return fmt.Errorf("incomplete ENVELOPE in %v", tks)
+	}
+
+	fields := envelope.Tokens
+	if err := checkType(fields[imap.EDate], []imap.TType{imap.TQuoted, imap.TNil}, tks, "for ENVELOPE[%d]", imap.EDate); err != nil {
+		return err
+	}
+	if err := checkType(fields[imap.ESubject], []imap.TType{imap.TQuoted, imap.TAtom, imap.TNil}, tks, "for ENVELOPE[%d]", imap.ESubject); err != nil {
+		return err
+	}
+
+	e.Sent, _ = time.Parse("Mon, _2 Jan 2006 15:04:05 -0700", fields[imap.EDate].Str)
+	e.Sent = e.Sent.UTC()
+
+	var err error
+	e.Subject, err = wordDecoder.DecodeHeader(fields[imap.ESubject].Str)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range []struct {
+		dest  *imap.EmailAddresses
+		pos   uint8
+		debug string
+	}{
+		{&e.From, imap.EFrom, "FROM"},
+		{&e.ReplyTo, imap.EReplyTo, "REPLYTO"},
+		{&e.To, imap.ETo, "TO"},
+		{&e.CC, imap.ECC, "CC"},
+		{&e.BCC, imap.EBCC, "BCC"},
+	} {
+		if err := checkType(fields[a.pos], []imap.TType{imap.TNil, imap.TContainer}, tks, "for ENVELOPE[%d]", a.pos); err != nil {
+			return err
+		}
+
+		*a.dest = make(imap.EmailAddresses, len(fields[a.pos].Tokens))
+		for j, t := range fields[a.pos].Tokens {
+			if len(t.Tokens) <= int(imap.EEHost) {
+				return fmt.Errorf("incomplete address for %s[%d] in %v", a.debug, j, tks)
+			}
+
+			parts := make([]string, 0, 3)
+			for _, pos := range []uint8{imap.EEName, imap.EEMailbox, imap.EEHost} {
+				if err := checkType(t.Tokens[pos], []imap.TType{imap.TQuoted, imap.TNil}, tks, "for %s[%d][%d]", a.debug, j, pos); err != nil {
+					return err
+				}
+
+				part, err := wordDecoder.DecodeHeader(t.Tokens[pos].Str)
+				if err != nil {
+					return err
+				}
+				parts = append(parts, part)
+			}
+
+			(*a.dest)[strings.ToLower(parts[1]+"@"+parts[2])] = parts[0]
+		}
+	}
+
+	e.MessageID = fields[imap.EMessageID].Str
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package imapclient
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fetchAttributes calls fn with the name and the value of every attribute of
+// a FETCH response line. The value of a list is passed without its
+// parentheses, the value of a string is passed unquoted.
+func fetchAttributes(line string, fn func(name string, value string) error) error {
+	start := strings.IndexByte(line, '(')
+	if start == -1 {
+		return errors.New("missing attribute list")
+	}
+	s := line[start+1:]
+
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return errors.New("unterminated attribute list")
+		}
+		if s[0] == ')' {
+			return nil
+		}
+
+		end := strings.IndexByte(s, ' ')
+		if end == -1 {
+			return errors.New("missing attribute value")
+		}
+		name := strings.ToUpper(s[:end])
+		s = strings.TrimLeft(s[end:], " ")
+
+		var value string
+		var err error
+		if strings.HasPrefix(s, "(") {
+			var rest string
+			if rest, err = skipList(s); err != nil {
+				return err
+			}
+			value, s = s[1:len(s)-len(rest)-1], rest
+		} else if value, s, err = parseValue(s); err != nil {
+			return err
+		}
+
+		if err := fn(name, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+}
+
+// parseValue parses a quoted string, a literal or an atom that may be
+// followed by the end of a list.
+func parseValue(s string) (string, string, error) {
+	if s != "" && (s[0] == '"' || s[0] == '{') {
+		return parseString(s)
+	}
+
+	end := strings.IndexAny(s, " )")
+	if end == -1 {
+		end = len(s)
+	}
+	if end == 0 {
+		return "", "", errors.New("missing value")
+	}
+
+	return s[:end], s[end:], nil
+}
+
+// skipList returns the remainder of s after the parenthesized list it starts
+// with, including nested lists, strings and literals.
+func skipList(s string) (string, error) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '{':
+			_, rest, err := parseString(s[i:])
+			if err != nil {
+				return "", err
+			}
+			i = len(s) - len(rest) - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s[i+1:], nil
+			}
+		}
+	}
+
+	return "", errors.New("unterminated list")
+}
+
+// parseString parses a quoted string, a literal, NIL or an atom from the start
+// of s and returns its value together with the remainder of s.
+func parseString(s string) (string, string, error) {
+	switch {
+	case s == "":
+		return "", "", fmt.Errorf("unexpected end of response")
+
+	case s[0] == '"':
+		value := strings.Builder{}
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+				if i < len(s) {
+					value.WriteByte(s[i])
+				}
+			case '"':
+				return value.String(), s[i+1:], nil
+			default:
+				value.WriteByte(s[i])
+			}
+		}
+		return "", "", fmt.Errorf("unterminated quoted string")
+
+	case s[0] == '{':
+		// literals are inlined into the line as "{n}\r\n<content>"
+		end := strings.Index(s, "}\r\n")
+		if end == -1 {
+			return "", "", fmt.Errorf("invalid literal")
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(s[1:end], "+"))
+		if err != nil || end+3+n > len(s) {
+			return "", "", fmt.Errorf("invalid literal")
+		}
+		return s[end+3 : end+3+n], s[end+3+n:], nil
+
+	default:
+		end := strings.IndexByte(s, ' ')
+		if end == -1 {
+			end = len(s)
+		}
+		if strings.EqualFold(s[:end], "NIL") {
+			return "", s[end:], nil
+		}
+		return s[:end], s[end:], nil
+	}
+}
@@ -0,0 +1,175 @@
+package imapclient
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ErrNoStartTLS is returned if STARTTLS is requested from a server that does
+// not announce it.
+var ErrNoStartTLS = errors.New("server does not support STARTTLS")
+
+// CertificateError is returned if the certificate of the server could not be
+// verified. It is kept apart from other connection errors, because it usually
+// means that the account needs a CA bundle instead of being a network problem.
+type CertificateError struct {
+	Host string
+	Err  error
+}
+
+func (e *CertificateError) Error() string {
+	return fmt.Sprintf("certificate of %s could not be verified: %s", e.Host, e.Reason())
+}
+
+func (e *CertificateError) Unwrap() error {
+	return e.Err
+}
+
+// Reason describes in plain words why the certificate was rejected.
+func (e *CertificateError) Reason() string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+
+	switch {
+	case errors.As(e.Err, &unknownAuthority):
+		if cert := unknownAuthority.Cert; cert != nil && cert.Subject.String() == cert.Issuer.String() {
+			return fmt.Sprintf("the certificate %q is self-signed, add it as CA bundle of the account", cert.Subject)
+		}
+		return "the certificate is signed by an unknown authority, add the CA certificate as CA bundle of the account"
+	case errors.As(e.Err, &hostname):
+		return fmt.Sprintf("the certificate is not valid for %q (%s)", hostname.Host, hostname.Error())
+	case errors.As(e.Err, &invalid):
+		switch invalid.Reason {
+		case x509.Expired:
+			return "the certificate has expired or is not yet valid, check the clock of this machine if it should be valid"
+		default:
+			return invalid.Error()
+		}
+	default:
+		return e.Err.Error()
+	}
+}
+
+// IsCertificateError reports whether err was caused by a certificate of the
+// server that could not be verified.
+func IsCertificateError(err error) bool {
+	var certErr *CertificateError
+	return errors.As(err, &certErr)
+}
+
+// certificateError wraps err in a CertificateError if it is a failed
+// certificate verification.
+func certificateError(host string, err error) error {
+	var verification *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+
+	if errors.As(err, &verification) || errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return &CertificateError{Host: host, Err: err}
+	}
+
+	return err
+}
+
+// withServerName returns a copy of tlsConfig that verifies the certificate
+// against host, unless a server name is already set.
+func withServerName(tlsConfig *tls.Config, host string) *tls.Config {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+	return tlsConfig
+}
+
+// DialPlain connects to the server without TLS. Everything including the
+// password is sent in clear text, so this is only meant for servers on a
+// trusted network.
+func DialPlain(host string, port int) (*Client, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	conn, err := dialer.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// DialStartTLS connects to the server without TLS and upgrades the connection
+// with STARTTLS before anything else is sent.
+func DialStartTLS(host string, port int, tlsConfig *tls.Config) (*Client, error) {
+	c, err := DialPlain(host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.StartTLS(withServerName(tlsConfig, host)); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// StartTLS upgrades the connection to TLS and asks for the capabilities
+// again, because the ones sent before the upgrade can not be trusted.
+func (c *Client) StartTLS(tlsConfig *tls.Config) error {
+	if !c.Capabilities.Has("STARTTLS") {
+		return ErrNoStartTLS
+	}
+
+	if _, err := c.Execute("STARTTLS"); err != nil {
+		return err
+	}
+
+	// the server must not send anything after the tagged response, otherwise
+	// it could inject responses that would be read as if they were encrypted
+	if c.r.Buffered() > 0 {
+		return errors.New("server sent data before the TLS handshake")
+	}
+
+	conn := tls.Client(c.conn, tlsConfig)
+	c.setDeadline()
+	if err := conn.Handshake(); err != nil {
+		return certificateError(tlsConfig.ServerName, err)
+	}
+
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+
+	return c.Capability()
+}
+
+// IsTLS reports whether the connection is encrypted.
+func (c *Client) IsTLS() bool {
+	_, ok := c.conn.(*tls.Conn)
+	return ok
+}
+
+// loginAllowed returns an error if credentials would be sent in clear text
+// to a server that announced it does not accept them that way.
+func (c *Client) loginAllowed() error {
+	if c.Capabilities.Has("LOGINDISABLED") {
+		if c.IsTLS() {
+			return errors.New("server does not allow LOGIN on this connection")
+		}
+		return errors.New("server does not allow LOGIN without TLS, use TLS or STARTTLS")
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package imapclient
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// DecodeMailboxName decodes a folder name from the modified UTF-7 of RFC 3501
+// section 5.1.3, which servers use for every folder name that is not plain
+// ASCII. Invalid names are returned as they are, together with the error.
+func DecodeMailboxName(name string) (string, error) {
+	decoded := strings.Builder{}
+
+	for i := 0; i < len(name); {
+		if name[i] != '&' {
+			decoded.WriteByte(name[i])
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(name[i+1:], '-')
+		if end == -1 {
+			return name, errors.New("unterminated base64 section")
+		}
+		encoded := name[i+1 : i+1+end]
+		i += end + 2
+
+		// "&-" is the escaped ampersand
+		if encoded == "" {
+			decoded.WriteByte('&')
+			continue
+		}
+
+		data, err := base64.RawStdEncoding.DecodeString(strings.ReplaceAll(encoded, ",", "/"))
+		if err != nil || len(data)%2 != 0 {
+			return name, fmt.Errorf("invalid base64 section %q", encoded)
+		}
+
+		units := make([]uint16, len(data)/2)
+		for j := range units {
+			units[j] = uint16(data[2*j])<<8 | uint16(data[2*j+1])
+		}
+		decoded.WriteString(string(utf16.Decode(units)))
+	}
+
+	return decoded.String(), nil
+}
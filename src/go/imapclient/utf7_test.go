@@ -0,0 +1,39 @@
+package imapclient
+
+import "testing"
+
+func TestDecodeMailboxName(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		expected string
+		err      bool
+	}{
+		{"INBOX", "INBOX", false},
+		{"", "", false},
+		{"B&APw-cher", "Bücher", false},
+		{"&AMQA1gDc-", "ÄÖÜ", false},
+		{"Tom &- Jerry", "Tom & Jerry", false},
+		{"&ZeVnLIqe-", "日本語", false},
+		{"&2D3eAA-", "😀", false},
+		{"&AC8-", "/", false},
+		{"Entw&APw-rfe/&AMQ-nderungen", "Entwürfe/Änderungen", false},
+		{"a&A,8-", "aϿ", false},
+		{"Broken&", "Broken&", true},
+		{"Broken&APw", "Broken&APw", true},
+		{"&A-", "&A-", true},
+		{"&!!!-", "&!!!-", true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			decoded, err := DecodeMailboxName(s.name)
+			if s.err != (err != nil) {
+				t.Fatalf("expected an error %v, got %v", s.err, err)
+			}
+
+			if decoded != s.expected {
+				t.Fatalf("expected %q, got %q", s.expected, decoded)
+			}
+		})
+	}
+}
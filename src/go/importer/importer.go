@@ -0,0 +1,96 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/backup"
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+)
+
+// Result counts what an import did.
+type Result struct {
+	Imported int
+	Skipped  int
+	Failures int
+}
+
+// Importer stores messages from local archives under a single account.
+type Importer struct {
+	archiver *backup.Archiver
+	account  *core.Record
+
+	Result Result
+}
+
+// New returns an importer that stores every message under the account.
+func New(app core.App, account *core.Record) (*Importer, error) {
+	archiver, err := backup.NewArchiver(app)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Importer{
+		archiver: archiver,
+		account:  account,
+	}, nil
+}
+
+// Import stores a single message in the folder, unless the account already
+// holds the same message. The folder gets a record if it has none yet. A zero received date falls back to the sent date.
+// Only errors of the database are returned, a message that can not be stored
+// is counted as failure.
+func (i *Importer) Import(folder string, raw []byte, received time.Time, flags []string) error {
+	email := imapclient.ParseEmail(toCRLF(raw), received, flags)
+	if email.Received.IsZero() {
+		email.Received = email.Sent
+	}
+
+	duplicates, err := i.archiver.FindDuplicates(i.account, email)
+	if err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		i.Result.Skipped++
+		return nil
+	}
+
+	if err := i.archiver.Save(i.account, folder, email); err != nil {
+		log.Printf("failed to import email %s: %v\n", email.MessageID, err)
+		i.Result.Failures++
+		return nil
+	}
+
+	i.Result.Imported++
+	return nil
+}
+
+// toCRLF converts the line endings of a message to CRLF, which is how an IMAP
+// server stores it. The size of the message then matches the synced one.
+func toCRLF(raw []byte) []byte {
+	lines := bytes.Count(raw, []byte("\n"))
+	if lines == bytes.Count(raw, []byte("\r\n")) {
+		return raw
+	}
+
+	converted := make([]byte, 0, len(raw)+lines)
+	for len(raw) > 0 {
+		line, rest, found := bytes.Cut(raw, []byte("\n"))
+		converted = append(converted, bytes.TrimSuffix(line, []byte("\r"))...)
+		if found {
+			converted = append(converted, '\r', '\n')
+		}
+		raw = rest
+	}
+
+	return converted
+}
+
+// pathError wraps an error with the file or directory it occurred in.
+func pathError(path string, err error) error {
+	return fmt.Errorf("failed to import %s: %w", path, err)
+}
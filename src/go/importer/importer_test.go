@@ -0,0 +1,79 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tests"
+
+	_ "github.com/yerTools/imapbackup/src/go/database/migrations"
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestToCRLF(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		raw      string
+		expected string
+	}{
+		{"LF", "a\nb\n", "a\r\nb\r\n"},
+		{"CRLF", "a\r\nb\r\n", "a\r\nb\r\n"},
+		{"mixed", "a\r\nb\nc", "a\r\nb\r\nc"},
+		{"no line break", "a", "a"},
+		{"empty", "", ""},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if result := string(toCRLF([]byte(s.raw))); result != s.expected {
+				t.Fatalf("expected %q, got %q", s.expected, result)
+			}
+		})
+	}
+}
+
+func TestImportDuplicates(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	i, err := New(app, testutil.CreateAccount(t, app, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := "Message-ID: <one@example.org>\nDate: Wed, 1 May 2024 12:30:00 +0200\nSubject: one\n\nbody\n"
+	changed := "Message-ID: <one@example.org>\nDate: Wed, 1 May 2024 12:30:00 +0200\nSubject: one\n\nchanged body\n"
+	received := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	scenarios := []struct {
+		name     string
+		raw      string
+		received time.Time
+		expected Result
+	}{
+		{"new message", message, received, Result{Imported: 1}},
+		{"same message", message, received, Result{Imported: 1, Skipped: 1}},
+		{"same message received later", message, received.Add(time.Hour), Result{Imported: 1, Skipped: 2}},
+		{"same message with CRLF", toCRLFString(message), time.Time{}, Result{Imported: 1, Skipped: 3}},
+		{"same Message-ID with other content", changed, received, Result{Imported: 2, Skipped: 3}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if err := i.Import("INBOX", []byte(s.raw), s.received, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if i.Result != s.expected {
+				t.Fatalf("expected %+v, got %+v", s.expected, i.Result)
+			}
+		})
+	}
+}
+
+func toCRLFString(s string) string {
+	return string(toCRLF([]byte(s)))
+}
@@ -0,0 +1,182 @@
+package importer
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Init registers the import commands.
+func Init(app *pocketbase.PocketBase) {
+	command := &cobra.Command{
+		Use:   "import",
+		Short: "Imports emails from local mbox files and Maildir trees",
+	}
+
+	command.AddCommand(newMboxCommand(app))
+	command.AddCommand(newMaildirCommand(app))
+
+	app.RootCmd.AddCommand(command)
+}
+
+// accountFlags select the account the emails are imported into, either an
+// existing one by id or an offline account by name.
+type accountFlags struct {
+	account string
+	offline string
+	owner   string
+}
+
+func (f *accountFlags) register(flags *pflag.FlagSet) {
+	flags.StringVar(&f.account, "account", "", "id of the account the emails are imported into")
+	flags.StringVar(&f.offline, "offline", "", "name of the offline account the emails are imported into, it is created if needed")
+	flags.StringVar(&f.owner, "owner", "", "email or id of the user owning the offline account")
+}
+
+// find returns the selected account, creating the offline account if it does
+// not exist yet.
+func (f *accountFlags) find(app core.App) (*core.Record, error) {
+	switch {
+	case f.account != "" && f.offline != "":
+		return nil, errors.New("--account and --offline can not be combined")
+	case f.account != "":
+		account, err := app.FindRecordById("ib_smtp_accounts", f.account)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find account %q: %w", f.account, err)
+		}
+		return account, nil
+	case f.offline == "":
+		return nil, errors.New("either --account or --offline is required")
+	case f.owner == "":
+		return nil, errors.New("--owner is required for offline accounts")
+	}
+
+	owner, err := app.FindAuthRecordByEmail("users", f.owner)
+	if err != nil {
+		owner, err = app.FindRecordById("users", f.owner)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user %q: %w", f.owner, err)
+	}
+
+	account, err := app.FindFirstRecordByFilter(
+		"ib_smtp_accounts",
+		"created_by = {:owner} && username = {:username} && offline = true",
+		dbx.Params{
+			"owner":    owner.Id,
+			"username": f.offline,
+		},
+	)
+	if err == nil {
+		return account, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	collection, err := app.FindCollectionByNameOrId("ib_smtp_accounts")
+	if err != nil {
+		return nil, err
+	}
+
+	account = core.NewRecord(collection)
+	account.Set("created_by", owner.Id)
+	account.Set("username", f.offline)
+	account.Set("offline", true)
+
+	if err := app.Save(account); err != nil {
+		return nil, fmt.Errorf("failed to create offline account: %w", err)
+	}
+
+	log.Printf("created offline account %s\n", f.offline)
+
+	return account, nil
+}
+
+func newMboxCommand(app core.App) *cobra.Command {
+	var folder string
+	accountFlags := &accountFlags{}
+
+	command := &cobra.Command{
+		Use:   "mbox <file>...",
+		Short: "Imports mbox files, each one into a folder named like the file",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(command *cobra.Command, args []string) error {
+			account, err := accountFlags.find(app)
+			if err != nil {
+				return err
+			}
+
+			importer, err := New(app, account)
+			if err != nil {
+				return err
+			}
+
+			for _, path := range args {
+				name := folder
+				if name == "" {
+					name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+				}
+
+				log.Printf("importing %s into folder %s ...\n", path, name)
+
+				if err := importer.Mbox(path, name); err != nil {
+					logResult(importer.Result)
+					return err
+				}
+			}
+
+			logResult(importer.Result)
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&folder, "folder", "", "folder the emails are imported into instead of the file name")
+	accountFlags.register(command.Flags())
+
+	return command
+}
+
+func newMaildirCommand(app core.App) *cobra.Command {
+	var delimiter string
+	accountFlags := &accountFlags{}
+
+	command := &cobra.Command{
+		Use:   "maildir <directory>",
+		Short: "Imports a Maildir or Maildir++ tree",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(command *cobra.Command, args []string) error {
+			account, err := accountFlags.find(app)
+			if err != nil {
+				return err
+			}
+
+			importer, err := New(app, account)
+			if err != nil {
+				return err
+			}
+
+			err = importer.Maildir(args[0], delimiter)
+			logResult(importer.Result)
+			return err
+		},
+	}
+
+	command.Flags().StringVar(&delimiter, "delimiter", "/", "hierarchy delimiter used for the folder names")
+	accountFlags.register(command.Flags())
+
+	return command
+}
+
+func logResult(result Result) {
+	log.Printf("imported %d, skipped %d and failed %d email(s)\n", result.Imported, result.Skipped, result.Failures)
+}
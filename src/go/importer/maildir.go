@@ -0,0 +1,132 @@
+package importer
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maildirFlags maps the letters of the Maildir info suffix to IMAP flags.
+var maildirFlags = map[rune]string{
+	'D': `\Draft`,
+	'F': `\Flagged`,
+	'P': `$Forwarded`,
+	'R': `\Answered`,
+	'S': `\Seen`,
+	'T': `\Deleted`,
+}
+
+// Maildir imports a Maildir or a Maildir++ tree. The root becomes INBOX, every
+// ".Parent.Child" sub folder the folder "Parent<delimiter>Child". The
+// modification time of a message file is used as received date.
+func (i *Importer) Maildir(root string, delimiter string) error {
+	if delimiter == "" {
+		delimiter = "/"
+	}
+
+	folders := map[string]string{}
+
+	if isMaildir(root) {
+		folders["INBOX"] = root
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return pathError(root, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		dir := filepath.Join(root, name)
+		if !entry.IsDir() || len(name) < 2 || name[0] != '.' || name == ".." || !isMaildir(dir) {
+			continue
+		}
+
+		folders[strings.ReplaceAll(name[1:], ".", delimiter)] = dir
+	}
+
+	names := make([]string, 0, len(folders))
+	for name := range folders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		log.Printf("importing folder %s ...\n", name)
+
+		// the folder is stored with its place in the hierarchy, even if it is empty
+		if _, err := i.archiver.Folder(i.account, name, delimiter); err != nil {
+			return err
+		}
+
+		if err := i.maildirFolder(folders[name], name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isMaildir reports whether dir holds a single Maildir folder.
+func isMaildir(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "cur"))
+	return err == nil && info.IsDir()
+}
+
+func (i *Importer) maildirFolder(dir string, folder string) error {
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return pathError(dir, err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+
+			path := filepath.Join(dir, sub, entry.Name())
+
+			info, err := entry.Info()
+			if err != nil {
+				log.Printf("failed to read %s: %v\n", path, err)
+				i.Result.Failures++
+				continue
+			}
+
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				log.Printf("failed to read %s: %v\n", path, err)
+				i.Result.Failures++
+				continue
+			}
+
+			if err := i.Import(folder, raw, info.ModTime(), parseMaildirInfo(entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseMaildirInfo returns the IMAP flags of the ":2," info suffix of a file name.
+func parseMaildirInfo(name string) []string {
+	_, info, found := strings.Cut(name, ":2,")
+	if !found {
+		return nil
+	}
+
+	flags := make([]string, 0, len(info))
+	for _, letter := range info {
+		if flag, ok := maildirFlags[letter]; ok {
+			flags = append(flags, flag)
+		}
+	}
+
+	return flags
+}
@@ -0,0 +1,132 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestParseMaildirInfo(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		expected []string
+	}{
+		{"1714566600.M1P2.host", nil},
+		{"1714566600.M1P2.host:2,", []string{}},
+		{"1714566600.M1P2.host:2,S", []string{`\Seen`}},
+		{"1714566600.M1P2.host:2,DFPRST", []string{`\Draft`, `\Flagged`, `$Forwarded`, `\Answered`, `\Seen`, `\Deleted`}},
+		{"1714566600.M1P2.host:2,Sa", []string{`\Seen`}},
+		{"1714566600.M1P2.host:1,S", nil},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if result := parseMaildirInfo(s.name); !slices.Equal(result, s.expected) || (result == nil) != (s.expected == nil) {
+				t.Fatalf("expected %v, got %v", s.expected, result)
+			}
+		})
+	}
+}
+
+func TestMaildirFolders(t *testing.T) {
+	root := t.TempDir()
+	for dir, messages := range map[string][]string{
+		"":              {"Message-ID: <inbox@example.org>\nSubject: inbox\n\nbody\n"},
+		".Archive.2024": {"Message-ID: <archived@example.org>\nSubject: archived\n\nbody\n"},
+		".Empty":        {},
+	} {
+		for _, sub := range []string{"cur", "new", "tmp"} {
+			if err := os.MkdirAll(filepath.Join(root, dir, sub), 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for n, message := range messages {
+			path := filepath.Join(root, dir, "cur", fmt.Sprintf("1714566600.M%d.host:2,S", n))
+			if err := os.WriteFile(path, []byte(message), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	account := testutil.CreateAccount(t, app, nil)
+
+	i, err := New(app, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Maildir(root, "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	folderRecords, err := app.FindAllRecords("ib_folders", dbx.HashExp{"smtp_account": account.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders := make(map[string]*core.Record, len(folderRecords))
+	for _, folderRecord := range folderRecords {
+		folders[folderRecord.GetString("name")] = folderRecord
+	}
+
+	scenarios := []struct {
+		name        string
+		displayName string
+		parent      string
+	}{
+		{"INBOX", "INBOX", ""},
+		{"Archive", "Archive", ""},
+		{"Archive/2024", "2024", "Archive"},
+		{"Empty", "Empty", ""},
+	}
+
+	if len(folders) != len(scenarios) {
+		t.Fatalf("expected %d folders, got %d", len(scenarios), len(folders))
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			folderRecord, ok := folders[s.name]
+			if !ok {
+				t.Fatal("expected the folder to be stored")
+			}
+
+			if displayName := folderRecord.GetString("display_name"); displayName != s.displayName {
+				t.Fatalf("expected display name %q, got %q", s.displayName, displayName)
+			}
+
+			parent := ""
+			if s.parent != "" {
+				parent = folders[s.parent].Id
+			}
+			if folderRecord.GetString("parent") != parent {
+				t.Fatalf("expected parent %q, got %q", parent, folderRecord.GetString("parent"))
+			}
+		})
+	}
+
+	emails, err := app.FindAllRecords("ib_emails", dbx.HashExp{"smtp_account": account.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 2 {
+		t.Fatalf("expected 2 emails, got %d", len(emails))
+	}
+	for _, email := range emails {
+		if email.GetString("mailbox") != folders[email.GetString("folder")].Id {
+			t.Fatalf("expected email in %s to reference its folder", email.GetString("folder"))
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/mail"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// mboxDateFormat is time.ANSIC with the padding of the day collapsed.
+const mboxDateFormat = "Mon Jan 2 15:04:05 2006"
+
+var regexQuotedFromLine = regexp.MustCompile(`^>+From `)
+
+// Mbox imports every message of an mbox file into the folder. Lines quoted
+// the mboxrd way are unquoted, the date of the "From " separator line is used
+// as received date.
+func (i *Importer) Mbox(path string, folder string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return pathError(path, err)
+	}
+	defer file.Close()
+
+	err = readMbox(file, func(raw []byte, received time.Time) error {
+		return i.Import(folder, raw, received, mboxFlags(raw))
+	})
+	if err != nil {
+		return pathError(path, err)
+	}
+
+	return nil
+}
+
+// readMbox calls fn with every unquoted message of the mbox and the date of
+// its separator line.
+func readMbox(mbox io.Reader, fn func(raw []byte, received time.Time) error) error {
+	r := bufio.NewReader(mbox)
+
+	var message *bytes.Buffer
+	var received time.Time
+	previousEmpty := true
+
+	flush := func() error {
+		if message == nil {
+			return nil
+		}
+
+		// the empty line in front of the next separator line is not part of the message
+		raw := message.Bytes()
+		if bytes.HasSuffix(raw, []byte("\n\n")) {
+			raw = raw[:len(raw)-1]
+		}
+
+		return fn(raw, received)
+	}
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			switch {
+			case previousEmpty && bytes.HasPrefix(line, []byte("From ")):
+				if err := flush(); err != nil {
+					return err
+				}
+				message = &bytes.Buffer{}
+				received = parseFromLine(string(line))
+			case message != nil:
+				if regexQuotedFromLine.Match(line) {
+					line = line[1:]
+				}
+				message.Write(line)
+			}
+
+			previousEmpty = len(bytes.TrimRight(line, "\r\n")) == 0
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return flush()
+}
+
+// parseFromLine returns the date of a "From sender date" separator line, or
+// the zero time if it has none.
+func parseFromLine(line string) time.Time {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return time.Time{}
+	}
+
+	date, err := time.Parse(mboxDateFormat, strings.Join(fields[2:], " "))
+	if err != nil {
+		return time.Time{}
+	}
+
+	return date
+}
+
+// mboxFlags returns the IMAP flags stored in the Status and X-Status headers
+// that mail clients add to messages in mbox files.
+func mboxFlags(raw []byte) []string {
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+
+	flags := make([]string, 0)
+	for _, h := range []struct {
+		header string
+		flags  map[rune]string
+	}{
+		{"Status", map[rune]string{'R': `\Seen`}},
+		{"X-Status", map[rune]string{'A': `\Answered`, 'F': `\Flagged`, 'T': `\Draft`, 'D': `\Deleted`}},
+	} {
+		for _, letter := range message.Header.Get(h.header) {
+			if flag, ok := h.flags[letter]; ok {
+				flags = append(flags, flag)
+			}
+		}
+	}
+
+	return flags
+}
@@ -0,0 +1,118 @@
+package importer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadMbox(t *testing.T) {
+	date := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	scenarios := []struct {
+		name     string
+		mbox     string
+		messages []string
+	}{
+		{
+			"single message",
+			"From a@example.org Wed May  1 12:30:00 2024\nSubject: one\n\nbody\n",
+			[]string{"Subject: one\n\nbody\n"},
+		},
+		{
+			"separated messages",
+			"From a@example.org Wed May  1 12:30:00 2024\nSubject: one\n\nfirst\n\n" +
+				"From b@example.org Wed May  1 12:30:00 2024\nSubject: two\n\nsecond\n",
+			[]string{"Subject: one\n\nfirst\n", "Subject: two\n\nsecond\n"},
+		},
+		{
+			"quoted from lines",
+			"From a@example.org Wed May  1 12:30:00 2024\nSubject: one\n\n>From here\n>>From there\n",
+			[]string{"Subject: one\n\nFrom here\n>From there\n"},
+		},
+		{
+			"other quoted lines",
+			"From a@example.org Wed May  1 12:30:00 2024\nSubject: one\n\n> quoted\n>From: header\n",
+			[]string{"Subject: one\n\n> quoted\n>From: header\n"},
+		},
+		{
+			"from inside a paragraph",
+			"From a@example.org Wed May  1 12:30:00 2024\nSubject: one\n\ntext\nFrom the start\n",
+			[]string{"Subject: one\n\ntext\nFrom the start\n"},
+		},
+		{
+			"text before the first separator",
+			"garbage\n\nFrom a@example.org Wed May  1 12:30:00 2024\nSubject: one\n\nbody\n",
+			[]string{"Subject: one\n\nbody\n"},
+		},
+		{
+			"empty",
+			"",
+			[]string{},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			messages := []string{}
+
+			err := readMbox(strings.NewReader(s.mbox), func(raw []byte, received time.Time) error {
+				if !received.Equal(date) {
+					t.Errorf("expected received date %v, got %v", date, received)
+				}
+				messages = append(messages, string(raw))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(messages, s.messages) {
+				t.Fatalf("expected %q, got %q", s.messages, messages)
+			}
+		})
+	}
+}
+
+func TestParseFromLine(t *testing.T) {
+	scenarios := []struct {
+		line     string
+		expected time.Time
+	}{
+		{"From a@example.org Wed May  1 12:30:00 2024\n", time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)},
+		{"From MAILER-DAEMON Thu Dec 12 08:05:09 2024", time.Date(2024, 12, 12, 8, 5, 9, 0, time.UTC)},
+		{"From a@example.org", time.Time{}},
+		{"From a@example.org yesterday", time.Time{}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.line, func(t *testing.T) {
+			if result := parseFromLine(s.line); !result.Equal(s.expected) {
+				t.Fatalf("expected %v, got %v", s.expected, result)
+			}
+		})
+	}
+}
+
+func TestMboxFlags(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		raw      string
+		expected []string
+	}{
+		{"no status", "Subject: hi\n\nbody\n", []string{}},
+		{"read", "Status: RO\n\nbody\n", []string{`\Seen`}},
+		{"unread", "Status: O\n\nbody\n", []string{}},
+		{"x-status", "Status: R\nX-Status: AFTD\n\nbody\n", []string{`\Seen`, `\Answered`, `\Flagged`, `\Draft`, `\Deleted`}},
+		{"invalid header", "no header\n", nil},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if result := mboxFlags([]byte(s.raw)); !slices.Equal(result, s.expected) || (result == nil) != (s.expected == nil) {
+				t.Fatalf("expected %v, got %v", s.expected, result)
+			}
+		})
+	}
+}
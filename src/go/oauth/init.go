@@ -0,0 +1,127 @@
+package oauth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// authorizationTimeout is the time a user has to complete an authorization.
+	authorizationTimeout = 15 * time.Minute
+
+	storeKeyPrefix = "ib_oauth2_"
+)
+
+// pendingAuthorization is an authorization that was started, but whose
+// callback did not arrive yet.
+type pendingAuthorization struct {
+	account  string
+	verifier string
+	expires  time.Time
+}
+
+// Init registers the API endpoints of the OAuth2 authorization code flow.
+func Init(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.GET("/api/ib/accounts/{id}/oauth2/authorize", handleAuthorize).Bind(apis.RequireAuth())
+		se.Router.GET(callbackPath, handleCallback)
+
+		return se.Next()
+	})
+}
+
+type authorizeResponse struct {
+	URL         string `json:"url"`
+	RedirectURL string `json:"redirect_url"`
+}
+
+// handleAuthorize starts connecting an account and returns the URL of the
+// provider the user has to open.
+func handleAuthorize(e *core.RequestEvent) error {
+	account, err := e.App.FindRecordById("ib_smtp_accounts", e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("Account not found.", nil)
+	}
+
+	if !e.HasSuperuserAuth() && account.GetString("created_by") != e.Auth.Id {
+		return e.NotFoundError("Account not found.", nil)
+	}
+
+	if !IsOAuth2(account) {
+		return e.BadRequestError("The account does not use OAuth2.", nil)
+	}
+
+	config, err := Config(e.App, account)
+	if err != nil {
+		return e.BadRequestError(err.Error(), nil)
+	}
+
+	state := security.RandomString(32)
+	verifier := oauth2.GenerateVerifier()
+
+	e.App.Store().Set(storeKeyPrefix+state, &pendingAuthorization{
+		account:  account.Id,
+		verifier: verifier,
+		expires:  time.Now().Add(authorizationTimeout),
+	})
+
+	return e.JSON(http.StatusOK, authorizeResponse{
+		URL: config.AuthCodeURL(
+			state,
+			oauth2.AccessTypeOffline,
+			oauth2.SetAuthURLParam("prompt", "consent"),
+			oauth2.S256ChallengeOption(verifier),
+		),
+		RedirectURL: config.RedirectURL,
+	})
+}
+
+// handleCallback completes the authorization and stores the refresh token.
+// It is opened by the browser of the user, so it requires no authentication
+// but a valid state.
+func handleCallback(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+
+	key := storeKeyPrefix + query.Get("state")
+	pending, ok := e.App.Store().Get(key).(*pendingAuthorization)
+	e.App.Store().Remove(key)
+	if !ok || time.Now().After(pending.expires) {
+		return e.BadRequestError("Unknown or expired authorization, please start again.", nil)
+	}
+
+	if reason := query.Get("error"); reason != "" {
+		return e.BadRequestError("The authorization was denied: "+reason, nil)
+	}
+
+	account, err := e.App.FindRecordById("ib_smtp_accounts", pending.account)
+	if err != nil {
+		return e.NotFoundError("Account not found.", nil)
+	}
+
+	config, err := Config(e.App, account)
+	if err != nil {
+		return e.BadRequestError(err.Error(), nil)
+	}
+
+	token, err := config.Exchange(e.Request.Context(), query.Get("code"), oauth2.VerifierOption(pending.verifier))
+	if err != nil {
+		return e.BadRequestError("Failed to exchange the authorization code.", err)
+	}
+
+	if token.RefreshToken == "" {
+		return e.BadRequestError("The provider did not return a refresh token.", nil)
+	}
+
+	account.Set("oauth2_refresh_token", token.RefreshToken)
+	if err := e.App.Save(account); err != nil {
+		return e.InternalServerError("Failed to store the refresh token.", err)
+	}
+
+	return e.HTML(http.StatusOK, "<p>The account was connected, this window can be closed now.</p>")
+}
@@ -0,0 +1,162 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/oauth2"
+
+	"github.com/yerTools/imapbackup/src/go/secrets"
+)
+
+const (
+	// AuthTypeOAuth2 is the 'auth_type' of accounts that log in using XOAUTH2.
+	AuthTypeOAuth2 = "oauth2"
+
+	callbackPath = "/api/ib/oauth2/callback"
+)
+
+type provider struct {
+	authURL  string
+	tokenURL string
+	scopes   []string
+}
+
+// providers holds the endpoints and IMAP scopes of the well-known providers.
+var providers = map[string]provider{
+	"google": {
+		authURL:  "https://accounts.google.com/o/oauth2/auth",
+		tokenURL: "https://oauth2.googleapis.com/token",
+		scopes:   []string{"https://mail.google.com/"},
+	},
+	"microsoft": {
+		authURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+		tokenURL: "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		scopes:   []string{"https://outlook.office.com/IMAP.AccessAsUser.All", "offline_access"},
+	},
+	"custom": {},
+}
+
+// IsOAuth2 reports whether the account logs in using XOAUTH2 instead of a password.
+func IsOAuth2(account *core.Record) bool {
+	return account.GetString("auth_type") == AuthTypeOAuth2
+}
+
+// CallbackURL returns the redirect URL that has to be registered with the provider.
+func CallbackURL(app core.App) string {
+	return strings.TrimRight(app.Settings().Meta.AppURL, "/") + callbackPath
+}
+
+// Config returns the OAuth2 client of the account. The endpoints and scopes
+// of the account take precedence over the ones of its provider.
+func Config(app core.App, account *core.Record) (*oauth2.Config, error) {
+	p, ok := providers[account.GetString("oauth2_provider")]
+	if !ok {
+		return nil, fmt.Errorf("unknown OAuth2 provider %q", account.GetString("oauth2_provider"))
+	}
+
+	clientSecret, err := secrets.Reveal(account.GetString("oauth2_client_secret"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt client secret: %w", err)
+	}
+
+	config := &oauth2.Config{
+		ClientID:     account.GetString("oauth2_client_id"),
+		ClientSecret: clientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  p.authURL,
+			TokenURL: p.tokenURL,
+		},
+		RedirectURL: CallbackURL(app),
+		Scopes:      p.scopes,
+	}
+
+	if authURL := account.GetString("oauth2_auth_url"); authURL != "" {
+		config.Endpoint.AuthURL = authURL
+	}
+	if tokenURL := account.GetString("oauth2_token_url"); tokenURL != "" {
+		config.Endpoint.TokenURL = tokenURL
+	}
+	if scopes := strings.Fields(account.GetString("oauth2_scopes")); len(scopes) > 0 {
+		config.Scopes = scopes
+	}
+
+	if config.Endpoint.AuthURL == "" || config.Endpoint.TokenURL == "" {
+		return nil, errors.New("OAuth2 endpoints are missing")
+	}
+
+	return config, nil
+}
+
+// refreshLocks holds a mutex for every account, so that a refresh token is
+// never used again by one refresh while another one rotates it.
+var refreshLocks sync.Map
+
+// AccessToken uses the stored refresh token to get a new access token for
+// the account. A refresh token rotated by the provider is stored right away.
+// The HTTP client used for the request can be set on the context using
+// oauth2.HTTPClient.
+func AccessToken(ctx context.Context, app core.App, account *core.Record) (string, error) {
+	mu, _ := refreshLocks.LoadOrStore(account.Id, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	// a refresh that held the lock before might have rotated the token
+	stored, err := app.FindRecordById("ib_smtp_accounts", account.Id)
+	if err != nil {
+		return "", fmt.Errorf("failed to find account %s: %w", account.Id, err)
+	}
+
+	refreshToken, err := secrets.Reveal(stored.GetString("oauth2_refresh_token"))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt refresh token: %w", err)
+	}
+	if refreshToken == "" {
+		return "", errors.New("account is not connected yet, authorize it first")
+	}
+
+	config, err := Config(app, account)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh access token: %w", err)
+	}
+
+	if token.RefreshToken != "" && token.RefreshToken != refreshToken {
+		if err := storeRefreshToken(app, account, token.RefreshToken); err != nil {
+			return "", fmt.Errorf("failed to store rotated refresh token: %w", err)
+		}
+	}
+
+	return token.AccessToken, nil
+}
+
+// storeRefreshToken updates the refresh token of the account directly, so
+// that a rotation is not taken as a change of the account by its hooks,
+// like the ones of push mode that reconnect on every change.
+func storeRefreshToken(app core.App, account *core.Record, refreshToken string) error {
+	sealed, err := secrets.Seal(refreshToken)
+	if err != nil {
+		return err
+	}
+
+	_, err = app.DB().Update(
+		"smtp_accounts",
+		dbx.Params{"oauth2_refresh_token": sealed},
+		dbx.HashExp{"id": account.Id},
+	).Execute()
+	if err != nil {
+		return err
+	}
+
+	account.Set("oauth2_refresh_token", sealed)
+	return nil
+}
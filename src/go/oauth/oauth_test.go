@@ -0,0 +1,240 @@
+package oauth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/tests"
+	"golang.org/x/oauth2"
+
+	_ "github.com/yerTools/imapbackup/src/go/database/migrations"
+	"github.com/yerTools/imapbackup/src/go/secrets"
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+// TestMain configures a master key, rotated refresh tokens are stored
+// encrypted.
+func TestMain(m *testing.M) {
+	os.Setenv(secrets.KeyEnv, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	os.Exit(m.Run())
+}
+
+func TestAccessToken(t *testing.T) {
+	scenarios := []struct {
+		name         string
+		refreshToken string
+		status       int
+		body         string
+
+		expectRequest        bool
+		expectedAccessToken  string
+		expectedRefreshToken string
+		expectedErrorCode    string
+	}{
+		{
+			name:                 "refresh",
+			refreshToken:         "refresh-1",
+			status:               http.StatusOK,
+			body:                 `{"access_token":"access-1","token_type":"Bearer","expires_in":3600}`,
+			expectRequest:        true,
+			expectedAccessToken:  "access-1",
+			expectedRefreshToken: "refresh-1",
+		},
+		{
+			name:                 "same refresh token returned",
+			refreshToken:         "refresh-1",
+			status:               http.StatusOK,
+			body:                 `{"access_token":"access-1","token_type":"Bearer","refresh_token":"refresh-1"}`,
+			expectRequest:        true,
+			expectedAccessToken:  "access-1",
+			expectedRefreshToken: "refresh-1",
+		},
+		{
+			name:                 "rotation",
+			refreshToken:         "refresh-1",
+			status:               http.StatusOK,
+			body:                 `{"access_token":"access-2","token_type":"Bearer","refresh_token":"refresh-2"}`,
+			expectRequest:        true,
+			expectedAccessToken:  "access-2",
+			expectedRefreshToken: "refresh-2",
+		},
+		{
+			name:                 "invalid grant",
+			refreshToken:         "revoked",
+			status:               http.StatusBadRequest,
+			body:                 `{"error":"invalid_grant","error_description":"Token has been expired or revoked."}`,
+			expectRequest:        true,
+			expectedRefreshToken: "revoked",
+			expectedErrorCode:    "invalid_grant",
+		},
+		{
+			name:              "not connected",
+			expectedErrorCode: "-",
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			requests := 0
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+
+				if err := r.ParseForm(); err != nil {
+					t.Error(err)
+				}
+				if grantType := r.PostForm.Get("grant_type"); grantType != "refresh_token" {
+					t.Errorf("expected grant_type refresh_token, got %q", grantType)
+				}
+				if refreshToken := r.PostForm.Get("refresh_token"); refreshToken != s.refreshToken {
+					t.Errorf("expected refresh token %q, got %q", s.refreshToken, refreshToken)
+				}
+				if clientID, clientSecret, _ := r.BasicAuth(); clientID != "client" || clientSecret != "secret" {
+					if r.PostForm.Get("client_id") != "client" || r.PostForm.Get("client_secret") != "secret" {
+						t.Error("expected the client credentials to be sent")
+					}
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(s.status)
+				w.Write([]byte(s.body))
+			}))
+			defer server.Close()
+
+			app, err := tests.NewTestApp()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer app.Cleanup()
+
+			account := testutil.CreateAccount(t, app, map[string]any{
+				"auth_type":            AuthTypeOAuth2,
+				"oauth2_provider":      "custom",
+				"oauth2_client_id":     "client",
+				"oauth2_client_secret": "secret",
+				"oauth2_auth_url":      "https://auth.example.org/authorize",
+				"oauth2_token_url":     server.URL,
+				"oauth2_refresh_token": s.refreshToken,
+			})
+
+			ctx := context.WithValue(context.Background(), oauth2.HTTPClient, server.Client())
+			accessToken, err := AccessToken(ctx, app, account)
+
+			switch {
+			case s.expectedErrorCode == "" && err != nil:
+				t.Fatal(err)
+			case s.expectedErrorCode == "-" && err == nil:
+				t.Fatal("expected an error")
+			case s.expectedErrorCode != "" && s.expectedErrorCode != "-":
+				var retrieveErr *oauth2.RetrieveError
+				if !errors.As(err, &retrieveErr) || retrieveErr.ErrorCode != s.expectedErrorCode {
+					t.Fatalf("expected error code %q, got %v", s.expectedErrorCode, err)
+				}
+			}
+
+			// the client credentials may be sent twice, as header and as parameters
+			if (requests > 0) != s.expectRequest {
+				t.Fatalf("expected a token request to be %v, got %d request(s)", s.expectRequest, requests)
+			}
+
+			if accessToken != s.expectedAccessToken {
+				t.Fatalf("expected access token %q, got %q", s.expectedAccessToken, accessToken)
+			}
+
+			stored, err := app.FindRecordById("ib_smtp_accounts", account.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			refreshToken, err := secrets.Reveal(stored.GetString("oauth2_refresh_token"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refreshToken != s.expectedRefreshToken {
+				t.Fatalf("expected stored refresh token %q, got %q", s.expectedRefreshToken, refreshToken)
+			}
+		})
+	}
+}
+
+func TestAccessTokenConcurrentRotation(t *testing.T) {
+	// every refresh rotates the token and revokes the one that was used
+	var mu sync.Mutex
+	current := "refresh-0"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("refresh_token") != current {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		n, _ := strconv.Atoi(current[len("refresh-"):])
+		current = "refresh-" + strconv.Itoa(n+1)
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","refresh_token":"` + current + `"}`))
+	}))
+	defer server.Close()
+
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	account := testutil.CreateAccount(t, app, map[string]any{
+		"auth_type":            AuthTypeOAuth2,
+		"oauth2_provider":      "custom",
+		"oauth2_client_id":     "client",
+		"oauth2_client_secret": "secret",
+		"oauth2_auth_url":      "https://auth.example.org/authorize",
+		"oauth2_token_url":     server.URL,
+		"oauth2_refresh_token": "refresh-0",
+	})
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, server.Client())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every caller holds its own copy of the account, like the syncs do
+			stale, err := app.FindRecordById("ib_smtp_accounts", account.Id)
+			if err != nil {
+				errs <- err
+				return
+			}
+			_, err = AccessToken(ctx, app, stale)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, err := app.FindRecordById("ib_smtp_accounts", account.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, err := secrets.Reveal(stored.GetString("oauth2_refresh_token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshToken != "refresh-4" {
+		t.Fatalf("expected stored refresh token refresh-4, got %q", refreshToken)
+	}
+}
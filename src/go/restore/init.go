@@ -0,0 +1,112 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+
+	"github.com/yerTools/imapbackup/src/go/archive"
+)
+
+// Init registers the restore command and API endpoint.
+func Init(app *pocketbase.PocketBase) {
+	app.RootCmd.AddCommand(newCommand(app))
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.POST("/api/ib/restore", handleRestore).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+}
+
+func newCommand(app core.App) *cobra.Command {
+	var target string
+	selectionFlags := &archive.SelectionFlags{}
+
+	command := &cobra.Command{
+		Use:   "restore",
+		Short: "Restores archived emails to an IMAP account",
+		RunE: func(command *cobra.Command, args []string) error {
+			selection, err := selectionFlags.Selection()
+			if err != nil {
+				return err
+			}
+
+			targetAccount, err := app.FindRecordById("ib_smtp_accounts", target)
+			if err != nil {
+				return fmt.Errorf("failed to find target account %q: %w", target, err)
+			}
+
+			result, err := ToAccount(command.Context(), app, targetAccount, selection)
+			if result != nil {
+				log.Printf("appended %d, skipped %d and failed %d email(s)\n", result.Appended, result.Skipped, result.Failed)
+			}
+			return err
+		},
+	}
+
+	command.Flags().StringVar(&target, "target", "", "id of the account the emails are appended to")
+	command.MarkFlagRequired("target")
+	selectionFlags.Register(command.Flags())
+
+	return command
+}
+
+type restoreRequest struct {
+	TargetAccount string   `json:"target_account"`
+	Accounts      []string `json:"accounts"`
+	Folders       []string `json:"folders"`
+	Since         string   `json:"since"`
+	Before        string   `json:"before"`
+	Filter        string   `json:"filter"`
+}
+
+func handleRestore(e *core.RequestEvent) error {
+	body := restoreRequest{}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body.", err)
+	}
+
+	selection, err := archive.NewSelection(body.Accounts, body.Folders, body.Since, body.Before, body.Filter)
+	if err != nil {
+		return e.BadRequestError(err.Error(), nil)
+	}
+
+	targetAccount, err := e.App.FindRecordById("ib_smtp_accounts", body.TargetAccount)
+	if err != nil {
+		return e.NotFoundError("Target account not found.", nil)
+	}
+
+	if !e.HasSuperuserAuth() {
+		if targetAccount.GetString("created_by") != e.Auth.Id {
+			return e.NotFoundError("Target account not found.", nil)
+		}
+		selection.Owner = e.Auth.Id
+	}
+
+	selection.RequestInfo, err = e.RequestInfo()
+	if err != nil {
+		return e.BadRequestError("Invalid request.", err)
+	}
+
+	ctx, cancel := context.WithTimeout(e.Request.Context(), time.Hour)
+	defer cancel()
+
+	result, err := ToAccount(ctx, e.App, targetAccount, selection)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return e.JSON(http.StatusRequestTimeout, result)
+		}
+		return e.BadRequestError("Restore failed: "+err.Error(), nil)
+	}
+
+	return e.JSON(http.StatusOK, result)
+}
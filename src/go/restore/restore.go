@@ -0,0 +1,190 @@
+package restore
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/yerTools/imapbackup/src/go/archive"
+	"github.com/yerTools/imapbackup/src/go/connect"
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+)
+
+// regexFlag matches the flags that can be sent back to a server.
+var regexFlag = regexp.MustCompile(`^\\?[A-Za-z0-9$._-]+$`)
+
+// Result counts what happened to the selected emails.
+type Result struct {
+	Appended int `json:"appended"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+// Restore appends every selected email to the server the client is logged in
+// to, keeping folder, flags and internal date. Emails that already exist in
+// the target folder are skipped, so a restore can be repeated. Gmail emails
+// are appended to the folder of every label they had, see
+// archive.GmailFolders.
+func Restore(ctx context.Context, app core.App, c *imapclient.Client, selection archive.Selection) (*Result, error) {
+	reader, err := archive.NewReader(app)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	gmail := archive.NewGmailFolders(app)
+	result := &Result{}
+	selected := ""
+
+	err = selection.Each(app, func(email *core.Record) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		folders, err := gmail.Of(email)
+		if err != nil {
+			return err
+		}
+
+		var message []byte
+		var flags []string
+
+		for _, folder := range folders {
+			if folder == "" {
+				folder = "INBOX"
+			}
+
+			if folder != selected {
+				if err := selectOrCreate(c, folder); err != nil {
+					return fmt.Errorf("failed to select folder %s: %w", folder, err)
+				}
+				selected = folder
+			}
+
+			if message == nil {
+				message, err = reader.ReadAll(email)
+				if err != nil {
+					log.Printf("failed to read email %s: %v\n", email.Id, err)
+					result.Failed++
+					return nil
+				}
+
+				flags, err = reader.Flags(email)
+				if err != nil {
+					return err
+				}
+			}
+
+			exists, err := messageExists(c, email.GetString("message_id"), message)
+			if err != nil {
+				return fmt.Errorf("failed to search for existing message: %w", err)
+			}
+			if exists {
+				result.Skipped++
+				continue
+			}
+
+			err = c.Append(folder, appendableFlags(flags), email.GetDateTime("received").Time(), message)
+			if err != nil {
+				if !imapclient.IsStatusError(err) {
+					return fmt.Errorf("failed to append email %s: %w", email.Id, err)
+				}
+				log.Printf("server refused email %s: %v\n", email.Id, err)
+				result.Failed++
+				continue
+			}
+
+			result.Appended++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// ToAccount connects to the given 'ib_smtp_accounts' record and restores the
+// selected emails into it.
+func ToAccount(ctx context.Context, app core.App, target *core.Record, selection archive.Selection) (*Result, error) {
+	if target.GetBool("offline") {
+		return nil, errors.New("can not restore into an offline account")
+	}
+
+	c, err := connect.Account(ctx, app, target)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	return Restore(ctx, app, c, selection)
+}
+
+func selectOrCreate(c *imapclient.Client, folder string) error {
+	_, err := c.Select(folder, false)
+	if err == nil || !imapclient.IsStatusError(err) {
+		return err
+	}
+
+	if err := c.Create(folder); err != nil {
+		return err
+	}
+
+	_, err = c.Select(folder, false)
+	return err
+}
+
+// messageExists reports whether the message is already in the selected
+// folder. Messages are found by their Message-ID, messages without one by
+// their size and content.
+func messageExists(c *imapclient.Client, messageID string, message []byte) (bool, error) {
+	if messageID != "" {
+		uids, err := c.UIDSearch("HEADER Message-ID", imapclient.Quote(messageID))
+		if err != nil {
+			return false, err
+		}
+
+		return len(uids) > 0, nil
+	}
+
+	if len(message) == 0 {
+		return false, nil
+	}
+
+	uids, err := c.UIDSearch("LARGER", len(message)-1, "SMALLER", len(message)+1)
+	if err != nil || len(uids) == 0 {
+		return false, err
+	}
+
+	candidates, err := c.FetchRaw(uids...)
+	if err != nil {
+		return false, err
+	}
+
+	sum := sha256.Sum256(message)
+	for _, candidate := range candidates {
+		if sha256.Sum256(candidate) == sum {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func appendableFlags(flags []string) []string {
+	appendable := make([]string, 0, len(flags))
+	for _, flag := range flags {
+		if flag == `\Recent` || !regexFlag.MatchString(flag) {
+			continue
+		}
+		appendable = append(appendable, flag)
+	}
+	return appendable
+}
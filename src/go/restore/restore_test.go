@@ -0,0 +1,178 @@
+package restore
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+
+	"github.com/yerTools/imapbackup/src/go/archive"
+	_ "github.com/yerTools/imapbackup/src/go/database/migrations"
+	"github.com/yerTools/imapbackup/src/go/imapclient"
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+// dialServer returns a client that is logged in to the server.
+func dialServer(t *testing.T, addr *net.TCPAddr) *imapclient.Client {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := imapclient.NewClient(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Logout() })
+
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+type testEmail struct {
+	folder    string
+	messageID string
+	raw       string
+	flags     []string
+	received  time.Time
+}
+
+func createEmails(t *testing.T, app core.App, emails []testEmail) {
+	t.Helper()
+
+	account := testutil.CreateAccount(t, app, nil)
+
+	for _, email := range emails {
+		record := core.NewRecord(testutil.Collection(t, app, "ib_emails"))
+		record.Set("smtp_account", account.Id)
+		record.Set("folder", email.folder)
+		record.Set("message_id", email.messageID)
+		record.Set("received", email.received)
+		record.Set("size", len(email.raw))
+
+		raw, err := filesystem.NewFileFromBytes([]byte(email.raw), "message.eml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		record.Set("raw", raw)
+
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, flag := range email.flags {
+			flagRecord := core.NewRecord(testutil.Collection(t, app, "ib_email_flags"))
+			flagRecord.Set("email", record.Id)
+			flagRecord.Set("index", i)
+			flagRecord.Set("flag", flag)
+			if err := app.Save(flagRecord); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	received := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	emails := []testEmail{
+		{
+			folder:    "INBOX",
+			messageID: "<first@example.org>",
+			raw:       "Message-ID: <first@example.org>\r\nSubject: first\r\n\r\nfirst body\r\n",
+			flags:     []string{`\Seen`, `\Flagged`},
+			received:  received,
+		},
+		{
+			folder:   "Archive",
+			raw:      "Subject: without id\r\n\r\nsecond body\r\n",
+			flags:    []string{`\Answered`, `\Recent`},
+			received: received.Add(time.Hour),
+		},
+		{
+			folder:   "Archive",
+			raw:      "Subject: without id\r\n\r\nthird body\r\n",
+			received: received.Add(2 * time.Hour),
+		},
+	}
+	createEmails(t, app, emails)
+
+	be, addr := testutil.NewServer(t)
+	c := dialServer(t, addr)
+
+	// the memory server starts with one message in the inbox
+	inboxBefore := len(testutil.ServerMailbox(t, be, "INBOX").Messages)
+
+	scenarios := []struct {
+		name     string
+		expected Result
+	}{
+		{"first run", Result{Appended: 3}},
+		{"repeated run", Result{Skipped: 3}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			result, err := Restore(context.Background(), app, c, archive.Selection{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *result != s.expected {
+				t.Fatalf("expected %+v, got %+v", s.expected, *result)
+			}
+		})
+	}
+
+	inbox := testutil.ServerMailbox(t, be, "INBOX").Messages
+	if len(inbox) != inboxBefore+1 {
+		t.Fatalf("expected %d message(s) in INBOX, got %d", inboxBefore+1, len(inbox))
+	}
+
+	archived := testutil.ServerMailbox(t, be, "Archive").Messages
+	if len(archived) != 2 {
+		t.Fatalf("expected 2 message(s) in Archive, got %d", len(archived))
+	}
+
+	for _, check := range []struct {
+		message *memory.Message
+		email   testEmail
+		flags   []string
+	}{
+		{inbox[len(inbox)-1], emails[0], []string{`\Seen`, `\Flagged`}},
+		{archived[0], emails[1], []string{`\Answered`}},
+		{archived[1], emails[2], []string{}},
+	} {
+		if string(check.message.Body) != check.email.raw {
+			t.Errorf("expected message %q, got %q", check.email.raw, check.message.Body)
+		}
+
+		if !check.message.Date.Equal(check.email.received) {
+			t.Errorf("expected internal date %v, got %v", check.email.received, check.message.Date)
+		}
+
+		flags := slices.DeleteFunc(slices.Clone(check.message.Flags), func(flag string) bool {
+			return flag == `\Recent`
+		})
+		if !slices.Equal(flags, check.flags) {
+			t.Errorf("expected flags %v, got %v", check.flags, flags)
+		}
+	}
+}
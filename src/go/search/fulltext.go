@@ -0,0 +1,101 @@
+package search
+
+import (
+	"html"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// snippetStart and snippetEnd mark the matches inside a snippet until it
+	// got escaped, as the email content itself can not be trusted.
+	snippetStart = "\x01"
+	snippetEnd   = "\x02"
+)
+
+// Hit is an email that matched a full-text search.
+type Hit struct {
+	Id          string         `db:"id" json:"id"`
+	SmtpAccount string         `db:"smtp_account" json:"smtp_account"`
+	Folder      string         `db:"folder" json:"folder"`
+	Subject     string         `db:"subject" json:"subject"`
+	Received    types.DateTime `db:"received" json:"received"`
+
+	// Rank is the bm25 score of the match, lower is better.
+	Rank float64 `db:"rank" json:"rank"`
+
+	// Snippet is an HTML escaped excerpt of the email with every match
+	// wrapped in a <mark> element.
+	Snippet string `db:"snippet" json:"snippet"`
+}
+
+// Search returns the emails matching the query. Queries with free text are
+// ranked by the full-text index, all others return the newest emails first.
+// A non-empty owner limits the search to the accounts created by this user.
+func Search(app core.App, query *Query, owner string, limit int, offset int) ([]Hit, error) {
+	q := app.DB().Select(
+		"[[e.id]]",
+		"[[e.smtp_account]]",
+		"[[e.folder]]",
+		"[[e.subject]]",
+		"[[e.received]]",
+	).
+		From("emails e").
+		Where(query.where)
+
+	if query.rank != "" {
+		q.AndSelect(
+			"COALESCE([[f.rank]], 0) AS [[rank]]",
+			"COALESCE([[f.snippet]], '') AS [[snippet]]",
+		).
+			LeftJoin(
+				`(SELECT [[m.email]],
+					bm25({{emails_fts}}) AS [[rank]],
+					snippet({{emails_fts}}, -1, {:snippetStart}, {:snippetEnd}, '…', 16) AS [[snippet]]
+				FROM {{emails_fts}}
+				INNER JOIN {{emails_fts_ids}} m ON [[m.id]] = [[emails_fts.rowid]]
+				WHERE {{emails_fts}} MATCH {:rank}) f`,
+				dbx.NewExp("[[f.email]] = [[e.id]]"),
+			).
+			Bind(dbx.Params{
+				"rank":         query.rank,
+				"snippetStart": snippetStart,
+				"snippetEnd":   snippetEnd,
+			}).
+			OrderBy("[[f.rank]] IS NULL", "[[f.rank]]", "[[e.received]] DESC")
+	} else {
+		q.AndSelect("0 AS [[rank]]", "'' AS [[snippet]]").
+			OrderBy("[[e.received]] DESC")
+	}
+
+	if owner != "" {
+		q.AndWhere(dbx.NewExp(
+			"[[e.smtp_account]] IN (SELECT [[id]] FROM {{smtp_accounts}} WHERE [[created_by]] = {:owner})",
+			dbx.Params{"owner": owner},
+		))
+	}
+
+	if limit > 0 {
+		q.Limit(int64(limit))
+	}
+	if offset > 0 {
+		q.Offset(int64(offset))
+	}
+
+	hits := []Hit{}
+	if err := q.All(&hits); err != nil {
+		return nil, err
+	}
+
+	for i := range hits {
+		hits[i].Snippet = strings.NewReplacer(
+			snippetStart, "<mark>",
+			snippetEnd, "</mark>",
+		).Replace(html.EscapeString(hits[i].Snippet))
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,162 @@
+package search
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// addressCollections are the collections whose addresses are part of the
+// full-text index of an email.
+var addressCollections = []string{
+	"ib_email_from_addresses",
+	"ib_email_to_addresses",
+	"ib_email_reply_to_addresses",
+	"ib_email_cc_addresses",
+	"ib_email_bcc_addresses",
+}
+
+// indexer counts the pending changes of every email, so that an email gets
+// indexed only once after the transaction that changed it and its addresses.
+// PocketBase runs the after hooks of the records saved in a transaction once
+// it completed, the last of them indexes the email.
+type indexer struct {
+	mu      sync.Mutex
+	pending map[string]int
+}
+
+// change counts a change of the email that is about to be executed.
+func (ix *indexer) change(emailId string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.pending[emailId]++
+}
+
+// done completes a change of the email and reports whether it was the last
+// pending one.
+func (ix *indexer) done(emailId string) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if ix.pending[emailId] > 1 {
+		ix.pending[emailId]--
+		return false
+	}
+
+	delete(ix.pending, emailId)
+	return true
+}
+
+// registerIndexHooks keeps the full-text index in sync with the emails and
+// their addresses. A failed update is only logged, as the record itself was
+// already saved.
+func registerIndexHooks(app core.App) {
+	ix := &indexer{pending: map[string]int{}}
+
+	bind := func(emailId func(record *core.Record) string, collections ...string) {
+		change := func(e *core.RecordEvent) error {
+			ix.change(emailId(e.Record))
+			return e.Next()
+		}
+
+		succeeded := func(e *core.RecordEvent) error {
+			if ix.done(emailId(e.Record)) {
+				if err := index(e.App, emailId(e.Record)); err != nil {
+					log.Println(err)
+				}
+			}
+			return e.Next()
+		}
+
+		failed := func(e *core.RecordErrorEvent) error {
+			id := emailId(e.Record)
+			if ix.done(id) {
+				// other changes of the same transaction might have succeeded
+				if err := index(e.App, id); err != nil {
+					log.Println(err)
+				}
+			}
+			return e.Next()
+		}
+
+		app.OnRecordCreateExecute(collections...).BindFunc(change)
+		app.OnRecordUpdateExecute(collections...).BindFunc(change)
+		app.OnRecordDeleteExecute(collections...).BindFunc(change)
+
+		app.OnRecordAfterCreateSuccess(collections...).BindFunc(succeeded)
+		app.OnRecordAfterUpdateSuccess(collections...).BindFunc(succeeded)
+		app.OnRecordAfterDeleteSuccess(collections...).BindFunc(succeeded)
+
+		app.OnRecordAfterCreateError(collections...).BindFunc(failed)
+		app.OnRecordAfterUpdateError(collections...).BindFunc(failed)
+		app.OnRecordAfterDeleteError(collections...).BindFunc(failed)
+	}
+
+	bind(func(record *core.Record) string {
+		return record.Id
+	}, "ib_emails")
+
+	bind(func(record *core.Record) string {
+		return record.GetString("email")
+	}, addressCollections...)
+}
+
+func unindex(app core.App, emailId string) error {
+	_, err := app.DB().NewQuery(`
+		DELETE FROM {{emails_fts}}
+		WHERE [[rowid]] = (SELECT [[id]] FROM {{emails_fts_ids}} WHERE [[email]] = {:email})
+	`).Bind(dbx.Params{"email": emailId}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to remove email %s from full-text index: %w", emailId, err)
+	}
+
+	_, err = app.DB().Delete("emails_fts_ids", dbx.HashExp{"email": emailId}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to remove email %s from full-text index: %w", emailId, err)
+	}
+
+	return nil
+}
+
+// index replaces the full-text index entry of the email. Nothing gets indexed
+// if the email no longer exists.
+func index(app core.App, emailId string) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		if err := unindex(txApp, emailId); err != nil {
+			return err
+		}
+
+		_, err := txApp.DB().NewQuery(`
+			INSERT INTO {{emails_fts_ids}} ([[email]])
+			SELECT [[id]] FROM {{emails}} WHERE [[id]] = {:email}
+		`).Bind(dbx.Params{"email": emailId}).Execute()
+		if err != nil {
+			return fmt.Errorf("failed to add email %s to full-text index: %w", emailId, err)
+		}
+
+		_, err = txApp.DB().NewQuery(`
+			INSERT INTO {{emails_fts}} ([[rowid]], [[subject]], [[text]], [[addresses]])
+			SELECT [[m.id]], [[e.subject]], [[e.text]], (
+				SELECT group_concat([[a.display_name]] || ' ' || [[a.email_address]], ' ') FROM (
+					SELECT [[display_name]], [[email_address]] FROM {{email_from_addresses}} WHERE [[email]] = [[e.id]]
+					UNION ALL SELECT [[display_name]], [[email_address]] FROM {{email_to_addresses}} WHERE [[email]] = [[e.id]]
+					UNION ALL SELECT [[display_name]], [[email_address]] FROM {{email_reply_to_addresses}} WHERE [[email]] = [[e.id]]
+					UNION ALL SELECT [[display_name]], [[email_address]] FROM {{email_cc_addresses}} WHERE [[email]] = [[e.id]]
+					UNION ALL SELECT [[display_name]], [[email_address]] FROM {{email_bcc_addresses}} WHERE [[email]] = [[e.id]]
+				) a
+			)
+			FROM {{emails}} e
+			INNER JOIN {{emails_fts_ids}} m ON [[m.email]] = [[e.id]]
+			WHERE [[e.id]] = {:email}
+		`).Bind(dbx.Params{"email": emailId}).Execute()
+		if err != nil {
+			return fmt.Errorf("failed to add email %s to full-text index: %w", emailId, err)
+		}
+
+		return nil
+	})
+}
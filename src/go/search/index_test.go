@@ -0,0 +1,153 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	_ "github.com/yerTools/imapbackup/src/go/database/migrations"
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+// countRows returns the number of rows in a table.
+func countRows(t *testing.T, app core.App, table string) int {
+	t.Helper()
+
+	var count int
+	if err := app.DB().NewQuery("SELECT COUNT(*) FROM {{" + table + "}}").Row(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// search returns the ids of the emails matching the query.
+func search(t *testing.T, app core.App, text string) []string {
+	t.Helper()
+
+	query, err := ParseQuery(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := Search(app, query, "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	for _, hit := range hits {
+		ids = append(ids, hit.Id)
+	}
+	return ids
+}
+
+func TestIndexer(t *testing.T) {
+	ix := &indexer{pending: map[string]int{}}
+
+	ix.change("a")
+	ix.change("a")
+	ix.change("b")
+
+	scenarios := []struct {
+		email    string
+		expected bool
+	}{
+		{"a", false},
+		{"b", true},
+		{"a", true},
+		// changes that were never counted are indexed right away
+		{"c", true},
+	}
+
+	for _, s := range scenarios {
+		if done := ix.done(s.email); done != s.expected {
+			t.Fatalf("expected done(%s) to be %v, got %v", s.email, s.expected, done)
+		}
+	}
+
+	if len(ix.pending) != 0 {
+		t.Fatalf("expected no pending changes, got %v", ix.pending)
+	}
+}
+
+func TestIndexHooks(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	registerIndexHooks(app)
+
+	account := testutil.CreateAccount(t, app, nil)
+
+	email := core.NewRecord(testutil.Collection(t, app, "ib_emails"))
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		email.Set("smtp_account", account.Id)
+		email.Set("folder", "INBOX")
+		email.Set("subject", "Quarterly report")
+		email.Set("text", "The numbers are attached.")
+		if err := txApp.Save(email); err != nil {
+			return err
+		}
+
+		from := core.NewRecord(testutil.Collection(t, txApp, "ib_email_from_addresses"))
+		from.Set("email", email.Id)
+		from.Set("email_address", "alice@example.org")
+		from.Set("display_name", "Alice Liddell")
+		return txApp.Save(from)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"subject", "quarterly", 1},
+		{"text", "numbers", 1},
+		{"address", "liddell", 1},
+		{"no match", "invoice", 0},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if ids := search(t, app, s.query); len(ids) != s.expected {
+				t.Fatalf("expected %d hit(s), got %v", s.expected, ids)
+			}
+		})
+	}
+
+	if count := countRows(t, app, "emails_fts"); count != 1 {
+		t.Fatalf("expected 1 indexed email, got %d", count)
+	}
+
+	email.Set("subject", "Annual report")
+	if err := app.Save(email); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := search(t, app, "quarterly"); len(ids) != 0 {
+		t.Fatalf("expected the old subject to be unindexed, got %v", ids)
+	}
+	if ids := search(t, app, "annual"); len(ids) != 1 || ids[0] != email.Id {
+		t.Fatalf("expected email %s, got %v", email.Id, ids)
+	}
+	if count := countRows(t, app, "emails_fts"); count != 1 {
+		t.Fatalf("expected 1 indexed email, got %d", count)
+	}
+
+	if err := app.Delete(email); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"emails_fts", "emails_fts_ids"} {
+		if count := countRows(t, app, table); count != 0 {
+			t.Fatalf("expected %s to be empty, got %d row(s)", table, count)
+		}
+	}
+}
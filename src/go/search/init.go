@@ -0,0 +1,113 @@
+package search
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultPerPage = 30
+	maxPerPage     = 100
+)
+
+// Init keeps the full-text index up to date and registers the search command
+// and API endpoint.
+func Init(app *pocketbase.PocketBase) {
+	registerIndexHooks(app)
+
+	app.RootCmd.AddCommand(newCommand(app))
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.GET("/api/ib/search", handleSearch).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+}
+
+func newCommand(app core.App) *cobra.Command {
+	var owner string
+	var limit int
+
+	command := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Searches the archived emails, e.g. 'from:alice has:attachment before:2024-01-01 \"quarterly report\"'",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(command *cobra.Command, args []string) error {
+			query, err := ParseQuery(strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+
+			hits, err := Search(app, query, owner, limit, 0)
+			if err != nil {
+				return err
+			}
+
+			out := command.OutOrStdout()
+			for _, hit := range hits {
+				fmt.Fprintf(out, "%s  %s  %s  %s\n", hit.Received.Time().Format(time.DateTime), hit.Id, hit.Folder, hit.Subject)
+			}
+
+			log.Printf("found %d email(s)\n", len(hits))
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&owner, "owner", "", "only search the accounts of this user id")
+	command.Flags().IntVar(&limit, "limit", defaultPerPage, "maximum number of emails to show")
+
+	return command
+}
+
+type searchResponse struct {
+	Page    int   `json:"page"`
+	PerPage int   `json:"perPage"`
+	Items   []Hit `json:"items"`
+}
+
+func handleSearch(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(query.Get("perPage"))
+	if perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+
+	parsed, err := ParseQuery(query.Get("q"))
+	if err != nil {
+		return e.BadRequestError(err.Error(), nil)
+	}
+
+	// the same rule as the list rule of 'ib_emails'
+	owner := ""
+	if !e.HasSuperuserAuth() {
+		owner = e.Auth.Id
+	}
+
+	hits, err := Search(e.App, parsed, owner, perPage, (page-1)*perPage)
+	if err != nil {
+		return e.InternalServerError("Failed to search emails.", err)
+	}
+
+	return e.JSON(http.StatusOK, searchResponse{
+		Page:    page,
+		PerPage: perPage,
+		Items:   hits,
+	})
+}
@@ -0,0 +1,455 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/yerTools/imapbackup/src/go/archive"
+)
+
+var regexSize = regexp.MustCompile(`^(\d+(?:\.\d+)?)([kmg]?)b?$`)
+
+// flagsByName are the values of the "is:" operator and the flag they test.
+var flagsByName = map[string]string{
+	"read":     `\Seen`,
+	"seen":     `\Seen`,
+	"starred":  `\Flagged`,
+	"flagged":  `\Flagged`,
+	"answered": `\Answered`,
+	"replied":  `\Answered`,
+	"draft":    `\Draft`,
+}
+
+// QueryError describes why a query could not be parsed.
+type QueryError struct {
+	// Position is the byte offset in the query the error was found at.
+	Position int
+	Message  string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Position+1, e.Message)
+}
+
+// Query is a parsed search query. The syntax follows the one of Gmail:
+//
+//	from:alice has:attachment folder:INBOX label:work before:2024-01-01 is:unread larger:5M "quarterly report"
+//
+// Terms are combined with AND unless they are separated by OR, a leading "-"
+// negates a term and parentheses group terms. Every term without operator is
+// searched in the full-text index.
+type Query struct {
+	where dbx.Expression
+
+	// rank is the FTS5 query the hits are ranked with, it is empty if the
+	// query has no free text.
+	rank string
+}
+
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind     tokenKind
+	position int
+
+	// key is the operator of a term, it is empty for free text.
+	key    string
+	value  string
+	quoted bool
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// readQuoted reads the quoted string starting at text[start] and returns
+// its content and the offset behind the closing quote.
+func readQuoted(text string, start int) (string, int, error) {
+	end := strings.IndexByte(text[start+1:], '"')
+	if end == -1 {
+		return "", 0, &QueryError{start, "missing closing quote"}
+	}
+
+	return text[start+1 : start+1+end], start + end + 2, nil
+}
+
+func tokenize(text string) ([]token, error) {
+	tokens := make([]token, 0)
+
+	for i := 0; i < len(text); {
+		c := text[i]
+
+		switch {
+		case isSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen, position: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose, position: i})
+			i++
+		case c == '-' && i+1 < len(text) && !isSpace(text[i+1]) && text[i+1] != ')':
+			tokens = append(tokens, token{kind: tokenNot, position: i})
+			i++
+		case c == '"':
+			value, next, err := readQuoted(text, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenTerm, position: i, value: value, quoted: true})
+			i = next
+		default:
+			t := token{kind: tokenTerm, position: i}
+			start := i
+
+			for i < len(text) && !isSpace(text[i]) && text[i] != '(' && text[i] != ')' {
+				if text[i] != ':' || t.key != "" {
+					i++
+					continue
+				}
+
+				t.key = strings.ToLower(text[start:i])
+				i++
+				start = i
+
+				if i < len(text) && text[i] == '"' {
+					value, next, err := readQuoted(text, i)
+					if err != nil {
+						return nil, err
+					}
+					t.value = value
+					t.quoted = true
+					i = next
+					break
+				}
+			}
+
+			if !t.quoted {
+				t.value = text[start:i]
+			}
+
+			switch {
+			case t.key == "" && t.value == "OR":
+				t.kind = tokenOr
+			case t.key == "" && t.value == "AND":
+				// terms are combined with AND anyway
+				continue
+			}
+
+			tokens = append(tokens, t)
+		}
+	}
+
+	return tokens, nil
+}
+
+// ParseQuery parses a search query. The returned error is a *QueryError if
+// the query is malformed.
+func ParseQuery(text string) (*Query, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, &QueryError{0, "the query is empty"}
+	}
+
+	p := &parser{
+		text:   text,
+		tokens: tokens,
+	}
+
+	where, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, &QueryError{p.tokens[p.pos].position, "unexpected ')'"}
+	}
+
+	return &Query{
+		where: where,
+		rank:  strings.Join(p.rank, " OR "),
+	}, nil
+}
+
+type parser struct {
+	text   string
+	tokens []token
+	pos    int
+
+	params  int
+	negated int
+	rank    []string
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) parseOr() (dbx.Expression, error) {
+	exprs := make([]dbx.Expression, 0, 1)
+
+	for {
+		expr, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+
+		t, ok := p.peek()
+		if !ok || t.kind != tokenOr {
+			break
+		}
+		p.pos++
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return dbx.Or(exprs...), nil
+}
+
+func (p *parser) parseAnd() (dbx.Expression, error) {
+	exprs := make([]dbx.Expression, 0, 1)
+
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == tokenOr || t.kind == tokenClose {
+			break
+		}
+
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+
+	if len(exprs) == 0 {
+		t, ok := p.peek()
+		switch {
+		case !ok:
+			return nil, &QueryError{len(p.text), "expected a search term at the end of the query"}
+		case t.kind == tokenOr:
+			return nil, &QueryError{t.position, "OR needs a search term on both sides"}
+		default:
+			return nil, &QueryError{t.position, "expected a search term before ')'"}
+		}
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return dbx.And(exprs...), nil
+}
+
+func (p *parser) parseUnary() (dbx.Expression, error) {
+	t, _ := p.peek()
+	p.pos++
+
+	switch t.kind {
+	case tokenNot:
+		if next, ok := p.peek(); !ok || next.kind != tokenTerm && next.kind != tokenOpen {
+			return nil, &QueryError{t.position, "'-' has to be followed by a search term"}
+		}
+
+		p.negated++
+		expr, err := p.parseUnary()
+		p.negated--
+		if err != nil {
+			return nil, err
+		}
+		return dbx.Not(expr), nil
+	case tokenOpen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if next, ok := p.peek(); !ok || next.kind != tokenClose {
+			return nil, &QueryError{t.position, "missing closing parenthesis"}
+		}
+		p.pos++
+		return dbx.Enclose(expr), nil
+	default:
+		return p.compile(t)
+	}
+}
+
+// param returns a new, unique parameter name.
+func (p *parser) param() string {
+	p.params++
+	return fmt.Sprintf("q%d", p.params)
+}
+
+// contains returns a LIKE pattern matching every value containing s.
+func contains(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
+// quotePhrase turns text into an FTS5 phrase, so no character of the text
+// can change the meaning of the FTS5 query.
+func quotePhrase(text string) string {
+	return `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+}
+
+func (p *parser) compile(t token) (dbx.Expression, error) {
+	if t.value == "" {
+		if t.key == "" {
+			return nil, &QueryError{t.position, "empty phrase"}
+		}
+		return nil, &QueryError{t.position, fmt.Sprintf("%s: needs a value", t.key)}
+	}
+
+	param := p.param()
+	params := dbx.Params{param: t.value}
+
+	switch t.key {
+	case "":
+		match := quotePhrase(t.value)
+		if p.negated == 0 {
+			p.rank = append(p.rank, match)
+		}
+		params[param] = match
+		return dbx.NewExp(
+			"[[e.id]] IN (SELECT [[m.email]] FROM {{emails_fts}} INNER JOIN {{emails_fts_ids}} m ON [[m.id]] = [[emails_fts.rowid]] WHERE {{emails_fts}} MATCH {:"+param+"})",
+			params,
+		), nil
+	case "from":
+		return p.address(param, t.value, "email_from_addresses"), nil
+	case "to":
+		return p.address(param, t.value, "email_to_addresses", "email_cc_addresses", "email_bcc_addresses"), nil
+	case "cc":
+		return p.address(param, t.value, "email_cc_addresses"), nil
+	case "bcc":
+		return p.address(param, t.value, "email_bcc_addresses"), nil
+	case "subject":
+		params[param] = contains(t.value)
+		return dbx.NewExp("[[e.subject]] LIKE {:"+param+"} ESCAPE '\\'", params), nil
+	case "folder", "in":
+		if strings.EqualFold(t.value, "INBOX") {
+			params[param] = "INBOX"
+		}
+		return dbx.NewExp("[[e.folder]] = {:"+param+"}", params), nil
+	case "label":
+		// labels are compared like Gmail does, ignoring case, and system
+		// labels like \Important can be given without their backslash
+		params[param] = strings.TrimPrefix(t.value, `\`)
+		return dbx.NewExp("EXISTS (SELECT 1 FROM {{email_labels}} WHERE [[email]] = [[e.id]] AND LTRIM([[label]], '\\') = {:"+param+"} COLLATE NOCASE)", params), nil
+	case "has":
+		if !strings.EqualFold(t.value, "attachment") {
+			return nil, &QueryError{t.position, fmt.Sprintf("has:%s is not supported, expected has:attachment", t.value)}
+		}
+		return dbx.NewExp("EXISTS (SELECT 1 FROM {{email_attachments}} WHERE [[email]] = [[e.id]])"), nil
+	case "filename":
+		params[param] = contains(t.value)
+		return dbx.NewExp("EXISTS (SELECT 1 FROM {{email_attachments}} WHERE [[email]] = [[e.id]] AND [[name]] LIKE {:"+param+"} ESCAPE '\\')", params), nil
+	case "is":
+		return p.is(t, param)
+	case "before", "older", "after", "newer":
+		date, err := archive.ParseDate(t.value)
+		if err != nil {
+			return nil, &QueryError{t.position, fmt.Sprintf("%s: %v", t.key, err)}
+		}
+		dt, err := types.ParseDateTime(date)
+		if err != nil {
+			return nil, &QueryError{t.position, fmt.Sprintf("%s: %v", t.key, err)}
+		}
+		params[param] = dt.String()
+
+		if t.key == "before" || t.key == "older" {
+			return dbx.NewExp("[[e.received]] < {:"+param+"}", params), nil
+		}
+		return dbx.NewExp("[[e.received]] >= {:"+param+"}", params), nil
+	case "larger", "smaller":
+		size, err := parseSize(t.value)
+		if err != nil {
+			return nil, &QueryError{t.position, fmt.Sprintf("%s: %v", t.key, err)}
+		}
+		params[param] = size
+
+		if t.key == "larger" {
+			return dbx.NewExp("[[e.size]] > {:"+param+"}", params), nil
+		}
+		return dbx.NewExp("[[e.size]] < {:"+param+"}", params), nil
+	}
+
+	return nil, &QueryError{t.position, fmt.Sprintf("unknown operator %q, put the term in quotes to search for it as text", t.key+":")}
+}
+
+// address matches emails with an address in one of the collections whose
+// email address or display name contains the value.
+func (p *parser) address(param string, value string, tables ...string) dbx.Expression {
+	parts := make([]string, len(tables))
+	for i, table := range tables {
+		parts[i] = "EXISTS (SELECT 1 FROM {{" + table + "}} WHERE [[email]] = [[e.id]] AND " +
+			"([[email_address]] LIKE {:" + param + "} ESCAPE '\\' OR [[display_name]] LIKE {:" + param + "} ESCAPE '\\'))"
+	}
+
+	return dbx.NewExp("("+strings.Join(parts, " OR ")+")", dbx.Params{param: contains(value)})
+}
+
+func (p *parser) is(t token, param string) (dbx.Expression, error) {
+	value := strings.ToLower(t.value)
+
+	hasFlag := func(flag string) dbx.Expression {
+		return dbx.NewExp("EXISTS (SELECT 1 FROM {{email_flags}} WHERE [[email]] = [[e.id]] AND [[flag]] = {:"+param+"})", dbx.Params{param: flag})
+	}
+
+	switch value {
+	case "unread", "unseen":
+		return dbx.Not(hasFlag(`\Seen`)), nil
+	case "deleted":
+		// deleted on the server, but still archived
+		return dbx.NewExp("[[e.deleted_on_server]] != ''"), nil
+	}
+
+	flag, ok := flagsByName[value]
+	if !ok {
+		return nil, &QueryError{t.position, fmt.Sprintf("is:%s is not supported, expected one of read, unread, starred, answered, draft or deleted", t.value)}
+	}
+
+	return hasFlag(flag), nil
+}
+
+// parseSize parses a size in bytes with an optional K, M or G suffix.
+func parseSize(value string) (int64, error) {
+	match := regexSize.FindStringSubmatch(strings.ToLower(value))
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %q, expected a number with an optional K, M or G suffix", value)
+	}
+
+	size, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	switch match[2] {
+	case "k":
+		size *= 1 << 10
+	case "m":
+		size *= 1 << 20
+	case "g":
+		size *= 1 << 30
+	}
+
+	return int64(size), nil
+}
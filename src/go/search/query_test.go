@@ -0,0 +1,306 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+func TestTokenize(t *testing.T) {
+	scenarios := []struct {
+		name     string
+		text     string
+		expected []token
+	}{
+		{
+			"free text",
+			"quarterly  report",
+			[]token{
+				{kind: tokenTerm, position: 0, value: "quarterly"},
+				{kind: tokenTerm, position: 11, value: "report"},
+			},
+		},
+		{
+			"operators",
+			`From:alice subject:"annual report"`,
+			[]token{
+				{kind: tokenTerm, position: 0, key: "from", value: "alice"},
+				{kind: tokenTerm, position: 11, key: "subject", value: "annual report", quoted: true},
+			},
+		},
+		{
+			"value with colon",
+			"subject:re:hello",
+			[]token{
+				{kind: tokenTerm, position: 0, key: "subject", value: "re:hello"},
+			},
+		},
+		{
+			"or, and, negation and groups",
+			"-(a OR b) AND c",
+			[]token{
+				{kind: tokenNot, position: 0},
+				{kind: tokenOpen, position: 1},
+				{kind: tokenTerm, position: 2, value: "a"},
+				{kind: tokenOr, position: 4, value: "OR"},
+				{kind: tokenTerm, position: 7, value: "b"},
+				{kind: tokenClose, position: 8},
+				{kind: tokenTerm, position: 14, value: "c"},
+			},
+		},
+		{
+			"lowercase or is a term",
+			"a or b",
+			[]token{
+				{kind: tokenTerm, position: 0, value: "a"},
+				{kind: tokenTerm, position: 2, value: "or"},
+				{kind: tokenTerm, position: 5, value: "b"},
+			},
+		},
+		{
+			"dash inside and at the end of a term",
+			"e-mail -",
+			[]token{
+				{kind: tokenTerm, position: 0, value: "e-mail"},
+				{kind: tokenTerm, position: 7, value: "-"},
+			},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			tokens, err := tokenize(s.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(tokens, s.expected) {
+				t.Fatalf("expected %+v, got %+v", s.expected, tokens)
+			}
+		})
+	}
+}
+
+func TestParseQueryRank(t *testing.T) {
+	scenarios := []struct {
+		text     string
+		expected string
+	}{
+		{"from:alice", ""},
+		{"report", `"report"`},
+		{`"quarterly report" OR summary`, `"quarterly report" OR "summary"`},
+		{`say "hi"`, `"say" OR "hi"`},
+		{"report -draft", `"report"`},
+		{`a"b`, `"a""b"`},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.text, func(t *testing.T) {
+			query, err := ParseQuery(s.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if query.rank != s.expected {
+				t.Fatalf("expected rank %q, got %q", s.expected, query.rank)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	scenarios := []struct {
+		text     string
+		position int
+		message  string
+	}{
+		{"", 0, "the query is empty"},
+		{"   ", 0, "the query is empty"},
+		{`a "b`, 2, "missing closing quote"},
+		{`subject:"b`, 8, "missing closing quote"},
+		{"a OR", 4, "expected a search term at the end of the query"},
+		{"OR a", 0, "OR needs a search term on both sides"},
+		{"a OR OR b", 5, "OR needs a search term on both sides"},
+		{"(a", 0, "missing closing parenthesis"},
+		{"()", 1, "expected a search term before ')'"},
+		{"a)", 1, "unexpected ')'"},
+		{"-(", 2, "expected a search term at the end of the query"},
+		{`""`, 0, "empty phrase"},
+		{"a from:", 2, "from: needs a value"},
+		{"has:pdf", 0, "has:pdf is not supported, expected has:attachment"},
+		{"is:odd", 0, "is:odd is not supported, expected one of read, unread, starred, answered, draft or deleted"},
+		{"larger:5Q", 0, `larger: invalid size "5Q", expected a number with an optional K, M or G suffix`},
+		{"x foo:bar", 2, `unknown operator "foo:", put the term in quotes to search for it as text`},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.text, func(t *testing.T) {
+			_, err := ParseQuery(s.text)
+
+			var queryErr *QueryError
+			if !errors.As(err, &queryErr) {
+				t.Fatalf("expected a *QueryError, got %v", err)
+			}
+
+			if queryErr.Position != s.position || queryErr.Message != s.message {
+				t.Fatalf("expected %q at %d, got %q at %d", s.message, s.position, queryErr.Message, queryErr.Position)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	scenarios := []struct {
+		value    string
+		expected int64
+		err      bool
+	}{
+		{"100", 100, false},
+		{"5K", 5 << 10, false},
+		{"1.5m", 3 << 19, false},
+		{"2GB", 2 << 30, false},
+		{"10kb", 10 << 10, false},
+		{"", 0, true},
+		{"5T", 0, true},
+		{"-1", 0, true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.value, func(t *testing.T) {
+			size, err := parseSize(s.value)
+			if s.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %d", size)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if size != s.expected {
+				t.Fatalf("expected %d, got %d", s.expected, size)
+			}
+		})
+	}
+}
+
+func TestSearchOperators(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	registerIndexHooks(app)
+
+	account := testutil.CreateAccount(t, app, nil)
+
+	type testEmail struct {
+		folder   string
+		subject  string
+		from     string
+		flags    []string
+		labels   []string
+		size     int
+		received time.Time
+	}
+
+	received := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	emails := map[string]testEmail{
+		"report": {"INBOX", "Quarterly report", "alice@example.org", []string{`\Seen`}, []string{`\Important`, "Work"}, 2 << 20, received},
+		"invite": {"INBOX", "Invitation 100%", "bob@example.org", []string{`\Flagged`}, []string{"Work/Events"}, 1024, received.AddDate(0, 1, 0)},
+		"draft":  {"Drafts", "Report draft", "alice@example.org", []string{`\Draft`, `\Seen`}, nil, 512, received.AddDate(0, 2, 0)},
+	}
+
+	ids := map[string]string{}
+	for name, email := range emails {
+		record := core.NewRecord(testutil.Collection(t, app, "ib_emails"))
+		record.Set("smtp_account", account.Id)
+		record.Set("folder", email.folder)
+		record.Set("subject", email.subject)
+		record.Set("size", email.size)
+		record.Set("received", email.received)
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+		ids[record.Id] = name
+
+		from := core.NewRecord(testutil.Collection(t, app, "ib_email_from_addresses"))
+		from.Set("email", record.Id)
+		from.Set("email_address", email.from)
+		if err := app.Save(from); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, flag := range email.flags {
+			flagRecord := core.NewRecord(testutil.Collection(t, app, "ib_email_flags"))
+			flagRecord.Set("email", record.Id)
+			flagRecord.Set("index", i)
+			flagRecord.Set("flag", flag)
+			if err := app.Save(flagRecord); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for i, label := range email.labels {
+			labelRecord := core.NewRecord(testutil.Collection(t, app, "ib_email_labels"))
+			labelRecord.Set("email", record.Id)
+			labelRecord.Set("index", i)
+			labelRecord.Set("label", label)
+			if err := app.Save(labelRecord); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	scenarios := []struct {
+		query    string
+		expected []string
+	}{
+		{"report", []string{"draft", "report"}},
+		{"from:alice", []string{"draft", "report"}},
+		{"from:alice -in:drafts", []string{"draft", "report"}},
+		{"from:alice -in:Drafts", []string{"report"}},
+		{"in:inbox", []string{"invite", "report"}},
+		{"subject:100%", []string{"invite"}},
+		{"subject:5%", []string{}},
+		{"is:unread", []string{"invite"}},
+		{"is:starred OR is:draft", []string{"draft", "invite"}},
+		{"larger:1M", []string{"report"}},
+		{"smaller:1K", []string{"draft"}},
+		{"after:2024-06-01", []string{"draft", "invite"}},
+		{"before:2024-06-01", []string{"report"}},
+		{"report (is:draft OR in:inbox) -is:unread", []string{"draft", "report"}},
+		{"has:attachment", []string{}},
+		{"label:work", []string{"report"}},
+		{"label:Work/Events", []string{"invite"}},
+		{"label:important", []string{"report"}},
+		{`label:\Important`, []string{"report"}},
+		{"label:Work OR label:work/events", []string{"invite", "report"}},
+		{"-label:work", []string{"draft", "invite"}},
+		{"label:Wor", []string{}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.query, func(t *testing.T) {
+			names := []string{}
+			for _, id := range search(t, app, s.query) {
+				names = append(names, ids[id])
+			}
+			slices.Sort(names)
+
+			if !slices.Equal(names, s.expected) {
+				t.Fatalf("expected %v, got %v", s.expected, names)
+			}
+		})
+	}
+}
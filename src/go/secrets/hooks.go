@@ -0,0 +1,75 @@
+package secrets
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// encryptedFields lists the fields of every collection that are stored encrypted.
+var encryptedFields = map[string][]string{
+	"ib_smtp_accounts": {"password", "oauth2_client_secret", "oauth2_refresh_token", "tls_client_key"},
+}
+
+// registerHooks encrypts every secret that is still plaintext before it is
+// saved. Without a master key new secrets are refused, unless storing them in
+// plaintext was allowed explicitly.
+func registerHooks(app core.App) {
+	for collection, fields := range encryptedFields {
+		encrypt := func(e *core.RecordEvent) error {
+			key, err := masterKey()
+			if err != nil {
+				return err
+			}
+			if key == nil {
+				allow, err := allowPlaintext()
+				if err != nil {
+					return err
+				}
+				if !allow {
+					if errs := refusePlaintext(e.Record, fields); len(errs) > 0 {
+						return errs
+					}
+				}
+				return e.Next()
+			}
+
+			for _, field := range fields {
+				value := e.Record.GetString(field)
+				if value == "" || IsEncrypted(value) {
+					continue
+				}
+
+				encrypted, err := Encrypt(key, value)
+				if err != nil {
+					return err
+				}
+				e.Record.Set(field, encrypted)
+			}
+
+			return e.Next()
+		}
+
+		app.OnRecordCreate(collection).BindFunc(encrypt)
+		app.OnRecordUpdate(collection).BindFunc(encrypt)
+	}
+}
+
+// refusePlaintext returns an error for every secret of the record that would
+// be stored in plaintext. Secrets that were stored before are left alone, so
+// records saved before a key was required can still be updated.
+func refusePlaintext(record *core.Record, fields []string) validation.Errors {
+	errs := validation.Errors{}
+	for _, field := range fields {
+		value := record.GetString(field)
+		if value == "" || IsEncrypted(value) || value == record.Original().GetString(field) {
+			continue
+		}
+
+		errs[field] = validation.NewError(
+			"validation_no_encryption_key",
+			"Can not be stored without an encryption key, set "+KeyEnv+" or "+KeyFileEnv+
+				" or allow storing secrets in plaintext with "+PlaintextEnv+"=true.",
+		)
+	}
+	return errs
+}
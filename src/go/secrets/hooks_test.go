@@ -0,0 +1,212 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/tests"
+
+	_ "github.com/yerTools/imapbackup/src/go/database/migrations"
+	"github.com/yerTools/imapbackup/src/go/testutil"
+)
+
+// configure replaces the master key and the plaintext opt-out for a test.
+func configure(t *testing.T, key []byte, allow bool) {
+	t.Helper()
+
+	oldKey, oldAllow := masterKey, allowPlaintext
+	t.Cleanup(func() {
+		masterKey, allowPlaintext = oldKey, oldAllow
+	})
+
+	masterKey = func() ([]byte, error) { return key, nil }
+	allowPlaintext = func() (bool, error) { return allow, nil }
+}
+
+func TestHooks(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, keySize)
+
+	scenarios := []struct {
+		name      string
+		key       []byte
+		allow     bool
+		refused   bool
+		encrypted bool
+	}{
+		{"with key", key, false, false, true},
+		{"with key and opt-out", key, true, false, true},
+		{"without key", nil, false, true, false},
+		{"without key with opt-out", nil, true, false, false},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			app, err := tests.NewTestApp()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer app.Cleanup()
+
+			configure(t, s.key, s.allow)
+			registerHooks(app)
+
+			account := testutil.NewAccount(t, app, nil)
+			err = app.Save(account)
+
+			var errs validation.Errors
+			if refused := errors.As(err, &errs); refused != s.refused {
+				t.Fatalf("expected refused to be %v, got %v", s.refused, err)
+			}
+			if s.refused {
+				if _, ok := errs["password"]; !ok {
+					t.Fatalf("expected an error for the password, got %v", errs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stored, err := app.FindRecordById("ib_smtp_accounts", account.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			password := stored.GetString("password")
+			if IsEncrypted(password) != s.encrypted {
+				t.Fatalf("expected encrypted to be %v, got %q", s.encrypted, password)
+			}
+
+			plaintext, err := Decrypt(s.key, password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plaintext != "password" {
+				t.Fatalf("expected the password to be kept, got %q", plaintext)
+			}
+		})
+	}
+}
+
+func TestHooksKeepStoredPlaintext(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	configure(t, nil, false)
+
+	// stored before secrets were refused
+	account := testutil.NewAccount(t, app, nil)
+	if err := app.Save(account); err != nil {
+		t.Fatal(err)
+	}
+
+	registerHooks(app)
+
+	account, err = app.FindRecordById("ib_smtp_accounts", account.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account.Set("username", "renamed")
+	if err := app.Save(account); err != nil {
+		t.Fatalf("expected an update of other fields to succeed, got %v", err)
+	}
+
+	account.Set("password", "changed")
+	if err := app.Save(account); err == nil {
+		t.Fatal("expected a new password to be refused")
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, keySize)
+	otherKey := bytes.Repeat([]byte{2}, keySize)
+
+	scenarios := []struct {
+		name      string
+		plaintext string
+		decryptBy []byte
+		err       bool
+	}{
+		{"same key", "secret", key, false},
+		{"empty value", "", key, false},
+		{"other key", "secret", otherKey, true},
+		{"no key", "secret", nil, true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			encrypted, err := Encrypt(key, s.plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsEncrypted(encrypted) {
+				t.Fatalf("expected %q to be marked as encrypted", encrypted)
+			}
+
+			plaintext, err := Decrypt(s.decryptBy, encrypted)
+			if s.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", plaintext)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if plaintext != s.plaintext {
+				t.Fatalf("expected %q, got %q", s.plaintext, plaintext)
+			}
+		})
+	}
+}
+
+func TestSeal(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, keySize)
+
+	scenarios := []struct {
+		name      string
+		key       []byte
+		allow     bool
+		value     string
+		encrypted bool
+		err       error
+	}{
+		{"key", key, false, "secret", true, nil},
+		{"key and empty value", key, false, "", false, nil},
+		{"no key", nil, false, "secret", false, ErrNoKey},
+		{"no key but allowed", nil, true, "secret", false, nil},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			configure(t, s.key, s.allow)
+
+			sealed, err := Seal(s.value)
+			if !errors.Is(err, s.err) {
+				t.Fatalf("expected error %v, got %v", s.err, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if IsEncrypted(sealed) != s.encrypted {
+				t.Fatalf("expected %q to be encrypted: %v", sealed, s.encrypted)
+			}
+
+			revealed, err := Decrypt(s.key, sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revealed != s.value {
+				t.Fatalf("expected %q, got %q", s.value, revealed)
+			}
+		})
+	}
+}
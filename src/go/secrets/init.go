@@ -0,0 +1,132 @@
+package secrets
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// Init checks the configured master key, encrypts secrets when they are
+// saved and registers the rotate-key command.
+func Init(app *pocketbase.PocketBase) {
+	key, err := masterKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+	allow, err := allowPlaintext()
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch {
+	case key == nil && allow:
+		log.Printf("warning: %v, account passwords are stored in plaintext\n", ErrNoKey)
+	case key == nil:
+		log.Printf("warning: %v, accounts with new passwords, tokens or keys can not be saved until %s=true is set\n", ErrNoKey, PlaintextEnv)
+	}
+
+	registerHooks(app)
+
+	app.RootCmd.AddCommand(newRotateKeyCommand(app))
+}
+
+func newRotateKeyCommand(app core.App) *cobra.Command {
+	var newKeyFile string
+
+	command := &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Re-encrypts every stored secret, with a new key if one is given",
+		Long: "Re-encrypts every stored secret. Secrets are decrypted with the configured key and encrypted " +
+			"with the key read from --new-key-file, which has to be configured afterwards. Without --new-key-file " +
+			"the configured key is used again, which encrypts secrets that are still stored in plaintext.",
+		RunE: func(command *cobra.Command, args []string) error {
+			oldKey, err := masterKey()
+			if err != nil {
+				return err
+			}
+
+			newKey := oldKey
+			if newKeyFile != "" {
+				if newKey, err = ReadKeyFile(newKeyFile); err != nil {
+					return fmt.Errorf("invalid new key: %w", err)
+				}
+			}
+			if newKey == nil {
+				return ErrNoKey
+			}
+
+			count, err := rotate(app, oldKey, newKey)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("re-encrypted the secrets of %d record(s)\n", count)
+			if newKeyFile != "" {
+				log.Printf("replace the configured key with the one in %s before starting again\n", newKeyFile)
+			}
+
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&newKeyFile, "new-key-file", "", "file containing the new base64 encoded key")
+
+	return command
+}
+
+// rotate re-encrypts every secret in a single transaction. The columns are
+// updated directly, so the records keep their 'updated' date.
+func rotate(app core.App, oldKey []byte, newKey []byte) (int, error) {
+	count := 0
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		for collectionName, fields := range encryptedFields {
+			collection, err := txApp.FindCollectionByNameOrId(collectionName)
+			if err != nil {
+				return err
+			}
+
+			records, err := txApp.FindAllRecords(collection)
+			if err != nil {
+				return err
+			}
+
+			for _, record := range records {
+				values := dbx.Params{}
+
+				for _, field := range fields {
+					value := record.GetString(field)
+					if value == "" {
+						continue
+					}
+
+					plaintext, err := Decrypt(oldKey, value)
+					if err != nil {
+						return fmt.Errorf("failed to decrypt %s of %s: %w", field, record.Id, err)
+					}
+
+					if values[field], err = Encrypt(newKey, plaintext); err != nil {
+						return err
+					}
+				}
+
+				if len(values) == 0 {
+					continue
+				}
+
+				_, err := txApp.DB().Update(collection.Name, values, dbx.HashExp{"id": record.Id}).Execute()
+				if err != nil {
+					return fmt.Errorf("failed to update %s: %w", record.Id, err)
+				}
+				count++
+			}
+		}
+
+		return nil
+	})
+
+	return count, err
+}
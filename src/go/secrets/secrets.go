@@ -0,0 +1,199 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// KeyEnv is the environment variable holding the base64 encoded master key.
+	KeyEnv = "IMAPBACKUP_ENCRYPTION_KEY"
+	// KeyFileEnv is the environment variable holding the path of a file
+	// that contains the base64 encoded master key.
+	KeyFileEnv = "IMAPBACKUP_ENCRYPTION_KEY_FILE"
+	// PlaintextEnv is the environment variable that has to be set to true to
+	// store secrets in plaintext while no master key is configured.
+	PlaintextEnv = "IMAPBACKUP_ALLOW_PLAINTEXT_SECRETS"
+
+	// prefix marks encrypted values, values without it are plaintext.
+	prefix = "enc:v1:"
+
+	keySize = 32
+)
+
+// ErrNoKey is returned if a secret has to be encrypted or decrypted, but no
+// master key is configured.
+var ErrNoKey = errors.New("no encryption key configured, set " + KeyEnv + " or " + KeyFileEnv)
+
+// masterKey is the key configured in the environment, nil if there is none.
+var masterKey = sync.OnceValues(func() ([]byte, error) {
+	if value := os.Getenv(KeyEnv); value != "" {
+		key, err := ParseKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", KeyEnv, err)
+		}
+		return key, nil
+	}
+
+	if path := os.Getenv(KeyFileEnv); path != "" {
+		key, err := ReadKeyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", KeyFileEnv, err)
+		}
+		return key, nil
+	}
+
+	return nil, nil
+})
+
+// allowPlaintext reports whether secrets may be stored in plaintext if no
+// master key is configured.
+var allowPlaintext = sync.OnceValues(func() (bool, error) {
+	value := os.Getenv(PlaintextEnv)
+	if value == "" {
+		return false, nil
+	}
+
+	allow, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", PlaintextEnv, err)
+	}
+	return allow, nil
+})
+
+// ParseKey decodes a base64 encoded AES-256 key.
+func ParseKey(value string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("key is not valid base64: %w", err)
+	}
+
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key has %d bytes, expected %d", len(key), keySize)
+	}
+
+	return key, nil
+}
+
+// ReadKeyFile reads a base64 encoded AES-256 key from a file.
+func ReadKeyFile(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKey(string(content))
+}
+
+// IsEncrypted reports whether the value was produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Encrypt encrypts the plaintext with AES-GCM under the key.
+func Encrypt(key []byte, plaintext string) (string, error) {
+	if key == nil {
+		return "", ErrNoKey
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of a value produced by Encrypt. Values that
+// are not encrypted are returned as they are.
+func Decrypt(key []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	if key == nil {
+		return "", ErrNoKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(value[len(prefix):])
+	if err != nil {
+		return "", fmt.Errorf("encrypted value is not valid base64: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt value, the encryption key is probably wrong")
+	}
+
+	return string(plaintext), nil
+}
+
+// Reveal decrypts a stored secret with the master key.
+func Reveal(value string) (string, error) {
+	key, err := masterKey()
+	if err != nil {
+		return "", err
+	}
+
+	return Decrypt(key, value)
+}
+
+// Seal prepares a secret to be stored without the record hooks, the same way
+// they would: it gets encrypted with the master key. Without a key it is
+// refused with ErrNoKey, unless storing secrets in plaintext was allowed.
+func Seal(value string) (string, error) {
+	key, err := masterKey()
+	if err != nil {
+		return "", err
+	}
+
+	if key == nil {
+		allow, err := allowPlaintext()
+		if err != nil {
+			return "", err
+		}
+		if !allow {
+			return "", ErrNoKey
+		}
+		return value, nil
+	}
+
+	if value == "" || IsEncrypted(value) {
+		return value, nil
+	}
+
+	return Encrypt(key, value)
+}
@@ -0,0 +1,98 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+)
+
+// NewServer starts an IMAP server without TLS that keeps its folders in
+// memory and returns its address. Its only user has the credentials that
+// NewAccount sets.
+func NewServer(t testing.TB) (*memory.Backend, *net.TCPAddr) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	be := memory.New()
+	serve(t, be, listener, true)
+
+	return be, listener.Addr().(*net.TCPAddr)
+}
+
+// NewTLSServer is like NewServer, but the server speaks implicit TLS with the
+// given certificate.
+func NewTLSServer(t testing.TB, certificate tls.Certificate) (*memory.Backend, *net.TCPAddr) {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{certificate}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	be := memory.New()
+	serve(t, be, listener, false)
+
+	return be, listener.Addr().(*net.TCPAddr)
+}
+
+func serve(t testing.TB, be *memory.Backend, listener net.Listener, allowInsecureAuth bool) {
+	s := server.New(be)
+	s.AllowInsecureAuth = allowInsecureAuth
+
+	go s.Serve(listener)
+	t.Cleanup(func() { s.Close() })
+}
+
+// NewCertificate returns a self-signed certificate for 127.0.0.1, along with
+// the PEM encoding of it that a client has to trust.
+func NewCertificate() (tls.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	certificate := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return certificate, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// ServerMailbox returns a folder of the server's user.
+func ServerMailbox(t testing.TB, be *memory.Backend, folder string) *memory.Mailbox {
+	t.Helper()
+
+	user, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mailbox, err := user.GetMailbox(folder)
+	if err != nil {
+		t.Fatalf("failed to find folder %s: %v", folder, err)
+	}
+
+	return mailbox.(*memory.Mailbox)
+}
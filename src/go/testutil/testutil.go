@@ -0,0 +1,63 @@
+// Package testutil contains the helpers that the tests of several packages
+// share. It must only be imported by tests.
+package testutil
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// OwnerEmail is the email of the regular user of the PocketBase test data.
+const OwnerEmail = "test@example.com"
+
+// Collection returns the collection with the given name or id.
+func Collection(t testing.TB, app core.App, name string) *core.Collection {
+	t.Helper()
+
+	collection, err := app.FindCollectionByNameOrId(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return collection
+}
+
+// Owner returns the regular user of the PocketBase test data.
+func Owner(t testing.TB, app core.App) *core.Record {
+	t.Helper()
+
+	owner, err := app.FindAuthRecordByEmail("users", OwnerEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return owner
+}
+
+// NewAccount returns an unsaved account of the owner. The fields are set on
+// top of the settings that are required to connect to a local server, the
+// credentials are the ones of the go-imap memory backend.
+func NewAccount(t testing.TB, app core.App, fields map[string]any) *core.Record {
+	t.Helper()
+
+	account := core.NewRecord(Collection(t, app, "ib_smtp_accounts"))
+	account.Set("created_by", Owner(t, app).Id)
+	account.Set("username", "username")
+	account.Set("password", "password")
+	account.Set("host", "localhost")
+	account.Set("port", 143)
+	for field, value := range fields {
+		account.Set(field, value)
+	}
+	return account
+}
+
+// CreateAccount saves and returns a new account of the owner.
+func CreateAccount(t testing.TB, app core.App, fields map[string]any) *core.Record {
+	t.Helper()
+
+	account := NewAccount(t, app, fields)
+	if err := app.Save(account); err != nil {
+		t.Fatal(err)
+	}
+	return account
+}